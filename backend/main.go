@@ -62,6 +62,7 @@ func main() {
 	registry := services.NewRegistry()
 	registry.AddService("Logging", implementation.NewLogging(db))
 	registry.AddService("CheckIn", implementation.NewCheckIn(db))
+	registry.AddService("Stats", implementation.NewStats(db))
 	srv := server.NewServer(cfg.ServerAddress, registry)
 	if err := srv.Start(); err != nil {
 		log.WithFields(log.Fields{"error": err}).Fatal("Failed to start RPC server")
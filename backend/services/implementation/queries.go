@@ -299,3 +299,35 @@ func IsHostNameKnown(db *bbolt.DB, hostName string) (result bool, err error) {
 	})
 	return
 }
+
+func WriteLatestStats(db *bbolt.DB, hostName string, data []byte) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		var hostBucket, statsBucket *bbolt.Bucket
+		if hostBucket, err = GetHostBucket(tx, hostName); err != nil {
+			return err
+		}
+		if statsBucket, err = GetChildBucket(tx, hostBucket, []byte("stats")); err != nil {
+			return err
+		}
+		return statsBucket.Put([]byte("latest"), data)
+	})
+}
+
+func GetLatestStats(db *bbolt.DB, hostName string) (data []byte, err error) {
+	err = db.View(func(tx *bbolt.Tx) error {
+		var hostBucket, statsBucket *bbolt.Bucket
+		var err error
+		if hostBucket, err = GetHostBucket(tx, hostName); err != nil {
+			return err
+		}
+		if statsBucket, err = GetChildBucket(tx, hostBucket, []byte("stats")); err != nil {
+			return err
+		}
+		if value := statsBucket.Get([]byte("latest")); value != nil {
+			data = append([]byte{}, value...)
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,36 @@
+package implementation
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/fernandosanchezjr/goasicminer/backend/services/messages"
+	log "github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+)
+
+// Stats keeps the latest device stats report of every miner.
+type Stats struct {
+	db *bbolt.DB
+}
+
+func NewStats(db *bbolt.DB) *Stats {
+	return &Stats{db: db}
+}
+
+// Report stores a gob encoded messages.StatsReport as the latest of its host.
+func (s *Stats) Report(rawReport []byte) {
+	var report messages.StatsReport
+	decoder := gob.NewDecoder(bytes.NewBuffer(rawReport))
+	if err := decoder.Decode(&report); err != nil {
+		log.WithError(err).Error("Error decoding stats report")
+		return
+	}
+	if err := WriteLatestStats(s.db, report.HostName, rawReport); err != nil {
+		log.WithError(err).Error("Error storing stats report")
+	}
+}
+
+// Latest returns the latest gob encoded messages.StatsReport of a host.
+func (s *Stats) Latest(hostName string) ([]byte, error) {
+	return GetLatestStats(s.db, hostName)
+}
@@ -0,0 +1,13 @@
+package messages
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/devices/base"
+	"time"
+)
+
+// StatsReport is the device stats snapshot a miner sends to the backend every governor.StatsInterval.
+type StatsReport struct {
+	HostName string
+	Time     time.Time
+	Devices  []*base.DeviceStats
+}
@@ -0,0 +1,79 @@
+package benchmarks
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"github.com/fernandosanchezjr/goasicminer/node"
+	"github.com/stevenroose/go-bitcoin-core-rpc/btcjson"
+	"testing"
+)
+
+const merkleTemplateTransactions = 3000
+
+func merkleTemplate(b *testing.B) *btcjson.GetBlockTemplateResult {
+	var template = &btcjson.GetBlockTemplateResult{CoinbaseValue: 625000000}
+	for i := 0; i < merkleTemplateTransactions; i++ {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{byte(i), byte(i >> 8)}, 0),
+			SignatureScript:  make([]byte, 107),
+			Sequence:         wire.MaxTxInSequenceNum,
+		})
+		tx.AddTxOut(&wire.TxOut{Value: 10000, PkScript: make([]byte, 25)})
+		tx.AddTxOut(&wire.TxOut{Value: 20000, PkScript: make([]byte, 22)})
+		data, err := node.MsgTxToString(tx)
+		if err != nil {
+			b.Fatal(err)
+		}
+		template.Transactions = append(template.Transactions, btcjson.GetBlockTemplateResultTx{
+			Data: data, Hash: tx.TxHash().String(), Fee: 1000, Weight: 900,
+		})
+		template.CoinbaseValue += 1000
+	}
+	return template
+}
+
+func merkleCoinbase(b *testing.B, extraNonce int64) *btcutil.Tx {
+	script, err := txscript.NewScriptBuilder().AddInt64(700000).AddInt64(extraNonce).Script()
+	if err != nil {
+		b.Fatal(err)
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex),
+		SignatureScript:  script,
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	tx.AddTxOut(&wire.TxOut{Value: 625000000, PkScript: make([]byte, 25)})
+	return btcutil.NewTx(tx)
+}
+
+func BenchmarkMerkleFullTree(b *testing.B) {
+	var template = merkleTemplate(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := node.GetMerkleTree(merkleCoinbase(b, int64(i)), template.Transactions); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMerkleCachedBranch(b *testing.B) {
+	var template = merkleTemplate(b)
+	policy, err := node.NewTemplatePolicy(&config.TemplatePolicy{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	selection, err := policy.Select(template)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, branch, _ := selection.Truncate(0)
+		node.MerkleRootFromBranch(*merkleCoinbase(b, int64(i)).Hash(), branch)
+	}
+}
@@ -0,0 +1,13 @@
+package config
+
+import "time"
+
+// AuxChain is a merged mined chain served by its own node. Blocks pay Wallet through createauxblock, or the node's
+// own wallet through getauxblock when Wallet is empty.
+type AuxChain struct {
+	Credentials `yaml:",inline"`
+
+	URL      string        `yaml:"url"`
+	Wallet   string        `yaml:"wallet,omitempty"`
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
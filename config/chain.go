@@ -0,0 +1,11 @@
+package config
+
+type Chain struct {
+	Name             string `yaml:"name"`
+	Base             string `yaml:"base,omitempty"`
+	SignetChallenge  string `yaml:"signetChallenge,omitempty"`
+	Net              uint32 `yaml:"net,omitempty"`
+	Bech32HRP        string `yaml:"bech32Hrp,omitempty"`
+	PubKeyHashAddrID *uint8 `yaml:"pubKeyHashAddrId,omitempty"`
+	ScriptHashAddrID *uint8 `yaml:"scriptHashAddrId,omitempty"`
+}
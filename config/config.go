@@ -1,11 +1,17 @@
 package config
 
 type Config struct {
-	Pools          []Pool       `yaml:"pools"`
-	BackendAddress string       `yaml:"backend,omitempty"`
-	ServerAddress  string       `yaml:"server,omitempty"`
-	R606           []R606       `yaml:"r606,omitempty"`
-	DownTime       []DownTime   `yaml:"downtime,omitempty"`
-	PowerControl   PowerControl `yaml:"power_control,omitempty"`
-	Node           *Node        `yaml:"node,omitempty"`
+	Pools          []Pool        `yaml:"pools"`
+	BackendAddress string        `yaml:"backend,omitempty"`
+	ServerAddress  string        `yaml:"server,omitempty"`
+	Devices        []Device      `yaml:"devices,omitempty"`
+	R606           []R606        `yaml:"r606,omitempty"`
+	Tuning         Tuning        `yaml:"tuning,omitempty"`
+	SoftStart      SoftStart     `yaml:"softStart,omitempty"`
+	PartialChains  PartialChains `yaml:"partialChains,omitempty"`
+	Supervisor     Supervisor    `yaml:"supervisor,omitempty"`
+	DownTime       []DownTime    `yaml:"downtime,omitempty"`
+	PowerControl   PowerControl  `yaml:"power_control,omitempty"`
+	Node           *Node         `yaml:"node,omitempty"`
+	Nodes          []*Node       `yaml:"nodes,omitempty"`
 }
@@ -0,0 +1,12 @@
+package config
+
+// Credentials authenticate against a node's RPC interface. They resolve in order of precedence: cookie file, secrets
+// file, environment variables and finally the plaintext User and Pass.
+type Credentials struct {
+	User        string `yaml:"user"`
+	Pass        string `yaml:"pass"`
+	UserEnv     string `yaml:"userEnv,omitempty"`
+	PassEnv     string `yaml:"passEnv,omitempty"`
+	SecretsFile string `yaml:"secretsFile,omitempty"`
+	CookieFile  string `yaml:"cookieFile,omitempty"`
+}
@@ -0,0 +1,85 @@
+package config
+
+import "time"
+
+// Device configures a single device of any driver by serial. Zero values keep the defaults of the driver, and devices
+// are enabled unless set otherwise. Pool assigns the device to the node of that name in the nodes section, whose work
+// it then mines instead of that of the main node. MinChips lets the device run with a partial chain of at least that
+// many chips. Driver picks the driver by name, such as "Bitaxe Supra", for devices whose USB ids several drivers
+// share, and is required for USB serial boards whose bridge does not report the board name.
+type Device struct {
+	Serial       string        `yaml:"serial"`
+	Alias        string        `yaml:"alias,omitempty"`
+	Driver       string        `yaml:"driver,omitempty"`
+	Enabled      *bool         `yaml:"enabled,omitempty"`
+	Frequency    float64       `yaml:"frequency,omitempty"`
+	MinFrequency float64       `yaml:"minFrequency,omitempty"`
+	MaxFrequency float64       `yaml:"maxFrequency,omitempty"`
+	Timeout      time.Duration `yaml:"timeout,omitempty"`
+	Pool         string        `yaml:"pool,omitempty"`
+	Chips        int           `yaml:"chips,omitempty"`
+	MinChips     int           `yaml:"minChips,omitempty"`
+}
+
+// IsEnabled reports whether the device should be mined with.
+func (d *Device) IsEnabled() bool {
+	return d.Enabled == nil || *d.Enabled
+}
+
+// Device returns the configuration of a serial, filling whatever it leaves unset from the driver defaults passed.
+func (c *Config) Device(serial string, defaults Device) Device {
+	var device = defaults
+	device.Serial = serial
+	for _, cfg := range c.Devices {
+		if cfg.Serial != serial {
+			continue
+		}
+		if cfg.Alias != "" {
+			device.Alias = cfg.Alias
+		}
+		if cfg.Driver != "" {
+			device.Driver = cfg.Driver
+		}
+		if cfg.Enabled != nil {
+			device.Enabled = cfg.Enabled
+		}
+		if cfg.Frequency != 0 {
+			device.Frequency = cfg.Frequency
+		}
+		if cfg.MinFrequency != 0 {
+			device.MinFrequency = cfg.MinFrequency
+		}
+		if cfg.MaxFrequency != 0 {
+			device.MaxFrequency = cfg.MaxFrequency
+		}
+		if cfg.Timeout != 0 {
+			device.Timeout = cfg.Timeout
+		}
+		if cfg.Pool != "" {
+			device.Pool = cfg.Pool
+		}
+		if cfg.Chips != 0 {
+			device.Chips = cfg.Chips
+		}
+		if cfg.MinChips != 0 {
+			device.MinChips = cfg.MinChips
+		}
+	}
+	return device
+}
+
+// DeviceEnabled reports whether a serial may be opened, which it may unless disabled in the devices section.
+func (c *Config) DeviceEnabled(serial string) bool {
+	var device = c.Device(serial, Device{})
+	return device.IsEnabled()
+}
+
+// foldR606 moves the frequencies of the r606 section into the devices section, where entries of the same serial
+// override them.
+func (c *Config) foldR606() {
+	var devices = make([]Device, 0, len(c.R606)+len(c.Devices))
+	for _, r606 := range c.R606 {
+		devices = append(devices, Device{Serial: r606.Serial, Frequency: r606.Frequency})
+	}
+	c.Devices, c.R606 = append(devices, c.Devices...), nil
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"gopkg.in/yaml.v2"
+	"testing"
+	"time"
+)
+
+func TestConfig_Device(t *testing.T) {
+	var cfg = &Config{}
+	if err := yaml.Unmarshal([]byte(`
+devices:
+  - serial: FT1
+    alias: shelf-left
+    driver: Bitaxe Supra
+    frequency: 600
+    timeout: 3s
+    pool: testnet
+    chips: 10
+  - serial: FT2
+    enabled: false
+`), cfg); err != nil {
+		t.Fatal(err)
+	}
+	var defaults = Device{Frequency: 700, MinFrequency: 200, MaxFrequency: 1200, Timeout: time.Second, Chips: 12}
+	device := cfg.Device("FT1", defaults)
+	if device.Serial != "FT1" || device.Alias != "shelf-left" || device.Driver != "Bitaxe Supra" ||
+		device.Frequency != 600 || device.MinFrequency != 200 || device.MaxFrequency != 1200 ||
+		device.Timeout != 3*time.Second || device.Pool != "testnet" ||
+		device.Chips != 10 || !device.IsEnabled() {
+		t.Fatalf("unexpected device %+v", device)
+	}
+	if device := cfg.Device("FT3", defaults); device.Serial != "FT3" || device.Alias != "" ||
+		device.Driver != "" || device.Frequency != 700 || device.Chips != 12 {
+		t.Fatalf("unexpected defaults %+v", device)
+	}
+	if cfg.DeviceEnabled("FT2") || !cfg.DeviceEnabled("FT1") || !cfg.DeviceEnabled("FT3") {
+		t.Fatal("unexpected enabled devices")
+	}
+}
+
+func TestConfig_FoldR606(t *testing.T) {
+	var cfg = &Config{}
+	if err := yaml.Unmarshal([]byte(`
+r606:
+  - serial: FT1
+    frequency: 650
+  - serial: FT2
+    frequency: 600
+devices:
+  - serial: FT2
+    frequency: 750
+`), cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.foldR606()
+	var defaults = Device{Frequency: 700}
+	if cfg.R606 != nil || cfg.Device("FT1", defaults).Frequency != 650 || cfg.Device("FT2", defaults).Frequency != 750 ||
+		cfg.Device("FT3", defaults).Frequency != 700 {
+		t.Fatalf("unexpected devices %+v", cfg.Devices)
+	}
+}
@@ -30,6 +30,7 @@ func LoadConfig() (*Config, error) {
 	if err = yaml.Unmarshal(data, c); err != nil {
 		return nil, err
 	}
+	c.foldR606()
 	return c, nil
 }
 
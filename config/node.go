@@ -1,9 +1,19 @@
 package config
 
+// Node configures a node to mine for. The main node feeds every device, and those of the nodes section, told apart
+// by Name, feed the devices assigned to them by pool.
 type Node struct {
-	URL        string `yaml:"url"`
-	User       string `yaml:"user"`
-	Pass       string `yaml:"pass"`
-	Wallet     string `yaml:"wallet"`
-	ClientOnly bool   `yaml:"clientOnly"`
+	Credentials `yaml:",inline"`
+
+	Name             string          `yaml:"name,omitempty"`
+	URL              string          `yaml:"url"`
+	Profile          string          `yaml:"profile,omitempty"`
+	Wallet           string          `yaml:"wallet"`
+	WalletDescriptor string          `yaml:"walletDescriptor,omitempty"`
+	ClientOnly       bool            `yaml:"clientOnly"`
+	ExtraNonce       string          `yaml:"extraNonce,omitempty"`
+	Template         TemplatePolicy  `yaml:"template,omitempty"`
+	Refresh          TemplateRefresh `yaml:"refresh,omitempty"`
+	Chains           []Chain         `yaml:"chains,omitempty"`
+	AuxPoW           *AuxChain       `yaml:"auxpow,omitempty"`
 }
@@ -0,0 +1,8 @@
+package config
+
+// PartialChains lets devices that find fewer chips than their chain holds run with the chips found, as long as there
+// are at least MinChips of them, instead of exiting. Devices configure their own minimum with minChips.
+type PartialChains struct {
+	Enabled  bool `yaml:"enabled,omitempty"`
+	MinChips int  `yaml:"minChips,omitempty"`
+}
@@ -1,5 +1,7 @@
 package config
 
+// R606 sets the frequency of an R606 by serial, the per-device configuration of earlier releases, which LoadConfig
+// folds into the devices section.
 type R606 struct {
 	Serial    string  `yaml:"serial"`
 	Frequency float64 `yaml:"frequency"`
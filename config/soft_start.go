@@ -0,0 +1,17 @@
+package config
+
+import "time"
+
+// SoftStart ramps chips up to their frequency on start in steps of Step from Start, holding each step for Settle of
+// hashing and moving on only once it has produced MinNonces valid nonces. Steps that fail to within Timeout of
+// hashing, or whose error rate over at least ten verified nonces after Settle is above MaxErrorRate, end the ramp at
+// the last good step. Zero values fall back to the ramp defaults.
+type SoftStart struct {
+	Enabled      bool          `yaml:"enabled,omitempty"`
+	Start        float64       `yaml:"start,omitempty"`
+	Step         float64       `yaml:"step,omitempty"`
+	Settle       time.Duration `yaml:"settle,omitempty"`
+	Timeout      time.Duration `yaml:"timeout,omitempty"`
+	MinNonces    uint64        `yaml:"minNonces,omitempty"`
+	MaxErrorRate float64       `yaml:"maxErrorRate,omitempty"`
+}
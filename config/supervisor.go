@@ -0,0 +1,13 @@
+package config
+
+import "time"
+
+// Supervisor sets how devices that exit are restarted. Restarts wait Backoff, doubled for every earlier restart since
+// the device last ran a whole Window without one, up to MaxBackoff, and a device restarted MaxRestarts times within
+// Window is failed until it is plugged in again. Zero values fall back to the supervisor defaults.
+type Supervisor struct {
+	Backoff     time.Duration `yaml:"backoff,omitempty"`
+	MaxBackoff  time.Duration `yaml:"maxBackoff,omitempty"`
+	Window      time.Duration `yaml:"window,omitempty"`
+	MaxRestarts int           `yaml:"maxRestarts,omitempty"`
+}
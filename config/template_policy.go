@@ -0,0 +1,11 @@
+package config
+
+type TemplatePolicy struct {
+	ExcludeTxids    []string `yaml:"excludeTxids,omitempty"`
+	ExcludeScripts  []string `yaml:"excludeScripts,omitempty"`
+	PriorityTxids   []string `yaml:"priorityTxids,omitempty"`
+	PriorityScripts []string `yaml:"priorityScripts,omitempty"`
+	MaxWeight       int64    `yaml:"maxWeight,omitempty"`
+	MaxSigOps       int64    `yaml:"maxSigOps,omitempty"`
+	EmptyBlock      bool     `yaml:"emptyBlock,omitempty"`
+}
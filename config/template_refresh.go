@@ -0,0 +1,10 @@
+package config
+
+import "time"
+
+type TemplateRefresh struct {
+	Interval    time.Duration `yaml:"interval,omitempty"`
+	MinFeeDelta int64         `yaml:"minFeeDelta,omitempty"`
+	MaxAge      time.Duration `yaml:"maxAge,omitempty"`
+	Disabled    bool          `yaml:"disabled,omitempty"`
+}
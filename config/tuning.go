@@ -0,0 +1,16 @@
+package config
+
+import "time"
+
+// Tuning enables automatic frequency tuning, per device and optionally per chip once the device frequency settles.
+// Only BM1387 based devices, the R606 and NewPac, are tuned, and PerChip offsets are kept for them alone; the rest
+// keep their configured frequency. Zero values fall back to the tuner defaults.
+type Tuning struct {
+	Enabled       bool          `yaml:"enabled,omitempty"`
+	PerChip       bool          `yaml:"perChip,omitempty"`
+	Step          float64       `yaml:"step,omitempty"`
+	Interval      time.Duration `yaml:"interval,omitempty"`
+	MinNonces     uint64        `yaml:"minNonces,omitempty"`
+	MaxErrorRate  float64       `yaml:"maxErrorRate,omitempty"`
+	MaxChipOffset float64       `yaml:"maxChipOffset,omitempty"`
+}
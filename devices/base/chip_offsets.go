@@ -0,0 +1,72 @@
+package base
+
+import (
+	"encoding/json"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+)
+
+const (
+	ChipOffsetsPath = "devices"
+	ChipOffsetsFile = "chip_offsets.json"
+)
+
+// chipOffsetsMtx serializes the read, modify and write cycles of controllers sharing the offsets file.
+var chipOffsetsMtx sync.Mutex
+
+func GetChipOffsetsPath() string {
+	return path.Join(utils.GetSubFolder(ChipOffsetsPath), ChipOffsetsFile)
+}
+
+func loadChipOffsets(offsetsPath string) (map[string][]float64, error) {
+	var offsets = map[string][]float64{}
+	data, err := ioutil.ReadFile(offsetsPath)
+	if os.IsNotExist(err) {
+		return offsets, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &offsets); err != nil {
+		return nil, err
+	}
+	return offsets, nil
+}
+
+// LoadChipOffsets returns the frequency offset of every chip of a device by chip index. Devices without offsets, or
+// whose offsets were kept for another chip count, start from none.
+func LoadChipOffsets(offsetsPath string, serial string, chipCount int) ([]float64, error) {
+	chipOffsetsMtx.Lock()
+	defer chipOffsetsMtx.Unlock()
+	var chipOffsets = make([]float64, chipCount)
+	offsets, err := loadChipOffsets(offsetsPath)
+	if err != nil {
+		return chipOffsets, err
+	}
+	if found := offsets[serial]; len(found) == chipCount {
+		copy(chipOffsets, found)
+	}
+	return chipOffsets, nil
+}
+
+// SaveChipOffsets writes the offsets of a device, keeping those of other devices.
+func SaveChipOffsets(offsetsPath string, serial string, chipOffsets []float64) error {
+	chipOffsetsMtx.Lock()
+	defer chipOffsetsMtx.Unlock()
+	offsets, err := loadChipOffsets(offsetsPath)
+	if err != nil {
+		return err
+	}
+	offsets[serial] = chipOffsets
+	data, err := json.MarshalIndent(offsets, "", "  ")
+	if err != nil {
+		return err
+	}
+	var tmpPath = offsetsPath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, offsetsPath)
+}
@@ -0,0 +1,112 @@
+package base
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"math"
+	"sync"
+	"time"
+)
+
+const DefaultMaxChipOffset = 50.0
+
+// ChipTuner moves the frequency of single chips around the device frequency from the nonces attributed to each.
+// Chips erring above MaxErrorRate are clocked down a step and may not climb back, while chips finding at least their
+// share of nonces without errors are clocked up a step, up to MaxOffset.
+type ChipTuner struct {
+	Step         float64
+	MaxOffset    float64
+	Interval     time.Duration
+	MinNonces    uint64
+	MaxErrorRate float64
+	offsets      []float64
+	ceilings     []float64
+	valid        []uint64
+	errors       []uint64
+	since        time.Time
+	mtx          sync.Mutex
+}
+
+// NewChipTuner resumes tuning from the offsets passed, usually those persisted for the device.
+func NewChipTuner(tuning config.Tuning, offsets []float64) *ChipTuner {
+	var chipCount = len(offsets)
+	ct := &ChipTuner{Step: tuning.Step, MaxOffset: tuning.MaxChipOffset, Interval: tuning.Interval,
+		MinNonces: tuning.MinNonces, MaxErrorRate: tuning.MaxErrorRate, offsets: append([]float64{}, offsets...),
+		ceilings: make([]float64, chipCount), valid: make([]uint64, chipCount), errors: make([]uint64, chipCount),
+		since: time.Now()}
+	if ct.Step <= 0 {
+		ct.Step = DefaultTuningStep
+	}
+	if ct.MaxOffset <= 0 {
+		ct.MaxOffset = DefaultMaxChipOffset
+	}
+	if ct.Interval <= 0 {
+		ct.Interval = DefaultTuningInterval
+	}
+	if ct.MinNonces == 0 {
+		ct.MinNonces = DefaultTuningMinNonces
+	}
+	if ct.MaxErrorRate <= 0 {
+		ct.MaxErrorRate = DefaultTuningMaxErrorRate
+	}
+	for i := range ct.ceilings {
+		ct.ceilings[i] = ct.MaxOffset
+	}
+	return ct
+}
+
+// Record counts a verified nonce for the chip that found it.
+func (ct *ChipTuner) Record(chip int, valid bool) {
+	ct.mtx.Lock()
+	defer ct.mtx.Unlock()
+	if chip < 0 || chip >= len(ct.offsets) {
+		return
+	}
+	if valid {
+		ct.valid[chip] += 1
+	} else {
+		ct.errors[chip] += 1
+	}
+}
+
+func (ct *ChipTuner) Offsets() []float64 {
+	ct.mtx.Lock()
+	defer ct.mtx.Unlock()
+	return append([]float64{}, ct.offsets...)
+}
+
+// Next steps every chip once the interval since the last decision is long enough and the device found MinNonces in
+// it, returning the offsets and whether any changed.
+func (ct *ChipTuner) Next(now time.Time) ([]float64, bool) {
+	ct.mtx.Lock()
+	defer ct.mtx.Unlock()
+	var chipCount = len(ct.offsets)
+	var totalValid, total uint64
+	for i := 0; i < chipCount; i++ {
+		totalValid += ct.valid[i]
+		total += ct.valid[i] + ct.errors[i]
+	}
+	if chipCount == 0 || now.Sub(ct.since) < ct.Interval || total < ct.MinNonces {
+		return append([]float64{}, ct.offsets...), false
+	}
+	ct.since = now
+	var share = float64(totalValid) / float64(chipCount)
+	var changed bool
+	for i := 0; i < chipCount; i++ {
+		var previous = ct.offsets[i]
+		var chipTotal = ct.valid[i] + ct.errors[i]
+		var errorRate float64
+		if chipTotal > 0 {
+			errorRate = float64(ct.errors[i]) / float64(chipTotal)
+		}
+		switch {
+		case chipTotal == 0 || errorRate > ct.MaxErrorRate:
+			ct.ceilings[i] = math.Max(-ct.MaxOffset, ct.offsets[i]-ct.Step)
+			ct.offsets[i] = ct.ceilings[i]
+		case ct.errors[i] == 0 && float64(ct.valid[i]) >= share:
+			ct.offsets[i] = math.Min(ct.ceilings[i], ct.offsets[i]+ct.Step)
+		}
+		ct.valid[i], ct.errors[i] = 0, 0
+		changed = changed || ct.offsets[i] != previous
+	}
+	return append([]float64{}, ct.offsets...), changed
+}
@@ -0,0 +1,76 @@
+package base
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChipTuner_Next(t *testing.T) {
+	var ct = NewChipTuner(config.Tuning{Interval: time.Minute, MinNonces: 300, Step: 10, MaxChipOffset: 20},
+		[]float64{0, 0, 10})
+	var now = ct.since
+	var record = func(chip, valid, errors int) {
+		for i := 0; i < valid; i++ {
+			ct.Record(chip, true)
+		}
+		for i := 0; i < errors; i++ {
+			ct.Record(chip, false)
+		}
+	}
+	record(0, 110, 0)
+	record(1, 90, 10)
+	record(2, 110, 0)
+	if _, changed := ct.Next(now.Add(time.Second)); changed {
+		t.Fatal("tuned before the interval")
+	}
+	now = now.Add(time.Minute)
+	offsets, changed := ct.Next(now)
+	if !changed || !reflect.DeepEqual(offsets, []float64{10, -10, 20}) {
+		t.Fatalf("tuned to %v", offsets)
+	}
+	// the erring chip may not climb back over the step it failed at, the others stop at the maximum offset
+	record(0, 100, 0)
+	record(1, 100, 0)
+	record(2, 100, 0)
+	now = now.Add(time.Minute)
+	if offsets, _ = ct.Next(now); !reflect.DeepEqual(offsets, []float64{20, -10, 20}) {
+		t.Fatalf("tuned to %v", offsets)
+	}
+	// a silent chip is clocked down
+	record(0, 300, 0)
+	now = now.Add(time.Minute)
+	if offsets, _ = ct.Next(now); !reflect.DeepEqual(offsets, []float64{20, -20, 10}) {
+		t.Fatalf("tuned to %v", offsets)
+	}
+}
+
+func TestChipOffsets(t *testing.T) {
+	folder, err := ioutil.TempDir("", "offsets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	var offsetsPath = path.Join(folder, ChipOffsetsFile)
+	if offsets, err := LoadChipOffsets(offsetsPath, "a", 2); err != nil || !reflect.DeepEqual(offsets, []float64{0, 0}) {
+		t.Fatalf("loaded %v: %v", offsets, err)
+	}
+	if err := SaveChipOffsets(offsetsPath, "a", []float64{-12.5, 25}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveChipOffsets(offsetsPath, "b", []float64{6.25}); err != nil {
+		t.Fatal(err)
+	}
+	if offsets, err := LoadChipOffsets(offsetsPath, "a", 2); err != nil ||
+		!reflect.DeepEqual(offsets, []float64{-12.5, 25}) {
+		t.Fatalf("loaded %v: %v", offsets, err)
+	}
+	// offsets kept for another chip count are dropped
+	if offsets, err := LoadChipOffsets(offsetsPath, "b", 2); err != nil || !reflect.DeepEqual(offsets, []float64{0, 0}) {
+		t.Fatalf("loaded %v: %v", offsets, err)
+	}
+}
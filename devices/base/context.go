@@ -4,8 +4,11 @@ import (
 	"github.com/fernandosanchezjr/goasicminer/generators"
 	"github.com/fernandosanchezjr/goasicminer/node"
 	"github.com/fernandosanchezjr/goasicminer/utils"
+	log "github.com/sirupsen/logrus"
 	"math/rand"
+	"sort"
 	"sync"
+	"time"
 )
 
 type Context struct {
@@ -13,18 +16,37 @@ type Context struct {
 	controllers    map[string]IController
 	lastVersionId  uint64
 	rng            *rand.Rand
-	generator      generators.Generator
+	newGenerator   func() generators.Generator
+	generators     map[string]generators.Generator
+	works          map[string]*node.Work
+	supervisor     *Supervisor
 }
 
-func NewContext() *Context {
+// NewContext creates a context whose controllers take their tasks from a generator of their pool, made with
+// newGenerator, and whose restarts are recorded with supervisor.
+func NewContext(newGenerator func() generators.Generator, supervisor *Supervisor) *Context {
 	c := &Context{
-		controllers: map[string]IController{},
-		rng:         rand.New(rand.NewSource(utils.RandomInt64())),
-		generator:   generators.NewUsedNTimes(),
+		controllers:  map[string]IController{},
+		rng:          rand.New(rand.NewSource(utils.RandomInt64())),
+		newGenerator: newGenerator,
+		generators:   map[string]generators.Generator{},
+		works:        map[string]*node.Work{},
+		supervisor:   supervisor,
 	}
 	return c
 }
 
+// generator returns the generator of a pool, the empty one being the main node, starting it on first use. Callers
+// hold the controllers lock.
+func (c *Context) generator(pool string) generators.Generator {
+	generator, found := c.generators[pool]
+	if !found {
+		generator = c.newGenerator()
+		c.generators[pool] = generator
+	}
+	return generator
+}
+
 func (c *Context) InUse(serial string) bool {
 	c.controllersMtx.Lock()
 	defer c.controllersMtx.Unlock()
@@ -32,14 +54,40 @@ func (c *Context) InUse(serial string) bool {
 	return found
 }
 
+func (c *Context) Supervisor() *Supervisor {
+	return c.supervisor
+}
+
+// RestartAllowed reports whether a device may be opened, which it may not while backing off from its last restart or
+// once failed.
+func (c *Context) RestartAllowed(serial string) bool {
+	return c.supervisor.Allowed(serial, time.Now())
+}
+
+// Restarted records a controller that exited or could not reset with the supervisor.
+func (c *Context) Restarted(controller IController, reason error) {
+	history := c.supervisor.Restarted(controller, reason, time.Now())
+	var fields = log.Fields{
+		"serial":   controller.Alias(),
+		"reason":   reason.Error(),
+		"restarts": history.Restarts,
+		"until":    history.Until.Format(time.RFC3339),
+	}
+	if history.Failed {
+		log.WithFields(fields).Errorln("Device failed after restarting too often")
+	} else {
+		log.WithFields(fields).Warnln("Device restart scheduled")
+	}
+}
+
 func (c *Context) Register(controller IController) {
-	controller.SetGenerator(c.generator.GeneratorChan())
+	c.controllersMtx.Lock()
+	defer c.controllersMtx.Unlock()
+	controller.SetGenerator(c.generator(controller.Pool()).GeneratorChan())
 	serialNumber := controller.String()
-	if c.InUse(serialNumber) {
+	if _, found := c.controllers[serialNumber]; found {
 		return
 	}
-	c.controllersMtx.Lock()
-	defer c.controllersMtx.Unlock()
 	c.controllers[serialNumber] = controller
 }
 
@@ -59,8 +107,11 @@ func (c *Context) Close() {
 	for _, ct := range c.controllers {
 		ct.Close()
 	}
-	c.generator.Close()
+	for _, generator := range c.generators {
+		generator.Close()
+	}
 	c.controllers = map[string]IController{}
+	c.generators = map[string]generators.Generator{}
 }
 
 func (c *Context) GetControllers(driver IDriver) []IController {
@@ -75,19 +126,68 @@ func (c *Context) GetControllers(driver IDriver) []IController {
 	return found
 }
 
+// UpdateWork hands work of the main node to the devices mining for it.
 func (c *Context) UpdateWork(work *node.Work) {
+	c.UpdatePoolWork("", work)
+}
+
+// UpdatePoolWork hands work of the node of a pool to the devices assigned to it, and keeps it for devices found later.
+func (c *Context) UpdatePoolWork(pool string, work *node.Work) {
 	c.controllersMtx.Lock()
 	defer c.controllersMtx.Unlock()
-	c.generator.UpdateWork(work.Clone())
+	c.works[pool] = work
+	c.updatePoolWork(pool, work)
+}
+
+// ResendWork hands the latest work of every pool to its devices again, reaching those registered since it arrived.
+func (c *Context) ResendWork() {
+	c.controllersMtx.Lock()
+	defer c.controllersMtx.Unlock()
+	for pool, work := range c.works {
+		c.updatePoolWork(pool, work)
+	}
+}
+
+func (c *Context) updatePoolWork(pool string, work *node.Work) {
+	c.generator(pool).UpdateWork(work.Clone())
 	for _, ct := range c.controllers {
-		ct.UpdateWork(work.Clone())
+		if ct.Pool() == pool {
+			ct.UpdateWork(work.Clone())
+		}
 	}
 }
 
-func (c *Context) ExtraNonceFound(extraNonce utils.Nonce64) {
-	c.generator.ExtraNonceFound(extraNonce)
+func (c *Context) ExtraNonceFound(pool string, extraNonce utils.Nonce64) {
+	c.controllersMtx.Lock()
+	var generator = c.generator(pool)
+	c.controllersMtx.Unlock()
+	generator.ExtraNonceFound(extraNonce)
 }
 
+// ProgressChan reports the progress of the generator of the main node.
 func (c *Context) ProgressChan() chan utils.Nonce64 {
-	return c.generator.ProgressChan()
+	c.controllersMtx.Lock()
+	defer c.controllersMtx.Unlock()
+	return c.generator("").ProgressChan()
+}
+
+// Stats snapshots the nonce counts and hashrates of every registered controller, ordered by serial.
+func (c *Context) Stats() []*DeviceStats {
+	c.controllersMtx.Lock()
+	defer c.controllersMtx.Unlock()
+	var now = time.Now()
+	var stats = make([]*DeviceStats, 0, len(c.controllers))
+	for _, ct := range c.controllers {
+		var ds = ct.NonceStats().Snapshot(ct.String(), ct.Driver().String())
+		ds.Alias = ct.Alias()
+		ds.Pool = ct.Pool()
+		ds.ChipCount, ds.TargetChips = ct.Chips()
+		ds.Degraded = ct.Degraded()
+		ds.HashRates = ct.HashMeter().Rates(now)
+		stats = append(stats, ds)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Serial < stats[j].Serial
+	})
+	return stats
 }
@@ -0,0 +1,104 @@
+package base
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/generators"
+	"github.com/fernandosanchezjr/goasicminer/node"
+	"testing"
+)
+
+type testGenerator struct {
+	generators.Generator
+	generated chan *generators.Generated
+	works     []*node.Work
+	closed    bool
+}
+
+func (tg *testGenerator) UpdateWork(work *node.Work) {
+	tg.works = append(tg.works, work)
+}
+
+func (tg *testGenerator) GeneratorChan() chan *generators.Generated {
+	return tg.generated
+}
+
+func (tg *testGenerator) Close() {
+	tg.closed = true
+}
+
+type poolController struct {
+	IController
+	serial    string
+	pool      string
+	generated chan *generators.Generated
+	works     []*node.Work
+	closed    bool
+}
+
+func (pc *poolController) String() string {
+	return pc.serial
+}
+
+func (pc *poolController) Pool() string {
+	return pc.pool
+}
+
+func (pc *poolController) SetGenerator(generator chan *generators.Generated) {
+	pc.generated = generator
+}
+
+func (pc *poolController) UpdateWork(work *node.Work) {
+	pc.works = append(pc.works, work)
+}
+
+func (pc *poolController) Close() {
+	pc.closed = true
+}
+
+func TestContext_PoolWork(t *testing.T) {
+	var made []*testGenerator
+	var context = NewContext(func() generators.Generator {
+		var generator = &testGenerator{generated: make(chan *generators.Generated)}
+		made = append(made, generator)
+		return generator
+	}, &Supervisor{})
+	var main = &poolController{serial: "FT1"}
+	var testnet = &poolController{serial: "FT2", pool: "testnet"}
+	context.Register(main)
+	context.Register(testnet)
+	if len(made) != 2 || main.generated == testnet.generated {
+		t.Fatalf("expected a generator per pool, got %d", len(made))
+	}
+
+	context.UpdateWork(&node.Work{Height: 1})
+	context.UpdatePoolWork("testnet", &node.Work{Height: 2})
+	if len(main.works) != 1 || main.works[0].Height != 1 {
+		t.Fatalf("main node device got %+v", main.works)
+	}
+	if len(testnet.works) != 1 || testnet.works[0].Height != 2 {
+		t.Fatalf("testnet device got %+v", testnet.works)
+	}
+	if len(made[0].works) != 1 || made[0].works[0].Height != 1 || len(made[1].works) != 1 ||
+		made[1].works[0].Height != 2 {
+		t.Fatal("work not handed to the generator of its pool")
+	}
+
+	var late = &poolController{serial: "FT3", pool: "testnet"}
+	context.Register(late)
+	if late.generated != testnet.generated {
+		t.Fatal("device registered later got another generator than its pool")
+	}
+	context.ResendWork()
+	if len(late.works) != 1 || late.works[0].Height != 2 || len(main.works) != 2 {
+		t.Fatal("latest work not resent to the devices of its pool")
+	}
+
+	context.Close()
+	if !main.closed || !testnet.closed || !late.closed {
+		t.Fatal("device left open on close")
+	}
+	for _, generator := range made {
+		if !generator.closed {
+			t.Fatal("generator left open on close")
+		}
+	}
+}
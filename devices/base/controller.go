@@ -3,20 +3,26 @@ package base
 import (
 	"errors"
 	"fmt"
+	"github.com/fernandosanchezjr/goasicminer/config"
 	"github.com/fernandosanchezjr/goasicminer/generators"
 	"github.com/fernandosanchezjr/goasicminer/node"
 	"github.com/fernandosanchezjr/goasicminer/utils"
 	log "github.com/sirupsen/logrus"
-	"github.com/ziutek/ftdi"
 	"sync"
 )
 
+// ErrReadTimeout fails controllers whose chain stays silent for longer than their timeout.
+var ErrReadTimeout = errors.New("no response within timeout")
+
 type IController interface {
 	String() string
+	Alias() string
+	Pool() string
 	LongString() string
 	Close()
 	Exit()
-	Device() *ftdi.Device
+	Fail(err error)
+	Transport() Transport
 	Driver() IDriver
 	Equals(other IController) bool
 	Reset() error
@@ -29,28 +35,55 @@ type IController interface {
 	SetGenerator(generator chan *generators.Generated)
 	GetGenerator() chan *generators.Generated
 	ExtraNonceFound(extraNonce utils.Nonce64)
+	NonceStats() *NonceStats
+	HashMeter() *HashMeter
+	CheckChips(found, target int) error
+	Chips() (found, target int)
+	Degraded() bool
 }
 
 type Controller struct {
-	device        *ftdi.Device
+	transport     Transport
 	driver        IDriver
 	serialNumber  string
+	alias         string
+	pool          string
+	partialChains config.PartialChains
+	chipCount     int
+	targetChips   int
 	workChan      node.WorkChan
 	context       *Context
 	open          bool
+	failed        bool
 	generatorChan chan *generators.Generated
+	nonceStats    *NonceStats
+	hashMeter     *HashMeter
 	mtx           sync.Mutex
 }
 
-func NewController(ctx *Context, driver IDriver, device *ftdi.Device, serialNumber string) *Controller {
-	return &Controller{device: device, context: ctx, driver: driver, serialNumber: serialNumber,
-		workChan: make(node.WorkChan, 16), open: true}
+func NewController(ctx *Context, driver IDriver, transport Transport, serialNumber string) *Controller {
+	return &Controller{transport: transport, context: ctx, driver: driver, serialNumber: serialNumber,
+		workChan: make(node.WorkChan, 16), open: true, nonceStats: NewNonceStats(),
+		hashMeter: NewHashMeter()}
 }
 
 func (c *Controller) String() string {
 	return c.serialNumber
 }
 
+// Alias names the device in logs and stats, and is its serial unless configured otherwise.
+func (c *Controller) Alias() string {
+	if c.alias != "" {
+		return c.alias
+	}
+	return c.serialNumber
+}
+
+// Pool names the node of the nodes section the device mines for, and is empty for the main node.
+func (c *Controller) Pool() string {
+	return c.pool
+}
+
 func (c *Controller) LongString() string {
 	return fmt.Sprintf("%s %s", c.driver, c)
 }
@@ -58,7 +91,7 @@ func (c *Controller) LongString() string {
 func (c *Controller) recover() {
 	if err := recover(); err != nil {
 		log.WithFields(log.Fields{
-			"serial": c.String(),
+			"serial": c.Alias(),
 			"error":  err,
 		}).Error("Error recovery")
 	}
@@ -70,9 +103,9 @@ func (c *Controller) Close() {
 		return
 	}
 	c.open = false
-	if err := c.device.Close(); err != nil {
+	if err := c.transport.Close(); err != nil {
 		log.WithFields(log.Fields{
-			"serial": c.String(),
+			"serial": c.Alias(),
 			"error":  err,
 		}).Warnln("Close error")
 	}
@@ -86,8 +119,21 @@ func (c *Controller) Exit() {
 	c.context.Unregister(c)
 }
 
-func (c *Controller) Device() *ftdi.Device {
-	return c.device
+// Fail exits a controller that stopped working, recording err with the supervisor as the reason for its restart.
+func (c *Controller) Fail(err error) {
+	c.mtx.Lock()
+	if !c.open || c.failed {
+		c.mtx.Unlock()
+		return
+	}
+	c.failed = true
+	c.mtx.Unlock()
+	c.context.Restarted(c, err)
+	c.Exit()
+}
+
+func (c *Controller) Transport() Transport {
+	return c.transport
 }
 
 func (c *Controller) Driver() IDriver {
@@ -114,7 +160,7 @@ func (c *Controller) WorkChannel() node.WorkChan {
 }
 
 func (c *Controller) AllocateWriteBuffer() ([]byte, error) {
-	if size, err := c.device.WriteChunkSize(); err != nil {
+	if size, err := c.transport.WriteChunkSize(); err != nil {
 		return nil, err
 	} else {
 		return make([]byte, size), nil
@@ -127,11 +173,11 @@ func (c *Controller) Write(data []byte) (int, error) {
 	if !c.open {
 		return 0, errors.New("device closed")
 	}
-	return c.device.Write(data)
+	return c.transport.Write(data)
 }
 
 func (c *Controller) AllocateReadBuffer() ([]byte, error) {
-	if size, err := c.device.ReadChunkSize(); err != nil {
+	if size, err := c.transport.ReadChunkSize(); err != nil {
 		return nil, err
 	} else {
 		return make([]byte, size), nil
@@ -144,7 +190,7 @@ func (c *Controller) Read(data []byte) (int, error) {
 	if !c.open {
 		return 0, errors.New("device closed")
 	}
-	return c.device.Read(data)
+	return c.transport.Read(data)
 }
 
 func (c *Controller) SetGenerator(generator chan *generators.Generated) {
@@ -156,5 +202,43 @@ func (c *Controller) GetGenerator() chan *generators.Generated {
 }
 
 func (c *Controller) ExtraNonceFound(extraNonce utils.Nonce64) {
-	c.context.ExtraNonceFound(extraNonce)
+	c.context.ExtraNonceFound(c.pool, extraNonce)
+}
+
+func (c *Controller) NonceStats() *NonceStats {
+	return c.nonceStats
+}
+
+func (c *Controller) HashMeter() *HashMeter {
+	return c.hashMeter
+}
+
+// CheckChips decides whether a chain that found some of its target chips may run. Short chains run degraded when the
+// partial chain policy allows as many chips as were found.
+func (c *Controller) CheckChips(found, target int) error {
+	c.chipCount, c.targetChips = found, target
+	if found == target {
+		return nil
+	}
+	var minChips = c.partialChains.MinChips
+	if minChips < 1 {
+		minChips = 1
+	}
+	if !c.partialChains.Enabled || found > target || found < minChips {
+		return fmt.Errorf("found %d chips instead of %d", found, target)
+	}
+	log.WithFields(log.Fields{
+		"serial": c.Alias(),
+		"found":  found,
+		"target": target,
+	}).Warnln("Running degraded with a partial chain")
+	return nil
+}
+
+func (c *Controller) Chips() (found, target int) {
+	return c.chipCount, c.targetChips
+}
+
+func (c *Controller) Degraded() bool {
+	return c.chipCount < c.targetChips
 }
@@ -0,0 +1,33 @@
+package base
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"testing"
+)
+
+func TestController_CheckChips(t *testing.T) {
+	var controller = NewController(nil, nil, nil, "FT1")
+	if err := controller.CheckChips(12, 12); err != nil || controller.Degraded() {
+		t.Fatal("full chain rejected")
+	}
+	if err := controller.CheckChips(11, 12); err == nil {
+		t.Fatal("partial chain accepted without a policy")
+	}
+	controller.partialChains = config.PartialChains{Enabled: true, MinChips: 10}
+	if err := controller.CheckChips(11, 12); err != nil || !controller.Degraded() {
+		t.Fatal("partial chain rejected")
+	}
+	if found, target := controller.Chips(); found != 11 || target != 12 {
+		t.Fatalf("found %d of %d chips", found, target)
+	}
+	if err := controller.CheckChips(9, 12); err == nil {
+		t.Fatal("chain below minimum accepted")
+	}
+	if err := controller.CheckChips(13, 12); err == nil {
+		t.Fatal("oversized chain accepted")
+	}
+	controller.partialChains = config.PartialChains{Enabled: true}
+	if err := controller.CheckChips(0, 12); err == nil {
+		t.Fatal("empty chain accepted")
+	}
+}
@@ -6,18 +6,25 @@ import (
 	"github.com/ziutek/ftdi"
 )
 
+// IDriver creates the controllers for one kind of device, whichever catalog finds it.
 type IDriver interface {
 	GetPidVid() PidVid
-	MatchesDevice(manufacturer, productName string) bool
 	String() string
 	NewController(
 		config *config.Config,
 		context *Context,
 		driver IDriver,
-		device *ftdi.Device,
+		transport Transport,
 		serialNumber string,
 	) IController
 	Equals(driver IDriver) bool
+}
+
+// IFTDIDriver is a driver for devices behind an FTDI bridge, which carry their own manufacturer and product strings
+// and are opened on a channel of the bridge.
+type IFTDIDriver interface {
+	IDriver
+	MatchesDevice(manufacturer, productName string) bool
 	GetChannel() ftdi.Channel
 }
 
@@ -54,13 +61,32 @@ func (d *Driver) Equals(driver IDriver) bool {
 }
 
 func (d *Driver) NewController(
-	config *config.Config,
+	cfg *config.Config,
 	context *Context,
 	driver IDriver,
-	device *ftdi.Device,
+	transport Transport,
 	serialNumber string,
 ) IController {
-	return NewController(context, driver, device, serialNumber)
+	return newDeviceController(cfg, context, driver, transport, serialNumber)
+}
+
+// newDeviceController creates the base controller of a device, applying what the devices section sets for its serial.
+func newDeviceController(
+	cfg *config.Config,
+	context *Context,
+	driver IDriver,
+	transport Transport,
+	serialNumber string,
+) *Controller {
+	var device = cfg.Device(serialNumber, config.Device{})
+	var controller = NewController(context, driver, transport, serialNumber)
+	controller.alias = device.Alias
+	controller.pool = device.Pool
+	controller.partialChains = cfg.PartialChains
+	if device.MinChips > 0 {
+		controller.partialChains = config.PartialChains{Enabled: true, MinChips: device.MinChips}
+	}
+	return controller
 }
 
 func (d *Driver) GetChannel() ftdi.Channel {
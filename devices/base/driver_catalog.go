@@ -8,22 +8,23 @@ import (
 type IDriverCatalog interface {
 	String() string
 	FindControllers(config *config.Config, context *Context) ([]IController, error)
+	PidVids() []PidVid
 }
 
 type DriverCatalog struct {
 	Name    string
-	Drivers map[PidVid][]IDriver
+	Drivers map[PidVid][]IFTDIDriver
 }
 
-func NewDriverCatalog(name string, driver ...IDriver) *DriverCatalog {
-	dc := &DriverCatalog{Name: name, Drivers: map[PidVid][]IDriver{}}
+func NewDriverCatalog(name string, driver ...IFTDIDriver) *DriverCatalog {
+	dc := &DriverCatalog{Name: name, Drivers: map[PidVid][]IFTDIDriver{}}
 	for _, d := range driver {
 		dc.addDriver(d)
 	}
 	return dc
 }
 
-func (dc *DriverCatalog) addDriver(driver IDriver) {
+func (dc *DriverCatalog) addDriver(driver IFTDIDriver) {
 	pidVid := driver.GetPidVid()
 	drivers := dc.Drivers[pidVid]
 	dc.Drivers[pidVid] = append(drivers, driver)
@@ -41,11 +42,12 @@ func (dc *DriverCatalog) FindControllers(config *config.Config, context *Context
 		}
 		for _, dev := range devices {
 			for _, drv := range drivers {
-				if drv.MatchesDevice(dev.Manufacturer, dev.Description) && !context.InUse(dev.Serial) {
+				if drv.MatchesDevice(dev.Manufacturer, dev.Description) && !context.InUse(dev.Serial) &&
+					config.DeviceEnabled(dev.Serial) && context.RestartAllowed(dev.Serial) {
 					if ftdiDevice, err = ftdi.OpenUSBDev(dev, drv.GetChannel()); err != nil {
 						return nil, err
 					}
-					ctrl := drv.NewController(config, context, drv, ftdiDevice, dev.Serial)
+					ctrl := drv.NewController(config, context, drv, NewFTDITransport(ftdiDevice), dev.Serial)
 					context.Register(ctrl)
 					controllers = append(controllers, ctrl)
 				}
@@ -58,3 +60,11 @@ func (dc *DriverCatalog) FindControllers(config *config.Config, context *Context
 func (dc *DriverCatalog) String() string {
 	return dc.Name
 }
+
+func (dc *DriverCatalog) PidVids() []PidVid {
+	var pidVids []PidVid
+	for pidVid := range dc.Drivers {
+		pidVids = append(pidVids, pidVid)
+	}
+	return pidVids
+}
@@ -0,0 +1,139 @@
+package base
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRampStep         = 50.0
+	DefaultRampSettle       = 2 * time.Second
+	DefaultRampTimeout      = 2 * time.Minute
+	DefaultRampMinNonces    = 1
+	DefaultRampMaxErrorRate = 0.25
+	// RampErrorSample is the fewest verified nonces the error rate of a step is judged on.
+	RampErrorSample = 10
+	// RampPollInterval is how often controllers ask their ramp for the next step.
+	RampPollInterval = 500 * time.Millisecond
+)
+
+// FrequencyRamp soft-starts a device, which draws less current at lower frequencies, stepping it from a low
+// frequency up to its target. Each step must produce valid nonces before the next is taken, and the ramp stops at the
+// last good step when one does not. The start defaults to half the target. Steps are timed only while the device
+// hashes, so waiting for work neither settles nor times them out.
+type FrequencyRamp struct {
+	Target       float64
+	Step         float64
+	Settle       time.Duration
+	Timeout      time.Duration
+	MinNonces    uint64
+	MaxErrorRate float64
+	frequency    float64
+	good         float64
+	done         bool
+	aborted      bool
+	valid        uint64
+	errors       uint64
+	hashed       time.Duration
+	last         time.Time
+	mtx          sync.Mutex
+}
+
+func NewFrequencyRamp(softStart config.SoftStart, minFrequency, target float64) *FrequencyRamp {
+	fr := &FrequencyRamp{Target: target, Step: softStart.Step, Settle: softStart.Settle, Timeout: softStart.Timeout,
+		MinNonces: softStart.MinNonces, MaxErrorRate: softStart.MaxErrorRate, frequency: softStart.Start}
+	if fr.Step <= 0 {
+		fr.Step = DefaultRampStep
+	}
+	if fr.Settle <= 0 {
+		fr.Settle = DefaultRampSettle
+	}
+	if fr.Timeout <= 0 {
+		fr.Timeout = DefaultRampTimeout
+	}
+	if fr.MinNonces == 0 {
+		fr.MinNonces = DefaultRampMinNonces
+	}
+	if fr.MaxErrorRate <= 0 {
+		fr.MaxErrorRate = DefaultRampMaxErrorRate
+	}
+	if fr.frequency <= 0 {
+		fr.frequency = target / 2
+	}
+	fr.frequency = math.Min(math.Max(fr.frequency, minFrequency), target)
+	return fr
+}
+
+// Record counts a verified nonce, valid or a hardware error.
+func (fr *FrequencyRamp) Record(valid bool) {
+	fr.mtx.Lock()
+	defer fr.mtx.Unlock()
+	if valid {
+		fr.valid += 1
+	} else {
+		fr.errors += 1
+	}
+}
+
+func (fr *FrequencyRamp) Frequency() float64 {
+	fr.mtx.Lock()
+	defer fr.mtx.Unlock()
+	return fr.frequency
+}
+
+// Done reports whether the ramp reached its target or stopped short of it.
+func (fr *FrequencyRamp) Done() bool {
+	fr.mtx.Lock()
+	defer fr.mtx.Unlock()
+	return fr.done
+}
+
+// Aborted reports whether the ramp stopped short of its target.
+func (fr *FrequencyRamp) Aborted() bool {
+	fr.mtx.Lock()
+	defer fr.mtx.Unlock()
+	return fr.aborted
+}
+
+// Pause stops the clock of the current step while the device has no work, until the next call to Next.
+func (fr *FrequencyRamp) Pause() {
+	fr.mtx.Lock()
+	defer fr.mtx.Unlock()
+	fr.last = time.Time{}
+}
+
+// Next checks the current step, timing it from the previous call unless paused since, and returns the frequency to
+// run at along with whether it changed. Once settled over a sample of at least RampErrorSample nonces, a step passes
+// with enough valid nonces and fails on too many errors. It also fails when the timeout passes without passing.
+func (fr *FrequencyRamp) Next(now time.Time) (float64, bool) {
+	fr.mtx.Lock()
+	defer fr.mtx.Unlock()
+	if fr.done {
+		return fr.frequency, false
+	}
+	if !fr.last.IsZero() {
+		fr.hashed += now.Sub(fr.last)
+	}
+	fr.last = now
+	var total = fr.valid + fr.errors
+	var sampled = fr.hashed >= fr.Settle && total >= fr.MinNonces && total >= RampErrorSample
+	var previous = fr.frequency
+	switch {
+	case sampled && float64(fr.errors)/float64(total) > fr.MaxErrorRate, fr.hashed >= fr.Timeout:
+		fr.done, fr.aborted = true, true
+		if fr.good > 0 {
+			fr.frequency = fr.good
+		}
+	case sampled && fr.valid >= fr.MinNonces:
+		fr.good = fr.frequency
+		if fr.frequency >= fr.Target {
+			fr.done = true
+		} else {
+			fr.frequency = math.Min(fr.frequency+fr.Step, fr.Target)
+		}
+		fr.valid, fr.errors, fr.hashed = 0, 0, 0
+	}
+	return fr.frequency, fr.frequency != previous
+}
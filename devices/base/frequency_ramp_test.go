@@ -0,0 +1,95 @@
+package base
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"testing"
+	"time"
+)
+
+func recordNonces(fr *FrequencyRamp, valid, errors int) {
+	for i := 0; i < valid; i++ {
+		fr.Record(true)
+	}
+	for i := 0; i < errors; i++ {
+		fr.Record(false)
+	}
+}
+
+func TestFrequencyRamp_Next(t *testing.T) {
+	var fr = NewFrequencyRamp(config.SoftStart{Enabled: true, Step: 100, Settle: time.Second, MinNonces: 2}, 100, 500)
+	var now = time.Now()
+	if frequency := fr.Frequency(); frequency != 250 {
+		t.Fatalf("started at %f", frequency)
+	}
+	fr.Next(now)
+	recordNonces(fr, RampErrorSample, 0)
+	if _, changed := fr.Next(now.Add(time.Second / 2)); changed {
+		t.Fatal("stepped before settling")
+	}
+	for _, expected := range []float64{350, 450, 500} {
+		recordNonces(fr, RampErrorSample, 0)
+		now = now.Add(time.Second)
+		if frequency, changed := fr.Next(now); !changed || frequency != expected {
+			t.Fatalf("stepped to %f, expected %f", frequency, expected)
+		}
+	}
+	recordNonces(fr, RampErrorSample, 0)
+	now = now.Add(time.Second)
+	if frequency, changed := fr.Next(now); changed || frequency != 500 || !fr.Done() || fr.Aborted() {
+		t.Fatal("ramp did not finish at target")
+	}
+}
+
+func TestFrequencyRamp_Abort(t *testing.T) {
+	var fr = NewFrequencyRamp(config.SoftStart{Enabled: true, Start: 50, Step: 100, Settle: time.Second,
+		Timeout: time.Minute}, 100, 500)
+	var now = time.Now()
+	if frequency := fr.Frequency(); frequency != 100 {
+		t.Fatalf("started at %f below the minimum", frequency)
+	}
+	fr.Next(now)
+	// a single hardware error neither ends an unsettled step nor outweighs a full sample
+	recordNonces(fr, 0, 1)
+	if _, changed := fr.Next(now.Add(time.Second / 2)); changed || fr.Done() {
+		t.Fatal("ramp ended on one error before settling")
+	}
+	recordNonces(fr, RampErrorSample-1, 0)
+	now = now.Add(time.Second)
+	if frequency, changed := fr.Next(now); !changed || frequency != 200 {
+		t.Fatalf("stepped to %f", frequency)
+	}
+	// too many hardware errors at 200 end the ramp back at 100
+	recordNonces(fr, RampErrorSample-4, 4)
+	now = now.Add(time.Second)
+	if frequency, changed := fr.Next(now); !changed || frequency != 100 || !fr.Aborted() {
+		t.Fatalf("ramp kept %f after errors", frequency)
+	}
+	if _, changed := fr.Next(now.Add(time.Hour)); changed {
+		t.Fatal("ramp moved after finishing")
+	}
+	// a silent first step times out where it started
+	fr = NewFrequencyRamp(config.SoftStart{Enabled: true, Timeout: time.Minute}, 100, 500)
+	fr.Next(now)
+	if frequency, changed := fr.Next(now.Add(time.Minute)); changed || frequency != 250 || !fr.Aborted() {
+		t.Fatal("silent ramp did not stop at its start")
+	}
+}
+
+func TestFrequencyRamp_Pause(t *testing.T) {
+	var fr = NewFrequencyRamp(config.SoftStart{Enabled: true, Settle: time.Second, Timeout: time.Minute}, 100, 500)
+	var now = time.Now()
+	// waiting for work longer than the timeout leaves the step running
+	fr.Next(now)
+	fr.Pause()
+	now = now.Add(time.Hour)
+	if _, changed := fr.Next(now); changed || fr.Done() {
+		t.Fatal("step timed out without work")
+	}
+	recordNonces(fr, RampErrorSample, 0)
+	if _, changed := fr.Next(now.Add(time.Second / 2)); changed {
+		t.Fatal("step settled while paused")
+	}
+	if frequency, changed := fr.Next(now.Add(time.Second)); !changed || frequency != 300 {
+		t.Fatalf("stepped to %f", frequency)
+	}
+}
@@ -0,0 +1,133 @@
+package base
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTuningStep         = 25.0
+	DefaultTuningInterval     = 2 * time.Minute
+	DefaultTuningMinNonces    = 1000
+	DefaultTuningMaxErrorRate = 0.02
+	// TuningPollInterval is how often controllers ask their tuner for a decision.
+	TuningPollInterval = 5 * time.Second
+)
+
+// FrequencyTuner steps a device up from its starting frequency while each step raises the hashrate measured from
+// verified nonces, settling on the best step once it stops improving. Error rates above MaxErrorRate step the
+// frequency down and lower the ceiling for good, which is how a settled device re-tunes as it warms up or ages.
+type FrequencyTuner struct {
+	MinFrequency    float64
+	MaxFrequency    float64
+	Step            float64
+	Interval        time.Duration
+	MinNonces       uint64
+	MaxErrorRate    float64
+	NonceDifficulty float64
+	HashRate        utils.HashRate
+	ErrorRate       float64
+	frequency       float64
+	ceiling         float64
+	bestFrequency   float64
+	bestHashRate    utils.HashRate
+	settled         bool
+	valid           uint64
+	errors          uint64
+	since           time.Time
+	mtx             sync.Mutex
+}
+
+// NewFrequencyTuner starts tuning from frequency. Chips reporting nonces above difficulty 1 pass their nonce
+// difficulty, so every valid nonce stands for that many difficulty 1 shares.
+func NewFrequencyTuner(
+	tuning config.Tuning,
+	minFrequency, maxFrequency, frequency, nonceDifficulty float64,
+) *FrequencyTuner {
+	ft := &FrequencyTuner{MinFrequency: minFrequency, MaxFrequency: maxFrequency, Step: tuning.Step,
+		Interval: tuning.Interval, MinNonces: tuning.MinNonces, MaxErrorRate: tuning.MaxErrorRate,
+		NonceDifficulty: nonceDifficulty, frequency: frequency, ceiling: maxFrequency, since: time.Now()}
+	if ft.Step <= 0 {
+		ft.Step = DefaultTuningStep
+	}
+	if ft.Interval <= 0 {
+		ft.Interval = DefaultTuningInterval
+	}
+	if ft.MinNonces == 0 {
+		ft.MinNonces = DefaultTuningMinNonces
+	}
+	if ft.MaxErrorRate <= 0 {
+		ft.MaxErrorRate = DefaultTuningMaxErrorRate
+	}
+	return ft
+}
+
+// Record counts a verified nonce, valid or a hardware error.
+func (ft *FrequencyTuner) Record(valid bool) {
+	ft.mtx.Lock()
+	defer ft.mtx.Unlock()
+	if valid {
+		ft.valid += 1
+	} else {
+		ft.errors += 1
+	}
+}
+
+func (ft *FrequencyTuner) Frequency() float64 {
+	ft.mtx.Lock()
+	defer ft.mtx.Unlock()
+	return ft.frequency
+}
+
+func (ft *FrequencyTuner) Settled() bool {
+	ft.mtx.Lock()
+	defer ft.mtx.Unlock()
+	return ft.settled
+}
+
+// Next measures the interval since the last decision once it is long enough and holds enough nonces, and returns the
+// frequency to run at along with whether it changed.
+func (ft *FrequencyTuner) Next(now time.Time) (float64, bool) {
+	ft.mtx.Lock()
+	defer ft.mtx.Unlock()
+	var elapsed = now.Sub(ft.since)
+	var total = ft.valid + ft.errors
+	if elapsed < ft.Interval || total < ft.MinNonces {
+		return ft.frequency, false
+	}
+	ft.HashRate = utils.HashRate(float64(ft.valid) * ft.NonceDifficulty * math.MaxUint32 / elapsed.Seconds())
+	ft.ErrorRate = float64(ft.errors) / float64(total)
+	ft.valid, ft.errors, ft.since = 0, 0, now
+	var previous = ft.frequency
+	switch {
+	case ft.ErrorRate > ft.MaxErrorRate:
+		ft.ceiling = math.Max(ft.MinFrequency, ft.frequency-ft.Step)
+		ft.frequency = ft.ceiling
+		ft.bestHashRate = 0
+		ft.settled = false
+	case ft.settled:
+	case ft.HashRate > ft.bestHashRate:
+		ft.bestFrequency, ft.bestHashRate = ft.frequency, ft.HashRate
+		if ft.frequency+ft.Step <= ft.ceiling {
+			ft.frequency += ft.Step
+		} else {
+			ft.settled = true
+		}
+	default:
+		ft.frequency = ft.bestFrequency
+		ft.settled = true
+	}
+	return ft.frequency, ft.frequency != previous
+}
+
+// Restart tunes afresh from a frequency the device reached without the tuner, such as the end of a soft start.
+func (ft *FrequencyTuner) Restart(frequency float64, now time.Time) {
+	ft.mtx.Lock()
+	defer ft.mtx.Unlock()
+	ft.frequency, ft.ceiling, ft.settled = frequency, ft.MaxFrequency, false
+	ft.bestFrequency, ft.bestHashRate = 0, 0
+	ft.valid, ft.errors, ft.since = 0, 0, now
+}
@@ -0,0 +1,69 @@
+package base
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"testing"
+	"time"
+)
+
+// feed records an interval of nonces at a rate proportional to the frequency with the given error rate.
+func feed(ft *FrequencyTuner, frequency float64, errorRate float64) {
+	var nonces = int(frequency * 10)
+	var errors = int(float64(nonces) * errorRate)
+	for i := 0; i < nonces; i++ {
+		ft.Record(i >= errors)
+	}
+}
+
+func TestFrequencyTuner_Next(t *testing.T) {
+	var ft = NewFrequencyTuner(config.Tuning{Interval: time.Minute, MinNonces: 100}, 100, 800, 500, 1)
+	var now = ft.since
+	if _, changed := ft.Next(now.Add(time.Hour)); changed {
+		t.Fatal("changed frequency without nonces")
+	}
+	// hashrate follows frequency up to 600, where errors set in
+	var expected = []float64{525, 550, 575, 600, 575}
+	for _, e := range expected {
+		var current = ft.Frequency()
+		var errorRate float64
+		if current > 575 {
+			errorRate = 0.1
+		}
+		feed(ft, current, errorRate)
+		now = now.Add(time.Minute)
+		if frequency, changed := ft.Next(now); !changed || frequency != e {
+			t.Fatalf("moved from %f to %f, expected %f", current, frequency, e)
+		}
+	}
+	// the step below the errors is measured once more and kept
+	feed(ft, 575, 0)
+	now = now.Add(time.Minute)
+	if frequency, changed := ft.Next(now); changed || frequency != 575 || !ft.Settled() {
+		t.Fatalf("settled at %f", frequency)
+	}
+	// errors on a settled device step it down again
+	feed(ft, 575, 0.05)
+	now = now.Add(time.Minute)
+	if frequency, changed := ft.Next(now); !changed || frequency != 550 || ft.Settled() {
+		t.Fatalf("re-tuned to %f", frequency)
+	}
+}
+
+func TestFrequencyTuner_SettlesOnBest(t *testing.T) {
+	var ft = NewFrequencyTuner(config.Tuning{Interval: time.Minute, MinNonces: 100}, 100, 800, 500, 1)
+	var now = ft.since
+	feed(ft, 500, 0)
+	now = now.Add(time.Minute)
+	if frequency, _ := ft.Next(now); frequency != 525 {
+		t.Fatalf("stepped to %f", frequency)
+	}
+	// a step that measures lower than the last one falls back to it
+	feed(ft, 490, 0)
+	now = now.Add(time.Minute)
+	if frequency, changed := ft.Next(now); !changed || frequency != 500 || !ft.Settled() {
+		t.Fatalf("settled at %f", frequency)
+	}
+	if ft.HashRate == 0 || ft.ErrorRate != 0 {
+		t.Fatalf("measured %s with error rate %f", ft.HashRate, ft.ErrorRate)
+	}
+}
@@ -0,0 +1,62 @@
+package base
+
+import "github.com/ziutek/ftdi"
+
+// FTDITransport drives a chain through an FTDI USB UART, using the CBUS pins as GPIO.
+type FTDITransport struct {
+	device *ftdi.Device
+}
+
+func NewFTDITransport(device *ftdi.Device) *FTDITransport {
+	return &FTDITransport{device: device}
+}
+
+func (ft *FTDITransport) Read(data []byte) (int, error) {
+	return ft.device.Read(data)
+}
+
+func (ft *FTDITransport) Write(data []byte) (int, error) {
+	return ft.device.Write(data)
+}
+
+func (ft *FTDITransport) Close() error {
+	return ft.device.Close()
+}
+
+func (ft *FTDITransport) Reset() error {
+	if err := ft.device.Reset(); err != nil {
+		return err
+	}
+	if err := ft.device.SetLineProperties2(ftdi.DataBits8, ftdi.StopBits1, ftdi.ParityNone, ftdi.BreakOff); err != nil {
+		return err
+	}
+	return ft.device.SetFlowControl(ftdi.FlowCtrlDisable)
+}
+
+func (ft *FTDITransport) SetBaudRate(baudRate int) error {
+	return ft.device.SetBaudrate(baudRate)
+}
+
+func (ft *FTDITransport) Purge() error {
+	if err := ft.device.PurgeWriteBuffer(); err != nil {
+		return err
+	}
+	return ft.device.PurgeReadBuffer()
+}
+
+func (ft *FTDITransport) SetLatencyTimer(milliseconds int) error {
+	return ft.device.SetLatencyTimer(milliseconds)
+}
+
+// SetGPIO sets the CBUS bit bang mode, whose high nibble selects outputs and low nibble their levels.
+func (ft *FTDITransport) SetGPIO(outputs, levels byte) error {
+	return ft.device.SetBitmode(outputs<<4|levels&0x0f, ftdi.ModeCBUS)
+}
+
+func (ft *FTDITransport) ReadChunkSize() (int, error) {
+	return ft.device.ReadChunkSize()
+}
+
+func (ft *FTDITransport) WriteChunkSize() (int, error) {
+	return ft.device.WriteChunkSize()
+}
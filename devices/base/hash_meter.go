@@ -0,0 +1,108 @@
+package base
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	HashMeterBucket = 5 * time.Second
+	HashMeterSpan   = time.Hour
+	hashMeterCount  = int(HashMeterSpan / HashMeterBucket)
+)
+
+// HashRates is the hashrate measured over the last minute, five minutes, quarter hour and hour, along with the rate
+// expected from the chip count and frequency. Health is the quarter hour rate over the expected one.
+type HashRates struct {
+	OneMinute      utils.HashRate `json:"1m"`
+	FiveMinutes    utils.HashRate `json:"5m"`
+	FifteenMinutes utils.HashRate `json:"15m"`
+	OneHour        utils.HashRate `json:"1h"`
+	Expected       utils.HashRate `json:"expected"`
+	Health         float64        `json:"health"`
+}
+
+// HashMeter measures the hashrate of a device from its valid nonces, each standing for as many difficulty 1 shares
+// as the difficulty the chips report nonces at. Nonces are summed in HashMeterBucket buckets over HashMeterSpan.
+type HashMeter struct {
+	expected        utils.HashRate
+	nonceDifficulty float64
+	buckets         [hashMeterCount]float64
+	current         int64
+	started         time.Time
+	mtx             sync.Mutex
+}
+
+func NewHashMeter() *HashMeter {
+	return &HashMeter{nonceDifficulty: 1, started: time.Now()}
+}
+
+// SetExpected sets the hashrate the device should reach and the difficulty its chips report nonces at.
+func (hm *HashMeter) SetExpected(expected utils.HashRate, nonceDifficulty float64) {
+	hm.mtx.Lock()
+	defer hm.mtx.Unlock()
+	hm.expected = expected
+	hm.nonceDifficulty = nonceDifficulty
+}
+
+func bucketIndex(t time.Time) int64 {
+	return t.UnixNano() / int64(HashMeterBucket)
+}
+
+// advance clears the buckets passed since the last nonce. Callers must hold the lock.
+func (hm *HashMeter) advance(now time.Time) {
+	var index = bucketIndex(now)
+	if index <= hm.current {
+		return
+	}
+	for i := hm.current + 1; i <= index && i <= hm.current+int64(hashMeterCount); i++ {
+		hm.buckets[i%int64(hashMeterCount)] = 0
+	}
+	hm.current = index
+}
+
+// Record counts a valid nonce found at now.
+func (hm *HashMeter) Record(now time.Time) {
+	hm.mtx.Lock()
+	defer hm.mtx.Unlock()
+	hm.advance(now)
+	hm.buckets[hm.current%int64(hashMeterCount)] += hm.nonceDifficulty
+}
+
+// rate measures the hashrate over the window ending at now, or since the meter started when that is shorter.
+// Callers must hold the lock and have advanced the buckets.
+func (hm *HashMeter) rate(window time.Duration, now time.Time) utils.HashRate {
+	var count = int64(window / HashMeterBucket)
+	var shares float64
+	for i := int64(0); i < count; i++ {
+		shares += hm.buckets[(hm.current-i)%int64(hashMeterCount)]
+	}
+	var currentStart = time.Unix(0, hm.current*int64(HashMeterBucket))
+	var elapsed = time.Duration(count-1)*HashMeterBucket + now.Sub(currentStart)
+	if sinceStart := now.Sub(hm.started); sinceStart < elapsed {
+		elapsed = sinceStart
+	}
+	if elapsed <= 0 {
+		return 0
+	}
+	return utils.HashRate(shares * math.MaxUint32 / elapsed.Seconds())
+}
+
+func (hm *HashMeter) Rates(now time.Time) HashRates {
+	hm.mtx.Lock()
+	defer hm.mtx.Unlock()
+	hm.advance(now)
+	var rates = HashRates{
+		OneMinute:      hm.rate(time.Minute, now),
+		FiveMinutes:    hm.rate(5*time.Minute, now),
+		FifteenMinutes: hm.rate(15*time.Minute, now),
+		OneHour:        hm.rate(time.Hour, now),
+		Expected:       hm.expected,
+	}
+	if hm.expected > 0 {
+		rates.Health = hm.expected.Fraction(rates.FifteenMinutes)
+	}
+	return rates
+}
@@ -0,0 +1,37 @@
+package base
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHashMeter_Rates(t *testing.T) {
+	var hm = NewHashMeter()
+	var start = time.Unix(0, 0).Add(1000 * HashMeterBucket)
+	hm.started = start
+	hm.SetExpected(2*math.MaxUint32, 1)
+	// one nonce a second for the first minute, none for the next four
+	for i := 0; i < 60; i++ {
+		hm.Record(start.Add(time.Duration(i) * time.Second))
+	}
+	var rates = hm.Rates(start.Add(time.Minute))
+	if math.Abs(float64(rates.OneMinute)/math.MaxUint32-1) > 0.01 || rates.OneHour != rates.OneMinute {
+		t.Fatalf("unexpected rates %+v", rates)
+	}
+	if math.Abs(rates.Health-0.5) > 0.01 {
+		t.Fatalf("health %f", rates.Health)
+	}
+	rates = hm.Rates(start.Add(5*time.Minute - time.Second))
+	if rates.OneMinute != 0 || math.Abs(float64(rates.FiveMinutes)/math.MaxUint32-0.2) > 0.01 {
+		t.Fatalf("unexpected rates %+v", rates)
+	}
+	// nonces older than the span are forgotten
+	hm.SetExpected(0, 256)
+	hm.Record(start.Add(2 * time.Hour))
+	rates = hm.Rates(start.Add(2*time.Hour + HashMeterBucket))
+	var expected = 256 * math.MaxUint32 / time.Hour.Seconds()
+	if math.Abs(float64(rates.OneHour)/expected-1) > 0.01 || rates.Health != 0 {
+		t.Fatalf("unexpected rates %+v", rates)
+	}
+}
@@ -0,0 +1,109 @@
+package base
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type HotplugAction string
+
+const (
+	HotplugAdd    HotplugAction = "add"
+	HotplugRemove HotplugAction = "remove"
+)
+
+// HotplugEvent is a USB device arriving or leaving. Serial may be empty for devices without one.
+type HotplugEvent struct {
+	Action  HotplugAction
+	DevPath string
+	PidVid  PidVid
+	Serial  string
+}
+
+// HotplugSource delivers USB hot-plug events until closed. The netlink source listens to kernel uevents, and tests
+// stand in their own.
+type HotplugSource interface {
+	Events() <-chan HotplugEvent
+	Close() error
+}
+
+// ParseUevent decodes a kernel uevent, a header followed by NUL separated KEY=value pairs, keeping only the
+// additions and removals of whole USB devices.
+func ParseUevent(data []byte) (*HotplugEvent, bool) {
+	var fields = map[string]string{}
+	for _, field := range bytes.Split(data, []byte{0}) {
+		if i := bytes.IndexByte(field, '='); i > 0 {
+			fields[string(field[:i])] = string(field[i+1:])
+		}
+	}
+	if fields["SUBSYSTEM"] != "usb" || fields["DEVTYPE"] != "usb_device" {
+		return nil, false
+	}
+	var event = &HotplugEvent{Action: HotplugAction(fields["ACTION"]), DevPath: fields["DEVPATH"]}
+	if event.Action != HotplugAdd && event.Action != HotplugRemove {
+		return nil, false
+	}
+	// PRODUCT holds the vendor, product and release numbers in hex without leading zeros
+	var product = strings.Split(fields["PRODUCT"], "/")
+	if len(product) < 2 {
+		return nil, false
+	}
+	vendor, vendorErr := strconv.ParseInt(product[0], 16, 32)
+	productId, productErr := strconv.ParseInt(product[1], 16, 32)
+	if vendorErr != nil || productErr != nil {
+		return nil, false
+	}
+	event.PidVid = PidVid{Product: int(productId), Vendor: int(vendor)}
+	return event, true
+}
+
+// usbSerials maps the devpath of every USB device present under sysRoot to its serial, for removals to be matched to
+// the serial the device was opened by after the device is gone from sysfs.
+func usbSerials(sysRoot string) map[string]string {
+	var serials = map[string]string{}
+	devices, _ := filepath.Glob(filepath.Join(sysRoot, "bus", "usb", "devices", "*"))
+	for _, device := range devices {
+		path, err := filepath.EvalSymlinks(device)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(path, "idVendor")); err != nil {
+			continue
+		}
+		serials[strings.TrimPrefix(path, sysRoot)] = readSysString(path, "serial")
+	}
+	return serials
+}
+
+// HandleHotplug tears down the controller of a removed device at once, and reports whether an added device belongs
+// to one of the catalogs and calls for a scan. Plugging a device in again clears its restart history.
+func (c *Context) HandleHotplug(event HotplugEvent, catalogs []IDriverCatalog) bool {
+	switch event.Action {
+	case HotplugRemove:
+		if event.Serial == "" {
+			return false
+		}
+		c.controllersMtx.Lock()
+		ct, found := c.controllers[event.Serial]
+		c.controllersMtx.Unlock()
+		if found {
+			ct.Close()
+			c.Unregister(ct)
+		}
+	case HotplugAdd:
+		if event.Serial != "" {
+			c.supervisor.Forget(event.Serial)
+		}
+		for _, catalog := range catalogs {
+			for _, pidVid := range catalog.PidVids() {
+				if pidVid == event.PidVid {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
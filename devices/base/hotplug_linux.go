@@ -0,0 +1,100 @@
+package base
+
+import (
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// netlinkKernelGroup carries uevents straight from the kernel, ahead of udev rules.
+	netlinkKernelGroup = 1
+	netlinkBufferSize  = 64 * 1024
+	netlinkPollTimeout = 500
+	HotplugEventBuffer = 16
+)
+
+// NetlinkHotplug listens to kernel uevents for USB devices. Serials are read from sysfs as devices arrive and
+// remembered for their removal.
+type NetlinkHotplug struct {
+	fd      int
+	sysRoot string
+	serials map[string]string
+	events  chan HotplugEvent
+	quit    chan struct{}
+	waiter  sync.WaitGroup
+}
+
+func NewNetlinkHotplug(sysRoot string) (*NetlinkHotplug, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: netlinkKernelGroup}); err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+	nh := &NetlinkHotplug{fd: fd, sysRoot: sysRoot, serials: usbSerials(sysRoot),
+		events: make(chan HotplugEvent, HotplugEventBuffer), quit: make(chan struct{})}
+	nh.waiter.Add(1)
+	go nh.readLoop()
+	return nh, nil
+}
+
+func (nh *NetlinkHotplug) Events() <-chan HotplugEvent {
+	return nh.events
+}
+
+func (nh *NetlinkHotplug) Close() error {
+	close(nh.quit)
+	nh.waiter.Wait()
+	return unix.Close(nh.fd)
+}
+
+// readLoop polls the socket so it can notice being closed.
+func (nh *NetlinkHotplug) readLoop() {
+	defer nh.waiter.Done()
+	defer close(nh.events)
+	var buf = make([]byte, netlinkBufferSize)
+	var fds = []unix.PollFd{{Fd: int32(nh.fd), Events: unix.POLLIN}}
+	for {
+		select {
+		case <-nh.quit:
+			return
+		default:
+		}
+		if ready, err := unix.Poll(fds, netlinkPollTimeout); err == unix.EINTR || ready == 0 {
+			continue
+		} else if err != nil {
+			log.WithError(err).Error("Hot-plug poll error")
+			return
+		}
+		read, err := unix.Read(nh.fd, buf)
+		if err != nil {
+			log.WithError(err).Error("Hot-plug read error")
+			return
+		}
+		event, ok := ParseUevent(buf[:read])
+		if !ok {
+			continue
+		}
+		nh.attachSerial(event)
+		select {
+		case nh.events <- *event:
+		case <-nh.quit:
+			return
+		}
+	}
+}
+
+func (nh *NetlinkHotplug) attachSerial(event *HotplugEvent) {
+	switch event.Action {
+	case HotplugAdd:
+		event.Serial = readSysString(filepath.Join(nh.sysRoot, event.DevPath), "serial")
+		nh.serials[event.DevPath] = event.Serial
+	case HotplugRemove:
+		event.Serial = nh.serials[event.DevPath]
+		delete(nh.serials, event.DevPath)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package base
+
+import "errors"
+
+var ErrHotplugUnsupported = errors.New("hot-plug events are only supported on linux")
+
+// NetlinkHotplug is only implemented on linux, leaving other systems to periodic scans.
+type NetlinkHotplug struct {
+	HotplugSource
+}
+
+func NewNetlinkHotplug(string) (*NetlinkHotplug, error) {
+	return nil, ErrHotplugUnsupported
+}
@@ -0,0 +1,124 @@
+package base
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testHotplug struct {
+	events chan HotplugEvent
+}
+
+func (th *testHotplug) Events() <-chan HotplugEvent {
+	return th.events
+}
+
+func (th *testHotplug) Close() error {
+	close(th.events)
+	return nil
+}
+
+type testCatalog struct {
+	IDriverCatalog
+	pidVids []PidVid
+}
+
+func (tc *testCatalog) PidVids() []PidVid {
+	return tc.pidVids
+}
+
+type testController struct {
+	IController
+	serial string
+	closed bool
+}
+
+func (tc *testController) String() string {
+	return tc.serial
+}
+
+func (tc *testController) Alias() string {
+	return "alias-" + tc.serial
+}
+
+func (tc *testController) Close() {
+	tc.closed = true
+}
+
+func uevent(fields ...string) []byte {
+	return []byte(strings.Join(fields, "\x00"))
+}
+
+func TestParseUevent(t *testing.T) {
+	event, ok := ParseUevent(uevent("add@/devices/usb1/1-1", "ACTION=add", "DEVPATH=/devices/usb1/1-1",
+		"SUBSYSTEM=usb", "DEVTYPE=usb_device", "PRODUCT=403/6015/1000", "SEQNUM=1234"))
+	if !ok {
+		t.Fatal("usb device not parsed")
+	}
+	if event.Action != HotplugAdd || event.DevPath != "/devices/usb1/1-1" ||
+		event.PidVid != (PidVid{Product: 0x6015, Vendor: 0x0403}) {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if _, ok := ParseUevent(uevent("add@/devices/usb1/1-1/1-1:1.0", "ACTION=add", "SUBSYSTEM=usb",
+		"DEVTYPE=usb_interface", "PRODUCT=403/6015/1000")); ok {
+		t.Fatal("usb interface parsed")
+	}
+	if _, ok := ParseUevent(uevent("bind@/devices/usb1/1-1", "ACTION=bind", "SUBSYSTEM=usb",
+		"DEVTYPE=usb_device", "PRODUCT=403/6015/1000")); ok {
+		t.Fatal("bind parsed")
+	}
+	if _, ok := ParseUevent(uevent("add@/devices/usb1/1-1", "ACTION=add", "SUBSYSTEM=usb",
+		"DEVTYPE=usb_device")); ok {
+		t.Fatal("event without product parsed")
+	}
+}
+
+func TestUSBSerials(t *testing.T) {
+	sysRoot, err := ioutil.TempDir("", "sys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sysRoot)
+	writeSysTree(t, sysRoot, map[string]string{
+		"devices/usb1/1-1/idVendor":                 "0403\n",
+		"devices/usb1/1-1/serial":                   "FT123\n",
+		"devices/usb1/1-1/1-1:1.0/bInterfaceNumber": "00\n",
+	}, map[string]string{
+		"bus/usb/devices/1-1":     "devices/usb1/1-1",
+		"bus/usb/devices/1-1:1.0": "devices/usb1/1-1/1-1:1.0",
+	})
+	serials := usbSerials(sysRoot)
+	if len(serials) != 1 || serials["/devices/usb1/1-1"] != "FT123" {
+		t.Fatalf("unexpected serials %v", serials)
+	}
+}
+
+func TestContext_HandleHotplug(t *testing.T) {
+	var gekko = PidVid{Product: 0x6015, Vendor: 0x0403}
+	var catalogs = []IDriverCatalog{&testCatalog{pidVids: []PidVid{gekko}}}
+	var controller = &testController{serial: "FT123"}
+	var context = &Context{controllers: map[string]IController{controller.serial: controller}, supervisor: &Supervisor{}}
+	context.supervisor.Restarted(&testController{serial: "FT456"}, ErrReadTimeout, time.Now())
+	var source = &testHotplug{events: make(chan HotplugEvent, 4)}
+	source.events <- HotplugEvent{Action: HotplugAdd, PidVid: PidVid{Product: 0x7523, Vendor: 0x1a86}}
+	source.events <- HotplugEvent{Action: HotplugAdd, PidVid: gekko, Serial: "FT456"}
+	source.events <- HotplugEvent{Action: HotplugRemove, PidVid: gekko}
+	source.events <- HotplugEvent{Action: HotplugRemove, PidVid: gekko, Serial: "FT123"}
+	_ = source.Close()
+	var scans []bool
+	for event := range source.Events() {
+		scans = append(scans, context.HandleHotplug(event, catalogs))
+	}
+	if len(scans) != 4 || scans[0] || !scans[1] || scans[2] || scans[3] {
+		t.Fatalf("unexpected scans %v", scans)
+	}
+	if !controller.closed || context.InUse("FT123") {
+		t.Fatal("removed controller not torn down")
+	}
+	if !context.RestartAllowed("FT456") {
+		t.Fatal("added device still held off")
+	}
+}
@@ -0,0 +1,153 @@
+package base
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"sync"
+	"time"
+)
+
+// DuplicateWindow is how many recent nonces are remembered to catch a chip reporting one twice.
+const DuplicateWindow = 4096
+
+type NonceOutcome int
+
+const (
+	NonceValid NonceOutcome = iota
+	NonceHWError
+	NonceDuplicate
+)
+
+// NonceCounts tallies verified nonces. A hardware error is a nonce whose header misses difficulty 1.
+type NonceCounts struct {
+	Valid      uint64 `json:"valid"`
+	HWErrors   uint64 `json:"hwErrors"`
+	Duplicates uint64 `json:"duplicates"`
+}
+
+func (nc *NonceCounts) add(outcome NonceOutcome) {
+	switch outcome {
+	case NonceValid:
+		nc.Valid += 1
+	case NonceHWError:
+		nc.HWErrors += 1
+	case NonceDuplicate:
+		nc.Duplicates += 1
+	}
+}
+
+// ChipStats are the counts of the nonces attributed to a chip, along with valid nonces by core where the chip
+// reports it.
+type ChipStats struct {
+	NonceCounts
+	Chip  int            `json:"chip"`
+	Cores map[int]uint64 `json:"cores,omitempty"`
+}
+
+// DeviceStats is a snapshot of the nonce counts of a device and its chips. Devices running a partial chain are
+// Degraded, with ChipCount below TargetChips.
+type DeviceStats struct {
+	NonceCounts
+	Serial      string       `json:"serial"`
+	Alias       string       `json:"alias"`
+	Pool        string       `json:"pool,omitempty"`
+	Driver      string       `json:"driver"`
+	ChipCount   int          `json:"chipCount"`
+	TargetChips int          `json:"targetChips"`
+	Degraded    bool         `json:"degraded,omitempty"`
+	HashRates   HashRates    `json:"hashRates"`
+	Chips       []*ChipStats `json:"chips,omitempty"`
+}
+
+type nonceKey struct {
+	workId  uint64
+	version utils.Version
+	ntime   utils.NTime
+	nonce   utils.Nonce32
+}
+
+// NonceStats counts the nonces of a device by outcome, chip and core, and remembers the last DuplicateWindow nonces
+// to detect duplicates. Nonces not attributed to a chip count for the device alone.
+type NonceStats struct {
+	counts NonceCounts
+	chips  []*ChipStats
+	seen   map[nonceKey]struct{}
+	recent [DuplicateWindow]nonceKey
+	next   int
+	mtx    sync.Mutex
+}
+
+func NewNonceStats() *NonceStats {
+	return &NonceStats{seen: map[nonceKey]struct{}{}}
+}
+
+// Seen reports whether a result repeats a nonce found for the same header, remembering it otherwise.
+func (ns *NonceStats) Seen(tr *TaskResult) bool {
+	ns.mtx.Lock()
+	defer ns.mtx.Unlock()
+	var key = nonceKey{workId: tr.WorkId, version: tr.Version, ntime: tr.NTime, nonce: tr.Nonce}
+	if _, found := ns.seen[key]; found {
+		return true
+	}
+	delete(ns.seen, ns.recent[ns.next])
+	ns.recent[ns.next] = key
+	ns.next = (ns.next + 1) % DuplicateWindow
+	ns.seen[key] = struct{}{}
+	return false
+}
+
+// Record counts a nonce for the device and, when chip is not negative, for the chip. Valid nonces are counted by
+// core when core is not negative.
+func (ns *NonceStats) Record(chip, core int, outcome NonceOutcome) {
+	ns.mtx.Lock()
+	defer ns.mtx.Unlock()
+	ns.counts.add(outcome)
+	if chip < 0 {
+		return
+	}
+	for len(ns.chips) <= chip {
+		ns.chips = append(ns.chips, &ChipStats{Chip: len(ns.chips)})
+	}
+	var chipStats = ns.chips[chip]
+	chipStats.add(outcome)
+	if core >= 0 && outcome == NonceValid {
+		if chipStats.Cores == nil {
+			chipStats.Cores = map[int]uint64{}
+		}
+		chipStats.Cores[core] += 1
+	}
+}
+
+func (ns *NonceStats) Snapshot(serial, driver string) *DeviceStats {
+	ns.mtx.Lock()
+	defer ns.mtx.Unlock()
+	var ds = &DeviceStats{NonceCounts: ns.counts, Serial: serial, Driver: driver,
+		Chips: make([]*ChipStats, len(ns.chips))}
+	for i, chipStats := range ns.chips {
+		var copied = *chipStats
+		if chipStats.Cores != nil {
+			copied.Cores = make(map[int]uint64, len(chipStats.Cores))
+			for core, count := range chipStats.Cores {
+				copied.Cores[core] = count
+			}
+		}
+		ds.Chips[i] = &copied
+	}
+	return ds
+}
+
+// VerifyResult checks a result for duplicates before verifying it, counting the outcome for the chip and core it
+// was attributed to and metering valid nonces.
+func VerifyResult(controller IController, tr *TaskResult) NonceOutcome {
+	var stats = controller.NonceStats()
+	var outcome = NonceDuplicate
+	if !stats.Seen(tr) {
+		if tr.Verify(controller.Alias()) {
+			outcome = NonceValid
+			controller.HashMeter().Record(time.Now())
+		} else {
+			outcome = NonceHWError
+		}
+	}
+	stats.Record(tr.Chip, tr.Core, outcome)
+	return outcome
+}
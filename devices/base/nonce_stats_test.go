@@ -0,0 +1,73 @@
+package base
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/node"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"math/big"
+	"testing"
+)
+
+func TestNonceStats_Seen(t *testing.T) {
+	var ns = NewNonceStats()
+	var tr = &TaskResult{WorkId: 1, Version: 0x20000000, NTime: 1, Nonce: 1}
+	if ns.Seen(tr) || !ns.Seen(tr) {
+		t.Fatal("duplicate not detected")
+	}
+	tr.Version = 0x20002000
+	if ns.Seen(tr) {
+		t.Fatal("rolled version taken for a duplicate")
+	}
+	// the oldest nonces are forgotten past the window
+	for i := 0; i < DuplicateWindow; i++ {
+		ns.Seen(&TaskResult{WorkId: 2, Nonce: utils.Nonce32(i)})
+	}
+	if ns.Seen(tr) || len(ns.seen) != DuplicateWindow {
+		t.Fatalf("remembering %d nonces", len(ns.seen))
+	}
+}
+
+func TestNonceStats_Snapshot(t *testing.T) {
+	var ns = NewNonceStats()
+	ns.Record(2, 5, NonceValid)
+	ns.Record(2, 5, NonceValid)
+	ns.Record(2, 6, NonceHWError)
+	ns.Record(0, -1, NonceDuplicate)
+	ns.Record(-1, -1, NonceValid)
+	var ds = ns.Snapshot("serial", "driver")
+	if ds.Valid != 3 || ds.HWErrors != 1 || ds.Duplicates != 1 || len(ds.Chips) != 3 {
+		t.Fatalf("unexpected device stats %+v", ds)
+	}
+	if c := ds.Chips[2]; c.Chip != 2 || c.Valid != 2 || c.HWErrors != 1 || len(c.Cores) != 1 || c.Cores[5] != 2 {
+		t.Fatalf("unexpected chip stats %+v", c)
+	}
+	if c := ds.Chips[0]; c.Duplicates != 1 || c.Cores != nil {
+		t.Fatalf("unexpected chip stats %+v", c)
+	}
+	ds.Chips[2].Cores[5] = 0
+	if ns.Snapshot("serial", "driver").Chips[2].Cores[5] != 2 {
+		t.Fatal("snapshot shares core counts")
+	}
+}
+
+func TestVerifyResult(t *testing.T) {
+	var controller = NewController(nil, nil, nil, "serial")
+	var everything = new(big.Int).Lsh(big.NewInt(1), 256)
+	var work = &node.Work{BigDifficulty: everything, BigTargetDifficulty: big.NewInt(0)}
+	var tr = &TaskResult{Work: work, WorkId: 1, Nonce: 1, Chip: 1, Core: -1}
+	if outcome := VerifyResult(controller, tr); outcome != NonceValid {
+		t.Fatalf("outcome %d", outcome)
+	}
+	if outcome := VerifyResult(controller, tr); outcome != NonceDuplicate {
+		t.Fatalf("outcome %d", outcome)
+	}
+	// a header missing difficulty 1 is a hardware error
+	tr.Work = &node.Work{BigDifficulty: big.NewInt(0), BigTargetDifficulty: big.NewInt(0)}
+	tr.Nonce = 2
+	if outcome := VerifyResult(controller, tr); outcome != NonceHWError {
+		t.Fatalf("outcome %d", outcome)
+	}
+	var ds = controller.NonceStats().Snapshot("serial", "")
+	if ds.Valid != 1 || ds.Duplicates != 1 || ds.HWErrors != 1 || ds.Chips[1].Valid != 1 {
+		t.Fatalf("unexpected stats %+v", ds)
+	}
+}
@@ -0,0 +1,71 @@
+package base
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	ResetBackoff    = 30 * time.Second
+	MaxResetBackoff = 30 * time.Minute
+)
+
+type resetAttempts struct {
+	failures int
+	until    time.Time
+}
+
+// ResetBackoffs keeps devices whose reset failed from being opened again straight away, doubling the wait after each
+// consecutive failure so a device that keeps failing is not reset in a loop.
+type ResetBackoffs struct {
+	Initial  time.Duration
+	Max      time.Duration
+	attempts map[string]*resetAttempts
+	mtx      sync.Mutex
+}
+
+// Allowed reports whether a serial may be reset by now.
+func (rb *ResetBackoffs) Allowed(serial string, now time.Time) bool {
+	rb.mtx.Lock()
+	defer rb.mtx.Unlock()
+	attempts, found := rb.attempts[serial]
+	return !found || !now.Before(attempts.until)
+}
+
+// Failed records a failed reset and returns how long the serial is held off for.
+func (rb *ResetBackoffs) Failed(serial string, now time.Time) time.Duration {
+	rb.mtx.Lock()
+	defer rb.mtx.Unlock()
+	if rb.attempts == nil {
+		rb.attempts = map[string]*resetAttempts{}
+	}
+	attempts, found := rb.attempts[serial]
+	if !found {
+		attempts = &resetAttempts{}
+		rb.attempts[serial] = attempts
+	}
+	var initial, max = rb.Initial, rb.Max
+	if initial <= 0 {
+		initial = ResetBackoff
+	}
+	if max <= 0 {
+		max = MaxResetBackoff
+	}
+	var wait = initial
+	for i := 0; i < attempts.failures && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+	attempts.failures++
+	attempts.until = now.Add(wait)
+	return wait
+}
+
+// Succeeded forgets the failures of a serial.
+func (rb *ResetBackoffs) Succeeded(serial string) {
+	rb.mtx.Lock()
+	defer rb.mtx.Unlock()
+	delete(rb.attempts, serial)
+}
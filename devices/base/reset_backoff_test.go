@@ -0,0 +1,29 @@
+package base
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResetBackoffs(t *testing.T) {
+	var rb = &ResetBackoffs{Initial: time.Second, Max: 5 * time.Second}
+	var now = time.Now()
+	if !rb.Allowed("FT1", now) {
+		t.Fatal("unknown serial held off")
+	}
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second} {
+		if wait := rb.Failed("FT1", now); wait != expected {
+			t.Fatalf("waiting %s instead of %s", wait, expected)
+		}
+	}
+	if rb.Allowed("FT1", now.Add(4*time.Second)) || !rb.Allowed("FT1", now.Add(5*time.Second)) {
+		t.Fatal("unexpected backoff")
+	}
+	if !rb.Allowed("FT2", now) {
+		t.Fatal("other serial held off")
+	}
+	rb.Succeeded("FT1")
+	if !rb.Allowed("FT1", now) || rb.Failed("FT1", now) != time.Second {
+		t.Fatal("failures not forgotten")
+	}
+}
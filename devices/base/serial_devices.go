@@ -0,0 +1,82 @@
+package base
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	SysRoot = "/sys"
+	DevRoot = "/dev"
+)
+
+// SerialDevice is a tty backed by a USB device, described by the USB device attributes.
+type SerialDevice struct {
+	Path         string
+	PidVid       PidVid
+	Serial       string
+	Manufacturer string
+	Product      string
+}
+
+// FindSerialDevices lists the ttys under sysRoot whose USB device matches pidVid, with paths under devRoot. Each tty
+// is traced back through its device link to the first parent carrying USB ids, as the link points at the interface
+// or at a child of it depending on the driver.
+func FindSerialDevices(sysRoot, devRoot string, pidVid PidVid) ([]*SerialDevice, error) {
+	ttys, err := ioutil.ReadDir(filepath.Join(sysRoot, "class", "tty"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var devices []*SerialDevice
+	for _, tty := range ttys {
+		devicePath, err := filepath.EvalSymlinks(filepath.Join(sysRoot, "class", "tty", tty.Name(), "device"))
+		if err != nil {
+			continue
+		}
+		usbPath := findUSBDevice(devicePath, sysRoot)
+		if usbPath == "" {
+			continue
+		}
+		found := &SerialDevice{
+			Path:         filepath.Join(devRoot, tty.Name()),
+			PidVid:       PidVid{Product: readSysHex(usbPath, "idProduct"), Vendor: readSysHex(usbPath, "idVendor")},
+			Serial:       readSysString(usbPath, "serial"),
+			Manufacturer: readSysString(usbPath, "manufacturer"),
+			Product:      readSysString(usbPath, "product"),
+		}
+		if found.PidVid == pidVid {
+			devices = append(devices, found)
+		}
+	}
+	return devices, nil
+}
+
+func findUSBDevice(devicePath, sysRoot string) string {
+	for path := devicePath; len(path) > len(sysRoot); path = filepath.Dir(path) {
+		if _, err := os.Stat(filepath.Join(path, "idVendor")); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+func readSysString(path, attribute string) string {
+	data, err := ioutil.ReadFile(filepath.Join(path, attribute))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func readSysHex(path, attribute string) int {
+	value, err := strconv.ParseInt(readSysString(path, attribute), 16, 32)
+	if err != nil {
+		return -1
+	}
+	return int(value)
+}
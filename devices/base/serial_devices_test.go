@@ -0,0 +1,68 @@
+package base
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeSysTree(t *testing.T, sysRoot string, files map[string]string, links map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(sysRoot, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, target := range links {
+		path := filepath.Join(sysRoot, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join(sysRoot, target), path); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFindSerialDevices(t *testing.T) {
+	sysRoot, err := ioutil.TempDir("", "sys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sysRoot)
+	writeSysTree(t, sysRoot, map[string]string{
+		"devices/usb1/1-1/idVendor":             "10c4\n",
+		"devices/usb1/1-1/idProduct":            "ea60\n",
+		"devices/usb1/1-1/serial":               "0123\n",
+		"devices/usb1/1-1/manufacturer":         "Silicon Labs\n",
+		"devices/usb1/1-1/product":              "Bitaxe Ultra\n",
+		"devices/usb1/1-1/1-1:1.0/ttyUSB0/dev":  "188:0\n",
+		"devices/usb1/1-2/idVendor":             "1a86\n",
+		"devices/usb1/1-2/idProduct":            "7523\n",
+		"devices/usb1/1-2/1-2:1.0/ttyUSB1/dev":  "188:1\n",
+		"devices/platform/serial8250/tty/ttyS0": "",
+	}, map[string]string{
+		"class/tty/ttyUSB0/device": "devices/usb1/1-1/1-1:1.0/ttyUSB0",
+		"class/tty/ttyUSB1/device": "devices/usb1/1-2/1-2:1.0/ttyUSB1",
+		"class/tty/ttyS0/device":   "devices/platform/serial8250",
+	})
+	devices, err := FindSerialDevices(sysRoot, "/dev", PidVid{Product: 0xea60, Vendor: 0x10c4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 {
+		t.Fatalf("found %d devices", len(devices))
+	}
+	if d := devices[0]; d.Path != "/dev/ttyUSB0" || d.Serial != "0123" || d.Manufacturer != "Silicon Labs" ||
+		d.Product != "Bitaxe Ultra" {
+		t.Fatalf("unexpected device %+v", d)
+	}
+	if devices, err := FindSerialDevices(filepath.Join(sysRoot, "missing"), "/dev", PidVid{}); err != nil ||
+		len(devices) != 0 {
+		t.Fatalf("found %v: %v", devices, err)
+	}
+}
@@ -0,0 +1,56 @@
+package base
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/config"
+)
+
+// ISerialDriver is a driver for devices behind a USB serial bridge. Bridges such as the CP210x report the USB ids of
+// the bridge vendor rather than the board, so a device is only claimed once its product string or the devices section
+// names the driver.
+type ISerialDriver interface {
+	IDriver
+	// MatchesProduct reports whether a product string names this driver, telling apart boards that share a bridge.
+	MatchesProduct(product string) bool
+}
+
+// SerialDriver finds boards by the USB ids of their serial bridge. ProductName, when set, claims those whose bridge
+// was programmed with the board name; the rest must be assigned the driver by serial in the devices section.
+type SerialDriver struct {
+	PidVid
+	Name        string
+	ProductName string
+}
+
+func NewSerialDriver(product, vendor int, name, productName string) *SerialDriver {
+	return &SerialDriver{
+		PidVid:      PidVid{Product: product, Vendor: vendor},
+		Name:        name,
+		ProductName: productName,
+	}
+}
+
+func (d *SerialDriver) GetPidVid() PidVid {
+	return d.PidVid
+}
+
+func (d *SerialDriver) MatchesProduct(product string) bool {
+	return d.ProductName != "" && d.ProductName == product
+}
+
+func (d *SerialDriver) String() string {
+	return d.Name
+}
+
+func (d *SerialDriver) Equals(driver IDriver) bool {
+	return d.String() == driver.String()
+}
+
+func (d *SerialDriver) NewController(
+	cfg *config.Config,
+	context *Context,
+	driver IDriver,
+	transport Transport,
+	serialNumber string,
+) IController {
+	return newDeviceController(cfg, context, driver, transport, serialNumber)
+}
@@ -0,0 +1,106 @@
+package base
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// SerialDriverCatalog finds its devices among the USB serial ports of the system, the way DriverCatalog does among
+// FTDI devices. Open opens the tty of a found device.
+type SerialDriverCatalog struct {
+	Name    string
+	Drivers map[PidVid][]ISerialDriver
+	SysRoot string
+	DevRoot string
+	Open    func(path string) (Transport, error)
+}
+
+func NewSerialDriverCatalog(name string, driver ...ISerialDriver) *SerialDriverCatalog {
+	dc := &SerialDriverCatalog{Name: name, Drivers: map[PidVid][]ISerialDriver{}, SysRoot: SysRoot, DevRoot: DevRoot,
+		Open: openSerialTransport}
+	for _, d := range driver {
+		pidVid := d.GetPidVid()
+		dc.Drivers[pidVid] = append(dc.Drivers[pidVid], d)
+	}
+	return dc
+}
+
+func openSerialTransport(path string) (Transport, error) {
+	transport, err := OpenSerialTransport(path)
+	if err != nil {
+		return nil, err
+	}
+	return transport, nil
+}
+
+func (dc *SerialDriverCatalog) FindControllers(config *config.Config, context *Context) ([]IController, error) {
+	var controllers []IController
+	for pidVid, drivers := range dc.Drivers {
+		devices, err := FindSerialDevices(dc.SysRoot, dc.DevRoot, pidVid)
+		if err != nil {
+			return nil, err
+		}
+		for _, dev := range devices {
+			if context.InUse(dev.Serial) || !config.DeviceEnabled(dev.Serial) || !context.RestartAllowed(dev.Serial) {
+				continue
+			}
+			drv := selectSerialDriver(config, dev, drivers)
+			if drv == nil {
+				continue
+			}
+			transport, err := dc.Open(dev.Path)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"serial": dev.Serial,
+					"path":   dev.Path,
+					"error":  err.Error(),
+				}).Warnln("Error opening serial device")
+				continue
+			}
+			ctrl := drv.NewController(config, context, drv, transport, dev.Serial)
+			context.Register(ctrl)
+			controllers = append(controllers, ctrl)
+		}
+	}
+	return controllers, nil
+}
+
+// selectSerialDriver picks the driver of a device among those sharing its USB ids: the one the devices section
+// names for its serial, else the one its product string names. Generic bridges such as the CP210x also back GPS
+// units, radio sticks and consoles, so a device named by neither is left alone rather than reset and sent frames.
+func selectSerialDriver(cfg *config.Config, dev *SerialDevice, drivers []ISerialDriver) ISerialDriver {
+	if name := cfg.Device(dev.Serial, config.Device{}).Driver; name != "" {
+		for _, drv := range drivers {
+			if drv.String() == name {
+				return drv
+			}
+		}
+		log.WithFields(log.Fields{
+			"serial": dev.Serial,
+			"driver": name,
+		}).Warnln("Configured driver does not match the device")
+		return nil
+	}
+	for _, drv := range drivers {
+		if drv.MatchesProduct(dev.Product) {
+			return drv
+		}
+	}
+	log.WithFields(log.Fields{
+		"serial":  dev.Serial,
+		"product": dev.Product,
+	}).Debugln("Serial device not claimed by any driver")
+	return nil
+}
+
+func (dc *SerialDriverCatalog) String() string {
+	return dc.Name
+}
+
+func (dc *SerialDriverCatalog) PidVids() []PidVid {
+	var pidVids []PidVid
+	for pidVid := range dc.Drivers {
+		pidVids = append(pidVids, pidVid)
+	}
+	return pidVids
+}
@@ -0,0 +1,140 @@
+package base
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+)
+
+const SerialChunkSize = 4096
+
+var serialBaudRates = map[int]uint32{
+	9600:    unix.B9600,
+	19200:   unix.B19200,
+	38400:   unix.B38400,
+	57600:   unix.B57600,
+	115200:  unix.B115200,
+	230400:  unix.B230400,
+	460800:  unix.B460800,
+	921600:  unix.B921600,
+	1000000: unix.B1000000,
+	1500000: unix.B1500000,
+	2000000: unix.B2000000,
+	3000000: unix.B3000000,
+}
+
+// SerialTransport drives a chain through a tty, such as the ACM or USB serial bridges of Bitaxe-class boards. Reads
+// return whatever arrived without waiting, like an FTDI read with its latency timer expired.
+type SerialTransport struct {
+	path string
+	fd   int
+}
+
+func OpenSerialTransport(path string) (*SerialTransport, error) {
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	st := &SerialTransport{path: path, fd: fd}
+	if err := st.Reset(); err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+	return st, nil
+}
+
+func (st *SerialTransport) Read(data []byte) (int, error) {
+	n, err := unix.Read(st.fd, data)
+	if err == unix.EAGAIN || err == unix.EINTR {
+		return 0, nil
+	}
+	return n, err
+}
+
+func (st *SerialTransport) Write(data []byte) (int, error) {
+	var written int
+	for written < len(data) {
+		n, err := unix.Write(st.fd, data[written:])
+		if err == unix.EINTR {
+			continue
+		} else if err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+func (st *SerialTransport) Close() error {
+	return unix.Close(st.fd)
+}
+
+// Reset puts the tty in raw mode with reads that never block.
+func (st *SerialTransport) Reset() error {
+	termios, err := unix.IoctlGetTermios(st.fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL |
+		unix.IXON | unix.IXOFF | unix.IXANY
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB | unix.CSTOPB | unix.CRTSCTS
+	termios.Cflag |= unix.CS8 | unix.CREAD | unix.CLOCAL
+	termios.Cc[unix.VMIN] = 0
+	termios.Cc[unix.VTIME] = 0
+	return unix.IoctlSetTermios(st.fd, unix.TCSETS, termios)
+}
+
+func (st *SerialTransport) SetBaudRate(baudRate int) error {
+	speed, found := serialBaudRates[baudRate]
+	if !found {
+		return fmt.Errorf("%s: unsupported baud rate %d", st.path, baudRate)
+	}
+	termios, err := unix.IoctlGetTermios(st.fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+	termios.Cflag &^= unix.CBAUD
+	termios.Cflag |= speed
+	termios.Ispeed = speed
+	termios.Ospeed = speed
+	return unix.IoctlSetTermios(st.fd, unix.TCSETS, termios)
+}
+
+func (st *SerialTransport) Purge() error {
+	return unix.IoctlSetInt(st.fd, unix.TCFLSH, unix.TCIOFLUSH)
+}
+
+// SetLatencyTimer does nothing, ttys hand over data as it arrives.
+func (st *SerialTransport) SetLatencyTimer(int) error {
+	return nil
+}
+
+// SetGPIO drives DTR and RTS, the only lines a serial bridge has to spare, from bits 0 and 1.
+func (st *SerialTransport) SetGPIO(outputs, levels byte) error {
+	var lines = []struct {
+		bit  byte
+		line int
+	}{{0x1, unix.TIOCM_DTR}, {0x2, unix.TIOCM_RTS}}
+	for _, l := range lines {
+		if outputs&l.bit == 0 {
+			continue
+		}
+		var request uint = unix.TIOCMBIC
+		if levels&l.bit != 0 {
+			request = unix.TIOCMBIS
+		}
+		if err := unix.IoctlSetPointerInt(st.fd, request, l.line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (st *SerialTransport) ReadChunkSize() (int, error) {
+	return SerialChunkSize, nil
+}
+
+func (st *SerialTransport) WriteChunkSize() (int, error) {
+	return SerialChunkSize, nil
+}
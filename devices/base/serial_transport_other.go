@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package base
+
+import "errors"
+
+const SerialChunkSize = 4096
+
+var ErrSerialUnsupported = errors.New("serial devices are only supported on linux")
+
+// SerialTransport is only implemented on linux, where ttys are configured through termios.
+type SerialTransport struct {
+	Transport
+}
+
+func OpenSerialTransport(string) (*SerialTransport, error) {
+	return nil, ErrSerialUnsupported
+}
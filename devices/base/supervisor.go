@@ -0,0 +1,142 @@
+package base
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRestartBackoff    = ResetBackoff
+	DefaultMaxRestartBackoff = MaxResetBackoff
+	DefaultRestartWindow     = time.Hour
+	DefaultMaxRestarts       = 10
+	RestartHistorySize       = 32
+)
+
+type Restart struct {
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+}
+
+// RestartHistory is what the supervisor knows of a device: its restarts overall, the latest of them with their
+// reasons, when it may next be opened and whether it has failed.
+type RestartHistory struct {
+	Serial   string    `json:"serial"`
+	Alias    string    `json:"alias"`
+	Restarts int       `json:"restarts"`
+	Recent   []Restart `json:"recent"`
+	Until    time.Time `json:"until"`
+	Failed   bool      `json:"failed"`
+}
+
+func (rh *RestartHistory) clone() *RestartHistory {
+	var clone = *rh
+	clone.Recent = append([]Restart(nil), rh.Recent...)
+	return &clone
+}
+
+// Supervisor tracks device restarts by serial, holding devices off with the reset backoffs before they are opened
+// again and failing those that restart too often. It outlives the contexts of governor restarts, so devices keep their
+// history across them.
+type Supervisor struct {
+	config   config.Supervisor
+	devices  map[string]*RestartHistory
+	backoffs ResetBackoffs
+	mtx      sync.Mutex
+}
+
+func (s *Supervisor) Configure(cfg config.Supervisor) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.config = cfg
+	s.backoffs.Initial, s.backoffs.Max = cfg.Backoff, cfg.MaxBackoff
+}
+
+// settings fills in the defaults of whatever the configuration leaves unset.
+func (s *Supervisor) settings() config.Supervisor {
+	var settings = s.config
+	if settings.Backoff <= 0 {
+		settings.Backoff = DefaultRestartBackoff
+	}
+	if settings.MaxBackoff <= 0 {
+		settings.MaxBackoff = DefaultMaxRestartBackoff
+	}
+	if settings.Window <= 0 {
+		settings.Window = DefaultRestartWindow
+	}
+	if settings.MaxRestarts <= 0 {
+		settings.MaxRestarts = DefaultMaxRestarts
+	}
+	return settings
+}
+
+// Allowed reports whether a serial may be opened by now.
+func (s *Supervisor) Allowed(serial string, now time.Time) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	history, found := s.devices[serial]
+	return !found || (!history.Failed && s.backoffs.Allowed(serial, now))
+}
+
+// Restarted records a controller exiting for reason, and returns the updated history of its device.
+func (s *Supervisor) Restarted(controller IController, reason error, now time.Time) *RestartHistory {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var settings = s.settings()
+	if s.devices == nil {
+		s.devices = map[string]*RestartHistory{}
+	}
+	var serial = controller.String()
+	history, found := s.devices[serial]
+	if !found {
+		history = &RestartHistory{Serial: serial}
+		s.devices[serial] = history
+	}
+	history.Alias = controller.Alias()
+	history.Restarts++
+	history.Recent = append(history.Recent, Restart{Time: now, Reason: reason.Error()})
+	var size = RestartHistorySize
+	if settings.MaxRestarts > size {
+		size = settings.MaxRestarts
+	}
+	if len(history.Recent) > size {
+		history.Recent = history.Recent[len(history.Recent)-size:]
+	}
+	var inWindow int
+	for _, restart := range history.Recent {
+		if now.Sub(restart.Time) < settings.Window {
+			inWindow++
+		}
+	}
+	if inWindow == 1 {
+		// A device that ran a whole window without restarting backs off from the start again.
+		s.backoffs.Succeeded(serial)
+	}
+	history.Until = now.Add(s.backoffs.Failed(serial, now))
+	history.Failed = inWindow >= settings.MaxRestarts
+	return history.clone()
+}
+
+// Forget clears the history of a serial, letting a failed device be opened again.
+func (s *Supervisor) Forget(serial string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.devices, serial)
+	s.backoffs.Succeeded(serial)
+}
+
+// History returns the restart history of every device restarted so far, ordered by serial.
+func (s *Supervisor) History() []*RestartHistory {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var histories = make([]*RestartHistory, 0, len(s.devices))
+	for _, history := range s.devices {
+		histories = append(histories, history.clone())
+	}
+	sort.Slice(histories, func(i, j int) bool {
+		return histories[i].Serial < histories[j].Serial
+	})
+	return histories
+}
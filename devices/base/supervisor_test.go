@@ -0,0 +1,59 @@
+package base
+
+import (
+	"errors"
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"testing"
+	"time"
+)
+
+func TestSupervisor(t *testing.T) {
+	var supervisor = &Supervisor{}
+	supervisor.Configure(config.Supervisor{
+		Backoff: time.Second, MaxBackoff: 4 * time.Second, Window: time.Minute, MaxRestarts: 5,
+	})
+	var controller = &testController{serial: "FT1"}
+	var now = time.Now()
+	if !supervisor.Allowed("FT1", now) {
+		t.Fatal("unknown serial held off")
+	}
+	for i, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		history := supervisor.Restarted(controller, ErrReadTimeout, now.Add(time.Duration(i)*time.Second))
+		if wait := history.Until.Sub(now.Add(time.Duration(i) * time.Second)); wait != expected || history.Failed {
+			t.Fatalf("restart %d waits %s instead of %s", i, wait, expected)
+		}
+	}
+	if supervisor.Allowed("FT1", now.Add(5*time.Second)) || !supervisor.Allowed("FT1", now.Add(7*time.Second)) {
+		t.Fatal("unexpected backoff")
+	}
+	history := supervisor.Restarted(controller, errors.New("write error"), now.Add(10*time.Second))
+	if !history.Failed || history.Restarts != 5 || supervisor.Allowed("FT1", now.Add(time.Hour)) {
+		t.Fatal("device not failed after too many restarts")
+	}
+	histories := supervisor.History()
+	if len(histories) != 1 || histories[0].Alias != "alias-FT1" || len(histories[0].Recent) != 5 ||
+		histories[0].Recent[4].Reason != "write error" {
+		t.Fatalf("unexpected history %+v", histories)
+	}
+	supervisor.Forget("FT1")
+	if !supervisor.Allowed("FT1", now) || len(supervisor.History()) != 0 {
+		t.Fatal("history not forgotten")
+	}
+}
+
+func TestSupervisor_Window(t *testing.T) {
+	var supervisor = &Supervisor{}
+	var controller = &testController{serial: "FT1"}
+	var now = time.Now()
+	for i := 0; i < RestartHistorySize+DefaultMaxRestarts; i++ {
+		now = now.Add(DefaultRestartWindow/(DefaultMaxRestarts-1) + time.Second)
+		history := supervisor.Restarted(controller, ErrReadTimeout, now)
+		if history.Failed {
+			t.Fatalf("failed after %d restarts spread over the window", i+1)
+		}
+	}
+	history := supervisor.History()[0]
+	if history.Restarts != RestartHistorySize+DefaultMaxRestarts || len(history.Recent) != RestartHistorySize {
+		t.Fatalf("unexpected history %+v", history)
+	}
+}
@@ -14,6 +14,8 @@ type TaskResult struct {
 	Version     utils.Version
 	VersionPos  int32
 	Midstate    int32
+	Chip        int
+	Core        int
 	NTime       utils.NTime
 	Nonce       utils.Nonce32
 	PlainHeader [80]byte
@@ -52,25 +54,26 @@ func (tr *TaskResult) calculateHash() [32]byte {
 	return utils.DoubleHash(tr.PlainHeader[:])
 }
 
-func (tr *TaskResult) verifyDifficulty(hashBig *big.Int) (reachedMinDifficulty, reachedTargetDifficulty bool) {
+// verifyDifficulty compares the hash against the work's share target alone, so chains set to an easier target than
+// difficulty 1, such as emulated ones, can be verified too. Results below the share target are still valid when they
+// meet difficulty 1.
+func (tr *TaskResult) verifyDifficulty(hashBig *big.Int) (valid, reachedMinDifficulty, reachedTargetDifficulty bool) {
 	hash := tr.calculateHash()
-	if !(hash[31] == 0x0 && hash[30] == 0x0 && hash[29] == 0x0 && hash[28] == 0x0) {
-		return false, false
-	}
 	utils.HashToBig(hash, hashBig)
 	if hashBig.Cmp(tr.Work.BigDifficulty) > 0 {
-		return false, false
+		return hashBig.Cmp(utils.DiffOne) <= 0, false, false
 	}
 	if hashBig.Cmp(tr.Work.BigTargetDifficulty) <= 0 {
-		return true, true
+		return true, true, true
 	}
-	return true, false
+	return true, true, false
 }
 
 func (tr *TaskResult) submit() {
 	var work = tr.Work.Clone()
 	work.SetNtime(tr.NTime)
 	work.SetVersion(tr.Version)
+	work.SetNonce(tr.Nonce)
 	if submitErr := work.Submit(); submitErr != nil {
 		log.WithError(submitErr).Warn("Node submit error")
 	} else {
@@ -81,16 +84,36 @@ func (tr *TaskResult) submit() {
 	}
 }
 
-func (tr *TaskResult) Verify(serial string) {
+func (tr *TaskResult) submitAux() {
+	var work = tr.Work.Clone()
+	work.SetNtime(tr.NTime)
+	work.SetVersion(tr.Version)
+	work.SetNonce(tr.Nonce)
+	if submitErr := work.SubmitAux(); submitErr != nil {
+		log.WithError(submitErr).Warn("Aux node submit error")
+	} else {
+		log.WithFields(log.Fields{
+			"jobId":     work.WorkId,
+			"auxHeight": work.AuxBlock.Height,
+		}).Warn("AUX BLOCK MINED")
+	}
+}
+
+// Verify submits results reaching the target and reports whether the nonce met difficulty 1 at all, which tells a
+// valid nonce from a hardware error.
+func (tr *TaskResult) Verify(serial string) bool {
 	tr.mtx.Lock()
 	defer tr.mtx.Unlock()
 	var resultDiff big.Int
 	var hashBig big.Int
 	var diff utils.Difficulty
-	var reachedMinDifficulty, reachedTargetDifficulty = tr.verifyDifficulty(&hashBig)
+	var valid, reachedMinDifficulty, reachedTargetDifficulty = tr.verifyDifficulty(&hashBig)
 	if reachedTargetDifficulty {
 		tr.submit()
 	}
+	if reachedMinDifficulty && tr.Work.MeetsAuxTarget(&hashBig) {
+		tr.submitAux()
+	}
 	if reachedMinDifficulty {
 		utils.CalculateDifficulty(&hashBig, &resultDiff)
 		diff = utils.Difficulty(resultDiff.Int64())
@@ -106,6 +129,7 @@ func (tr *TaskResult) Verify(serial string) {
 			}).Infoln("Result")
 		}
 	}
+	return valid
 }
 
 func (tr *TaskResult) Lock() {
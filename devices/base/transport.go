@@ -0,0 +1,19 @@
+package base
+
+// Transport is the byte link to a chip chain together with the line controls drivers need, so a controller can run
+// over an FTDI bridge, a serial port or a simulated chain alike.
+type Transport interface {
+	Read(data []byte) (int, error)
+	Write(data []byte) (int, error)
+	Close() error
+	// Reset restores the link to 8 data bits, one stop bit, no parity and no flow control.
+	Reset() error
+	SetBaudRate(baudRate int) error
+	// Purge drops anything pending in both directions.
+	Purge() error
+	SetLatencyTimer(milliseconds int) error
+	// SetGPIO drives the pins in outputs to the matching bits of levels, leaving the others as inputs.
+	SetGPIO(outputs, levels byte) error
+	ReadChunkSize() (int, error)
+	WriteChunkSize() (int, error)
+}
@@ -0,0 +1,14 @@
+package bitaxe
+
+import "github.com/fernandosanchezjr/goasicminer/devices/base"
+
+// BitaxeCatalog finds BM1366 and BM1368 boards on the USB serial ports of the system.
+type BitaxeCatalog struct {
+	*base.SerialDriverCatalog
+}
+
+func NewBitaxeCatalog() *BitaxeCatalog {
+	return &BitaxeCatalog{
+		base.NewSerialDriverCatalog("Bitaxe", NewUltra(), NewSupra()),
+	}
+}
@@ -0,0 +1,117 @@
+package bitaxe
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"github.com/fernandosanchezjr/goasicminer/devices/base"
+	"github.com/fernandosanchezjr/goasicminer/generators"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testTransport struct {
+	path   string
+	closed bool
+}
+
+func (tt *testTransport) Read([]byte) (int, error)       { return 0, nil }
+func (tt *testTransport) Write(data []byte) (int, error) { return len(data), nil }
+func (tt *testTransport) Close() error                   { tt.closed = true; return nil }
+func (tt *testTransport) Reset() error                   { return nil }
+func (tt *testTransport) SetBaudRate(int) error          { return nil }
+func (tt *testTransport) Purge() error                   { return nil }
+func (tt *testTransport) SetLatencyTimer(int) error      { return nil }
+func (tt *testTransport) SetGPIO(byte, byte) error       { return nil }
+func (tt *testTransport) ReadChunkSize() (int, error)    { return 4096, nil }
+func (tt *testTransport) WriteChunkSize() (int, error)   { return 4096, nil }
+
+// writeUSBSerial adds a tty to a fake sysfs tree, backed by a USB device with the given ids and strings.
+func writeUSBSerial(t *testing.T, sysRoot, port, tty, vendor, product, serial, productName string) {
+	var usbPath = filepath.Join(sysRoot, "devices", "usb1", port)
+	var ttyPath = filepath.Join(usbPath, port+":1.0", tty)
+	if err := os.MkdirAll(ttyPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"idVendor":     vendor,
+		"idProduct":    product,
+		"serial":       serial,
+		"manufacturer": "Silicon Labs",
+		"product":      productName,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(usbPath, name), []byte(content+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var classPath = filepath.Join(sysRoot, "class", "tty", tty)
+	if err := os.MkdirAll(classPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(ttyPath, filepath.Join(classPath, "device")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBitaxeCatalog_FindControllers(t *testing.T) {
+	sysRoot, err := ioutil.TempDir("", "sys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sysRoot)
+	const bridge = "CP2102N USB to UART Bridge Controller"
+	writeUSBSerial(t, sysRoot, "1-1", "ttyUSB0", "10c4", "ea60", "ultra", bridge)
+	writeUSBSerial(t, sysRoot, "1-2", "ttyUSB1", "10c4", "ea60", "supra", bridge)
+	writeUSBSerial(t, sysRoot, "1-3", "ttyUSB2", "10c4", "ea60", "programmed", "Bitaxe Supra")
+	writeUSBSerial(t, sysRoot, "1-4", "ttyUSB3", "10c4", "ea60", "misnamed", bridge)
+	writeUSBSerial(t, sysRoot, "1-5", "ttyUSB4", "1a86", "7523", "other", "USB Serial")
+	writeUSBSerial(t, sysRoot, "1-6", "ttyUSB5", "10c4", "ea60", "gps", bridge)
+	writeUSBSerial(t, sysRoot, "1-7", "ttyUSB6", "10c4", "ea60", "unplugged", "Bitaxe Ultra")
+	var catalog = NewBitaxeCatalog()
+	catalog.SysRoot = sysRoot
+	var opened = map[string]*testTransport{}
+	catalog.Open = func(path string) (base.Transport, error) {
+		if path == "/dev/ttyUSB6" {
+			return nil, os.ErrNotExist
+		}
+		opened[path] = &testTransport{path: path}
+		return opened[path], nil
+	}
+	var cfg = &config.Config{Devices: []config.Device{
+		{Serial: "ultra", Driver: "Bitaxe Ultra"},
+		{Serial: "supra", Driver: "Bitaxe Supra"},
+		{Serial: "misnamed", Driver: "R606 Bitcoin Miner"},
+	}}
+	var context = base.NewContext(func() generators.Generator { return generators.NewRandom() }, &base.Supervisor{})
+	controllers, err := catalog.FindControllers(cfg, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var drivers = map[string]string{}
+	for _, ct := range controllers {
+		drivers[ct.String()] = ct.Driver().String()
+	}
+	var expected = map[string]string{"ultra": "Bitaxe Ultra", "supra": "Bitaxe Supra", "programmed": "Bitaxe Supra"}
+	if len(drivers) != len(expected) {
+		t.Fatalf("found %v", drivers)
+	}
+	for serial, driver := range expected {
+		if drivers[serial] != driver {
+			t.Fatalf("%s matched %q, expected %q", serial, drivers[serial], driver)
+		}
+	}
+	// bridges named by neither the devices section nor their product string are never opened
+	if len(opened) != len(expected) || opened["/dev/ttyUSB0"] == nil || opened["/dev/ttyUSB3"] != nil ||
+		opened["/dev/ttyUSB5"] != nil {
+		t.Fatalf("opened %v", opened)
+	}
+	if controllers, err := catalog.FindControllers(cfg, context); err != nil || len(controllers) != 0 {
+		t.Fatalf("found devices in use again: %v %v", controllers, err)
+	}
+	context.Close()
+	for path, transport := range opened {
+		if !transport.closed {
+			t.Fatalf("%s left open", path)
+		}
+	}
+}
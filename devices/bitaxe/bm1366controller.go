@@ -0,0 +1,553 @@
+package bitaxe
+
+import (
+	"fmt"
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"github.com/fernandosanchezjr/goasicminer/devices/base"
+	"github.com/fernandosanchezjr/goasicminer/devices/bitaxe/protocol"
+	gekko "github.com/fernandosanchezjr/goasicminer/devices/gekko/protocol"
+	"github.com/fernandosanchezjr/goasicminer/generators"
+	"github.com/fernandosanchezjr/goasicminer/node"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	BM1366BaudRate       = 115200
+	BM1366NumCores       = 894
+	BM1368NumCores       = 1276
+	BM1366MaxVerifyTasks = 2 * gekko.MaxTaskResponses
+	BM1366WaitFactor     = 0.5
+	// BM1366NonceDifficulty is the difficulty the 256 ticket mask has chips report nonces at.
+	BM1366NonceDifficulty = 256
+	// BM1366JobInterval paces jobs, as rolling the version on chip lets one job last far longer than a full scan.
+	BM1366JobInterval  = time.Second
+	BM1366ReadInterval = 50 * time.Millisecond
+	// BM1366CoreReset and BM1366CoreEnable are written to the core control register in turn to bring the cores up.
+	BM1366CoreReset   = 0x80008B00
+	BM1366CoreEnable  = 0x80008018
+	BM1366MiscControl = 0xFF0FC100
+	BM1366UnknownA8   = 0x00070000
+	BM1366AnalogMux   = 0x00000003
+	BM1366IODriver    = 0x02111111
+)
+
+// BM1366Controller drives a chain of BM1366 or BM1368 chips over a serial port. Jobs carry whole headers and the
+// chips roll the version on their own, so results are rebuilt from the task version and the rolled bits reported.
+type BM1366Controller struct {
+	base.IController
+	chipId           int
+	numCores         int
+	frequency        float64
+	chipCount        int
+	quit             chan struct{}
+	waiter           sync.WaitGroup
+	verifyQueue      chan *base.TaskResult
+	timeout          time.Duration
+	shuttingDown     bool
+	minFrequency     float64
+	maxFrequency     float64
+	defaultFrequency float64
+	targetChips      int
+	work             *node.Work
+	workMtx          sync.Mutex
+	lastRead         time.Time
+	readTicker       *time.Ticker
+	writeTicker      *time.Ticker
+	softStart        config.SoftStart
+	ramp             *base.FrequencyRamp
+	taskResultPool   *base.TaskResultPool
+	pendingTaskPool  *protocol.BM1366TaskPool
+}
+
+func NewBM1366Controller(
+	controller base.IController,
+	chipId int,
+	numCores int,
+	minFrequency float64,
+	maxFrequency float64,
+	defaultFrequency float64,
+	targetChips int,
+	timeout time.Duration,
+	softStart config.SoftStart,
+) *BM1366Controller {
+	return &BM1366Controller{IController: controller, chipId: chipId, numCores: numCores, quit: make(chan struct{}),
+		minFrequency: minFrequency, maxFrequency: maxFrequency, defaultFrequency: defaultFrequency,
+		targetChips: targetChips, timeout: timeout,
+		softStart:       softStart,
+		taskResultPool:  base.NewTaskResultPool(BM1366MaxVerifyTasks),
+		pendingTaskPool: protocol.NewBM1366TaskPool(),
+	}
+}
+
+func (bm *BM1366Controller) Close() {
+	bm.shuttingDown = true
+	waitForLoops := bm.quit != nil
+	if bm.quit != nil {
+		close(bm.quit)
+	}
+	if bm.verifyQueue != nil {
+		close(bm.verifyQueue)
+	}
+	if waitForLoops {
+		bm.waiter.Wait()
+		bm.quit = nil
+	}
+	bm.IController.Close()
+}
+
+func (bm *BM1366Controller) Reset() error {
+	defer bm.loopRecover("init")
+	if err := bm.performReset(); err != nil {
+		go bm.Exit()
+		return err
+	}
+	if err := bm.countChips(); err != nil {
+		go bm.Exit()
+		return err
+	}
+	if err := bm.setAddresses(); err != nil {
+		return err
+	}
+	if err := bm.initRegisters(); err != nil {
+		return err
+	}
+	// TODO: run base.FrequencyTuner once the ramp is done, as the BM1387 controller does; until then Tuning is ignored
+	// and the chips stay at their configured frequency.
+	var frequency = bm.defaultFrequency
+	if bm.softStart.Enabled {
+		bm.ramp = base.NewFrequencyRamp(bm.softStart, bm.minFrequency, bm.defaultFrequency)
+		frequency = bm.ramp.Frequency()
+	}
+	if err := bm.setFrequency(frequency); err != nil {
+		return err
+	}
+	if err := bm.setBaudRate(); err != nil {
+		return err
+	}
+	bm.setTiming()
+	bm.initializeTasks()
+	return nil
+}
+
+// performReset pulses the chain reset, which serial bridges wire to RTS.
+func (bm *BM1366Controller) performReset() error {
+	transport := bm.Transport()
+	if err := transport.Reset(); err != nil {
+		return err
+	}
+	if err := transport.SetBaudRate(BM1366BaudRate); err != nil {
+		return err
+	}
+	if err := transport.Purge(); err != nil {
+		return err
+	}
+	if err := transport.SetGPIO(0x3, 0x2); err != nil {
+		return err
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := transport.SetGPIO(0x3, 0x0); err != nil {
+		return err
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := transport.SetGPIO(0x3, 0x2); err != nil {
+		return err
+	}
+	time.Sleep(200 * time.Millisecond)
+	return nil
+}
+
+func (bm *BM1366Controller) writeCommand(command *gekko.BM1397Command) error {
+	data, _ := command.MarshalBinary()
+	_, err := bm.Write(data)
+	return err
+}
+
+// countChips enables version rolling before asking for the chip addresses, as chips answer with their id only once
+// the version mask is set.
+func (bm *BM1366Controller) countChips() error {
+	buf, err := bm.AllocateReadBuffer()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 3; i++ {
+		if err := bm.writeCommand(protocol.NewBM1366SetVersionMask(protocol.BM1366VersionRollingMask)); err != nil {
+			return err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := bm.writeCommand(gekko.NewBM1397ReadRegister(gekko.BM1397ChipAddressReg)); err != nil {
+		return err
+	}
+	time.Sleep(50 * time.Millisecond)
+	read, err := bm.Read(buf)
+	if err != nil {
+		return err
+	}
+	cr := protocol.NewBM1366ChipsResponse(bm.chipId)
+	if err := cr.UnmarshalBinary(buf[:read]); err != nil {
+		return err
+	}
+	bm.chipCount = len(cr.Chips)
+	return bm.CheckChips(bm.chipCount, bm.targetChips)
+}
+
+func (bm *BM1366Controller) chipAddress(chip int) byte {
+	return byte((0x100 / bm.chipCount) * chip)
+}
+
+func (bm *BM1366Controller) setAddresses() error {
+	for i := 0; i < 3; i++ {
+		if err := bm.writeCommand(gekko.NewBM1397ChainInactive()); err != nil {
+			return err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for i := 0; i < bm.chipCount; i++ {
+		if err := bm.writeCommand(gekko.NewBM1397SetAddress(bm.chipAddress(i))); err != nil {
+			return err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return nil
+}
+
+func (bm *BM1366Controller) initRegisters() error {
+	var registers = []struct {
+		register byte
+		value    uint32
+	}{
+		{protocol.BM1366UnknownA8Reg, BM1366UnknownA8},
+		{gekko.BM1397MiscControlReg, BM1366MiscControl},
+		{gekko.BM1397CoreControlReg, BM1366CoreReset},
+		{gekko.BM1397CoreControlReg, BM1366CoreEnable},
+		{gekko.BM1397TicketMaskReg, gekko.BM1397TicketMask256},
+		{gekko.BM1397AnalogMuxReg, BM1366AnalogMux},
+		{gekko.BM1397IODriverReg, BM1366IODriver},
+	}
+	for _, r := range registers {
+		if err := bm.writeCommand(gekko.NewBM1397WriteRegisterAll(r.register, r.value)); err != nil {
+			return err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return nil
+}
+
+// setFrequency programs PLL0 of every chip with the dividers closest to the clamped frequency.
+func (bm *BM1366Controller) setFrequency(frequency float64) error {
+	if frequency < bm.minFrequency {
+		frequency = bm.minFrequency
+	} else if frequency > bm.maxFrequency {
+		frequency = bm.maxFrequency
+	}
+	var pll = protocol.NewBM1366PLL(frequency)
+	if bm.frequency == pll.Frequency {
+		return nil
+	}
+	if err := bm.writeCommand(gekko.NewBM1397WriteRegisterAll(gekko.BM1397PLL0Reg, pll.Register())); err != nil {
+		return err
+	}
+	time.Sleep(10 * time.Millisecond)
+	bm.frequency = pll.Frequency
+	return nil
+}
+
+// setBaudRate moves the chain to its fast baud rate, leaving results enough room at any frequency.
+func (bm *BM1366Controller) setBaudRate() error {
+	if err := bm.writeCommand(gekko.NewBM1397WriteRegisterAll(protocol.BM1366FastUARTReg,
+		protocol.BM1366FastUART)); err != nil {
+		return err
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := bm.Transport().SetBaudRate(protocol.BM1366FastBaudRate); err != nil {
+		return err
+	}
+	time.Sleep(10 * time.Millisecond)
+	return bm.Transport().Purge()
+}
+
+func (bm *BM1366Controller) setTiming() {
+	hashRate, fullscanDuration, _ := gekko.Timing(bm.chipCount, bm.frequency, bm.numCores, BM1366WaitFactor)
+	bm.HashMeter().SetExpected(hashRate, BM1366NonceDifficulty)
+	log.WithFields(log.Fields{
+		"serial":       bm.Alias(),
+		"frequency":    bm.frequency,
+		"chips":        bm.chipCount,
+		"hashRate":     hashRate,
+		"fullScanTime": fullscanDuration,
+	}).Infoln("Timing set up")
+}
+
+func (bm *BM1366Controller) initializeTasks() {
+	bm.verifyQueue = make(chan *base.TaskResult, BM1366MaxVerifyTasks)
+	bm.lastRead = time.Now()
+	bm.waiter.Add(3)
+	go bm.verifyLoop()
+	go bm.readLoop()
+	go bm.writeLoop()
+}
+
+func (bm *BM1366Controller) loopRecover(loopName string) {
+	if err := recover(); err != nil {
+		if !strings.Contains(fmt.Sprint(err), "send on closed channel") &&
+			!strings.Contains(fmt.Sprint(err), "nil pointer dereference") {
+			log.WithFields(log.Fields{
+				"serial": bm.Alias(),
+				"loop":   loopName,
+				"error":  fmt.Errorf("%#v", err),
+			}).Error("Loop error")
+		}
+		bm.waiter.Done()
+		if !bm.shuttingDown {
+			bm.Fail(fmt.Errorf("%s loop: %v", loopName, err))
+		}
+	}
+}
+
+func closeTicker(ticker *time.Ticker) *time.Ticker {
+	if ticker != nil {
+		ticker.Stop()
+	}
+	return nil
+}
+
+// handlerExit ends a loop, failing the controller when err says why.
+func (bm *BM1366Controller) handlerExit(err error) {
+	bm.readTicker = closeTicker(bm.readTicker)
+	bm.writeTicker = closeTicker(bm.writeTicker)
+	bm.waiter.Done()
+	if err != nil {
+		bm.Fail(err)
+	} else {
+		bm.Exit()
+	}
+}
+
+// readLoop dispatches nonces to their job. A chain is taken for dead when it stays silent for longer than the
+// timeout while it has work.
+// setWork hands new work to the write loop, guarded as the read loop checks for it too.
+func (bm *BM1366Controller) setWork(work *node.Work) {
+	bm.workMtx.Lock()
+	defer bm.workMtx.Unlock()
+	bm.work = work
+}
+
+// hasWork reports to the read loop whether the chips were given work, as reads only time out once they were.
+func (bm *BM1366Controller) hasWork() bool {
+	bm.workMtx.Lock()
+	defer bm.workMtx.Unlock()
+	return bm.work != nil
+}
+
+func (bm *BM1366Controller) readLoop() {
+	defer bm.loopRecover("read")
+	buf, err := bm.AllocateReadBuffer()
+	if err != nil {
+		panic(err)
+	}
+	rb := protocol.NewBM1366ResponseBlock()
+	bm.readTicker = time.NewTicker(BM1366ReadInterval)
+	for {
+		select {
+		case <-bm.quit:
+			bm.handlerExit(nil)
+			return
+		case readTime := <-bm.readTicker.C:
+			if !bm.hasWork() {
+				bm.lastRead = readTime
+				continue
+			}
+			if time.Since(bm.lastRead) > bm.timeout {
+				bm.handlerExit(base.ErrReadTimeout)
+				return
+			}
+			read, err := bm.Read(buf)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"serial": bm.Alias(),
+					"error":  err.Error(),
+				}).Error("Read error")
+				bm.handlerExit(err)
+				return
+			}
+			if err := rb.UnmarshalBinary(buf[:read]); err != nil {
+				log.WithFields(log.Fields{
+					"serial": bm.Alias(),
+					"error":  err.Error(),
+				}).Error("Error decoding response block")
+				continue
+			}
+			if bm.dispatchResponseValidation(rb) {
+				bm.lastRead = readTime
+			}
+		}
+	}
+}
+
+// dispatchResponseValidation queues the results of a response block, dropping those whose rolled version the
+// template does not accept.
+func (bm *BM1366Controller) dispatchResponseValidation(rb *protocol.BM1366ResponseBlock) bool {
+	var read bool
+	for i := 0; i < rb.Count; i++ {
+		var response = rb.Responses[i]
+		var task = bm.pendingTaskPool.GetTask(response.JobId)
+		if task == nil || task.GetWorkId() == 0 {
+			continue
+		}
+		read = true
+		var nextResult = bm.taskResultPool.Next()
+		task.UpdateRolledResult(nextResult, response.Nonce, response.VersionBits)
+		nextResult.Chip, nextResult.Core = bm.singleChip(), response.Core
+		if err := nextResult.Work.CheckVersion(nextResult.Version); err != nil {
+			log.WithFields(log.Fields{
+				"serial": bm.Alias(),
+				"error":  err.Error(),
+			}).Debug("Refusing rolled version")
+			continue
+		}
+		bm.verifyQueue <- nextResult
+	}
+	return read
+}
+
+func (bm *BM1366Controller) writeLoop() {
+	defer bm.loopRecover("write")
+	var generatorChan = bm.GetGenerator()
+	var task = node.NewTask(1, false)
+	var workChan = bm.WorkChannel()
+	var versions [1]utils.Version
+	bm.writeTicker = time.NewTicker(BM1366JobInterval)
+	var rampChan <-chan time.Time
+	if bm.ramp != nil {
+		var rampTicker = time.NewTicker(base.RampPollInterval)
+		defer rampTicker.Stop()
+		rampChan = rampTicker.C
+	}
+	for {
+		select {
+		case <-bm.quit:
+			bm.handlerExit(nil)
+			return
+		case work := <-workChan:
+			bm.setWork(work)
+			continue
+		case now := <-rampChan:
+			if bm.work == nil {
+				bm.ramp.Pause()
+				continue
+			}
+			if err := bm.rampStep(now); err != nil {
+				bm.handlerExit(err)
+				return
+			}
+			if bm.ramp.Done() {
+				rampChan = nil
+			}
+		case <-bm.writeTicker.C:
+			if bm.work == nil {
+				continue
+			}
+			var generated = bm.nextAllowed(generatorChan)
+			var currentTask = bm.pendingTaskPool.Next()
+			versions[0] = utils.Version(generated.Work.Block.MsgBlock().Header.Version)
+			task.Update(generated.Work, versions[:])
+			currentTask.Update(task)
+			data, _ := currentTask.MarshalBinary()
+			if written, err := bm.Write(data); err != nil || written != len(data) {
+				if err == nil {
+					err = io.ErrShortWrite
+				}
+				log.WithFields(log.Fields{
+					"serial": bm.Alias(),
+					"error":  err.Error(),
+				}).Error("Write error")
+				bm.handlerExit(err)
+				return
+			}
+		}
+	}
+}
+
+// nextAllowed takes generated headers until one fits the template's ntime bounds. Jobs go out with the template
+// version, as the chips roll the version themselves.
+func (bm *BM1366Controller) nextAllowed(generatorChan chan *generators.Generated) *generators.Generated {
+	var versions [1]utils.Version
+	for {
+		var generated = <-generatorChan
+		if err := generated.AllowedVersions(versions[:]); err != nil {
+			log.WithFields(log.Fields{
+				"serial": bm.Alias(),
+				"error":  err.Error(),
+			}).Debug("Refusing generated header")
+			continue
+		}
+		return generated
+	}
+}
+
+// singleChip is the chip nonces are attributed to, known only when the board carries a single chip.
+func (bm *BM1366Controller) singleChip() int {
+	if bm.chipCount == 1 {
+		return 0
+	}
+	return -1
+}
+
+// applyFrequency moves the chips to a frequency. It runs on the write loop so no job goes out while the chips are
+// being clocked.
+func (bm *BM1366Controller) applyFrequency(frequency float64) error {
+	if err := bm.setFrequency(frequency); err != nil {
+		log.WithFields(log.Fields{
+			"serial": bm.Alias(),
+			"error":  err.Error(),
+		}).Error("Frequency change error")
+		return err
+	}
+	bm.setTiming()
+	return nil
+}
+
+// rampStep takes the next soft start step once the ramp allows it.
+func (bm *BM1366Controller) rampStep(now time.Time) error {
+	frequency, changed := bm.ramp.Next(now)
+	if changed {
+		if err := bm.applyFrequency(frequency); err != nil {
+			return err
+		}
+	}
+	if !bm.ramp.Done() {
+		return nil
+	}
+	var fields = log.Fields{
+		"serial":    bm.Alias(),
+		"frequency": bm.frequency,
+		"target":    bm.ramp.Target,
+	}
+	if bm.ramp.Aborted() {
+		log.WithFields(fields).Warnln("Soft start stopped short of target")
+	} else {
+		log.WithFields(fields).Infoln("Soft start finished")
+	}
+	return nil
+}
+
+func (bm *BM1366Controller) verifyLoop() {
+	defer bm.loopRecover("verify")
+	for {
+		select {
+		case <-bm.quit:
+			bm.waiter.Done()
+			return
+		case task := <-bm.verifyQueue:
+			var outcome = base.VerifyResult(bm, task)
+			if bm.ramp != nil && outcome != base.NonceDuplicate {
+				bm.ramp.Record(outcome == base.NonceValid)
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Package protocol speaks to BM1366 and BM1368 chips, which share the BM1397 command framing and PLL layout but take
+// whole headers as jobs and roll the version on chip.
+package protocol
+
+import (
+	gekko "github.com/fernandosanchezjr/goasicminer/devices/gekko/protocol"
+)
+
+// BM1366 registers besides the BM1397 ones
+const (
+	BM1366FastUARTReg    = 0x28
+	BM1366VersionMaskReg = 0xA4
+	// BM1366UnknownA8Reg is undocumented and set the way vendor firmware does.
+	BM1366UnknownA8Reg = 0xA8
+	// BM1366FastUART clocks the UART for BM1366FastBaudRate.
+	BM1366FastUART     = 0x11300200
+	BM1366FastBaudRate = 1000000
+)
+
+const (
+	bm1366TypeJob  = 0x20
+	bm1366CmdWrite = 0x01
+)
+
+const (
+	BM1366ChipId   = 0x1366
+	BM1368ChipId   = 0x1368
+	BM1366MinFBDiv = 0xa0
+	BM1366MaxFBDiv = 0xef
+	// BM1366VersionShift is where the 16 version bits a chip reports sit in the header version.
+	BM1366VersionShift = 13
+	// BM1366VersionRollingMask rolls every version bit BIP 320 leaves to miners.
+	BM1366VersionRollingMask = 0x1fffe000
+)
+
+// NewBM1366SetVersionMask lets the chips roll the version bits in mask.
+func NewBM1366SetVersionMask(mask uint32) *gekko.BM1397Command {
+	return gekko.NewBM1397WriteRegisterAll(BM1366VersionMaskReg, 0x90000000|mask>>BM1366VersionShift)
+}
+
+// NewBM1366PLL picks PLL0 dividers, the BM1366 feedback divider running over a narrower range than the BM1397 one.
+func NewBM1366PLL(frequency float64) *gekko.BM1397PLL {
+	return gekko.NewBM1397PLLWithin(frequency, BM1366MinFBDiv, BM1366MaxFBDiv)
+}
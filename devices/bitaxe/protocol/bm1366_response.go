@@ -0,0 +1,101 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	gekko "github.com/fernandosanchezjr/goasicminer/devices/gekko/protocol"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+)
+
+const (
+	BM1366ResponseSize   = 11
+	bm1366NonceResponse  = 0x80
+	bm1366JobIdMask      = 0xf0
+	bm1366MaxPendingRead = BM1366ResponseSize - 1
+)
+
+// BM1366Response is a nonce along with the job it belongs to and the version bits rolled to find it. The low bits
+// of the reported job id name the core that found it and are kept apart in Core.
+type BM1366Response struct {
+	Nonce       utils.Nonce32
+	JobId       int
+	Core        int
+	VersionBits uint16
+}
+
+// BM1366ResponseBlock decodes the responses of a read. Responses are found by their preamble, and a response cut
+// short by the end of a read is kept for the next one.
+type BM1366ResponseBlock struct {
+	Responses []*BM1366Response
+	Count     int
+	pending   []byte
+}
+
+func NewBM1366ResponseBlock() *BM1366ResponseBlock {
+	rb := &BM1366ResponseBlock{Responses: make([]*BM1366Response, gekko.MaxTaskResponses)}
+	for i := range rb.Responses {
+		rb.Responses[i] = &BM1366Response{}
+	}
+	return rb
+}
+
+func (rb *BM1366ResponseBlock) UnmarshalBinary(data []byte) error {
+	rb.Count = 0
+	data = append(rb.pending, data...)
+	rb.pending = nil
+	for len(data) >= BM1366ResponseSize && rb.Count < len(rb.Responses) {
+		var start = bytes.Index(data, gekko.BM1397ResponsePreamble)
+		if start < 0 {
+			data = data[len(data)-1:]
+			break
+		}
+		data = data[start:]
+		if len(data) < BM1366ResponseSize {
+			break
+		}
+		var response = data[:BM1366ResponseSize]
+		data = data[BM1366ResponseSize:]
+		if response[10]&bm1366NonceResponse == 0 {
+			continue
+		}
+		var current = rb.Responses[rb.Count]
+		current.Nonce = utils.Nonce32(binary.LittleEndian.Uint32(response[2:6]))
+		current.JobId = int(response[7]&bm1366JobIdMask) >> 1
+		current.Core = int(response[7] &^ bm1366JobIdMask)
+		current.VersionBits = binary.BigEndian.Uint16(response[8:10])
+		rb.Count += 1
+	}
+	if len(data) > 0 && len(data) <= bm1366MaxPendingRead {
+		rb.pending = append([]byte{}, data...)
+	}
+	return nil
+}
+
+// BM1366ChipsResponse lists the chips answering a chip address register read.
+type BM1366ChipsResponse struct {
+	ChipId int
+	Chips  []string
+}
+
+func NewBM1366ChipsResponse(chipId int) *BM1366ChipsResponse {
+	return &BM1366ChipsResponse{ChipId: chipId}
+}
+
+func (cr *BM1366ChipsResponse) UnmarshalBinary(data []byte) error {
+	if len(data)%BM1366ResponseSize != 0 {
+		return fmt.Errorf("invalid BM1366ChipsResponse length")
+	}
+	for ; len(data) > 0; data = data[BM1366ResponseSize:] {
+		var response = data[:BM1366ResponseSize]
+		if !bytes.HasPrefix(response, gekko.BM1397ResponsePreamble) {
+			return fmt.Errorf("invalid BM1366ChipsResponse preamble")
+		}
+		if chipId := int(response[2])<<8 | int(response[3]); chipId != cr.ChipId {
+			return fmt.Errorf("unexpected chip %04x", chipId)
+		}
+		cr.Chips = append(cr.Chips, hex.EncodeToString(response))
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/devices/base"
+	gekko "github.com/fernandosanchezjr/goasicminer/devices/gekko/protocol"
+	"github.com/fernandosanchezjr/goasicminer/node"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"github.com/howeyc/crc16"
+)
+
+const (
+	BM1366JobIdStep = 8
+	BM1366MaxJobId  = 0x80
+	// bm1366HeaderSize is the header without its nonce, which the chips fill in.
+	bm1366HeaderSize = 76
+	bm1366JobFields  = 6
+	bm1366JobSize    = 4 + bm1366JobFields + bm1366HeaderSize + 2
+)
+
+// BM1366Task is a job carrying the whole header but the nonce, one 32 bit word at a time from last to first, each in
+// wire order. The chips roll the version themselves and report the bits they rolled along with the nonce.
+type BM1366Task struct {
+	base.ITask
+	jobId byte
+	data  [bm1366JobSize]byte
+}
+
+func NewBM1366Task(jobId byte) *BM1366Task {
+	t := &BM1366Task{ITask: base.NewTask(int(jobId), 1), jobId: jobId}
+	copy(t.data[:], gekko.BM1397Preamble)
+	t.data[2] = bm1366TypeJob | bm1366CmdWrite
+	t.data[3] = byte(bm1366JobSize - len(gekko.BM1397Preamble))
+	t.data[4] = jobId
+	t.data[5] = 1
+	return t
+}
+
+func (t *BM1366Task) MarshalBinary() ([]byte, error) {
+	t.Lock()
+	defer t.Unlock()
+	return t.data[:], nil
+}
+
+// Update takes an unreversed node task. Its plain header has every word byte swapped, so reversing it whole yields
+// the words last to first in wire order.
+func (t *BM1366Task) Update(task *node.Task) {
+	t.Lock()
+	defer t.Unlock()
+	var header = t.data[4+bm1366JobFields : 4+bm1366JobFields+bm1366HeaderSize]
+	for i := range header {
+		header[i] = task.PlainHeader[bm1366HeaderSize-1-i]
+	}
+	checkSum := crc16.ChecksumCCITTFalse(t.data[len(gekko.BM1397Preamble) : bm1366JobSize-2])
+	t.data[bm1366JobSize-2] = byte(checkSum >> 8)
+	t.data[bm1366JobSize-1] = byte(checkSum)
+	t.ITask.Update(task)
+}
+
+// UpdateRolledResult fills a result with the nonce and the version bits the chip rolled into the task version.
+func (t *BM1366Task) UpdateRolledResult(tr *base.TaskResult, nonce utils.Nonce32, versionBits uint16) {
+	t.ITask.UpdateResult(tr, nonce, 0)
+	tr.Lock()
+	defer tr.Unlock()
+	tr.Version |= utils.Version(versionBits) << BM1366VersionShift
+}
+
+// BM1366TaskPool cycles through one task for every job id the chips can report.
+type BM1366TaskPool struct {
+	Tasks   []*BM1366Task
+	current int
+}
+
+func NewBM1366TaskPool() *BM1366TaskPool {
+	var tp = &BM1366TaskPool{Tasks: make([]*BM1366Task, BM1366MaxJobId/BM1366JobIdStep)}
+	for i := range tp.Tasks {
+		tp.Tasks[i] = NewBM1366Task(byte(i * BM1366JobIdStep))
+	}
+	return tp
+}
+
+func (tp *BM1366TaskPool) GetTask(jobId int) *BM1366Task {
+	if jobId < 0 || jobId >= BM1366MaxJobId || jobId%BM1366JobIdStep != 0 {
+		return nil
+	}
+	return tp.Tasks[jobId/BM1366JobIdStep]
+}
+
+func (tp *BM1366TaskPool) Next() *BM1366Task {
+	var next = tp.Tasks[tp.current]
+	tp.current = (tp.current + 1) % len(tp.Tasks)
+	return next
+}
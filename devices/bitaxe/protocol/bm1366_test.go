@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/fernandosanchezjr/goasicminer/devices/base"
+	gekko "github.com/fernandosanchezjr/goasicminer/devices/gekko/protocol"
+	"github.com/fernandosanchezjr/goasicminer/node"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"github.com/howeyc/crc16"
+	"testing"
+)
+
+func TestNewBM1366SetVersionMask(t *testing.T) {
+	data, _ := NewBM1366SetVersionMask(BM1366VersionRollingMask).MarshalBinary()
+	if !bytes.Equal(data[4:10], []byte{0x00, 0xa4, 0x90, 0x00, 0xff, 0xff}) {
+		t.Fatalf("unexpected command %x", data)
+	}
+	data, _ = gekko.NewBM1397WriteRegisterAll(BM1366FastUARTReg, BM1366FastUART).MarshalBinary()
+	if hex.EncodeToString(data) != "55aa510900281130020003" {
+		t.Fatalf("unexpected command %x", data)
+	}
+	if pll := NewBM1366PLL(485); pll == nil || pll.FBDiv < BM1366MinFBDiv || pll.FBDiv > BM1366MaxFBDiv {
+		t.Fatalf("invalid dividers %+v", pll)
+	}
+}
+
+func TestBM1366Task_Update(t *testing.T) {
+	var wire [80]byte
+	for i := range wire {
+		wire[i] = byte(i)
+	}
+	var task = node.NewTask(1, false)
+	copy(task.PlainHeader[:], wire[:])
+	utils.SwapUint32Bytes(task.PlainHeader[:])
+	task.Versions = []utils.Version{0x20000000}
+	var bt = NewBM1366Task(0x18)
+	bt.Update(task)
+	data, _ := bt.MarshalBinary()
+	if len(data) != 88 || data[2] != 0x21 || data[3] != 86 || data[4] != 0x18 || data[5] != 1 {
+		t.Fatalf("unexpected job header %x", data[:10])
+	}
+	if !bytes.Equal(data[6:10], []byte{0, 0, 0, 0}) {
+		t.Fatalf("unexpected starting nonce %x", data[6:10])
+	}
+	// nbits, ntime, merkle root, previous block and version, last word first
+	for word := 0; word < 19; word++ {
+		var field = data[10+4*word : 14+4*word]
+		var expected = wire[4*(18-word) : 4*(19-word)]
+		if !bytes.Equal(field, expected) {
+			t.Fatalf("word %d is %x, expected %x", word, field, expected)
+		}
+	}
+	if crc16.ChecksumCCITTFalse(data[2:86]) != uint16(data[86])<<8|uint16(data[87]) {
+		t.Fatal("invalid crc")
+	}
+	var tr = base.NewTaskResult()
+	bt.UpdateRolledResult(tr, 0x12345678, 0x0123)
+	if tr.Version != 0x20000000|0x0123<<BM1366VersionShift || tr.Nonce != 0x12345678 {
+		t.Fatalf("unexpected result version %s nonce %s", tr.Version, tr.Nonce)
+	}
+}
+
+func TestBM1366ResponseBlock_UnmarshalBinary(t *testing.T) {
+	data, err := hex.DecodeString("00aa5578563412002901238caa551366000000000000060caa550102030400080000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rb := NewBM1366ResponseBlock()
+	if err := rb.UnmarshalBinary(data[:30]); err != nil {
+		t.Fatal(err)
+	}
+	if rb.Count != 1 || rb.Responses[0].Nonce != 0x12345678 || rb.Responses[0].JobId != 0x10 ||
+		rb.Responses[0].Core != 9 || rb.Responses[0].VersionBits != 0x0123 {
+		t.Fatalf("unexpected responses %d %+v", rb.Count, rb.Responses[0])
+	}
+	// the response cut by the first read completes with the second
+	if err := rb.UnmarshalBinary(append(data[30:], 0x80)); err != nil {
+		t.Fatal(err)
+	}
+	if rb.Count != 1 || rb.Responses[0].Nonce != 0x04030201 || rb.Responses[0].JobId != 0 ||
+		rb.Responses[0].VersionBits != 0 {
+		t.Fatalf("unexpected responses %d %+v", rb.Count, rb.Responses[0])
+	}
+	cr := NewBM1366ChipsResponse(BM1366ChipId)
+	if err := cr.UnmarshalBinary(data[12:23]); err != nil || len(cr.Chips) != 1 {
+		t.Fatalf("chips %v: %v", cr.Chips, err)
+	}
+	if err := NewBM1366ChipsResponse(BM1368ChipId).UnmarshalBinary(data[12:23]); err == nil {
+		t.Fatal("accepted a BM1366 as a BM1368")
+	}
+}
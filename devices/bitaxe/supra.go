@@ -0,0 +1,32 @@
+package bitaxe
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"github.com/fernandosanchezjr/goasicminer/devices/base"
+	"github.com/fernandosanchezjr/goasicminer/devices/bitaxe/protocol"
+	"time"
+)
+
+type Supra struct {
+	base.ISerialDriver
+}
+
+func NewSupra() *Supra {
+	return &Supra{
+		ISerialDriver: base.NewSerialDriver(0xea60, 0x10c4, "Bitaxe Supra", "Bitaxe Supra"),
+	}
+}
+
+func (s *Supra) NewController(
+	cfg *config.Config, context *base.Context, _ base.IDriver, transport base.Transport, serialNumber string,
+) base.IController {
+	var device = cfg.Device(serialNumber, config.Device{
+		Frequency: 490, MinFrequency: 50, MaxFrequency: 650,
+		Timeout: 30 * time.Second, Chips: 1,
+	})
+	return NewBM1366Controller(
+		s.ISerialDriver.NewController(cfg, context, s, transport, serialNumber),
+		protocol.BM1368ChipId, BM1368NumCores, device.MinFrequency, device.MaxFrequency, device.Frequency, device.Chips,
+		device.Timeout, cfg.SoftStart,
+	)
+}
@@ -0,0 +1,32 @@
+package bitaxe
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"github.com/fernandosanchezjr/goasicminer/devices/base"
+	"github.com/fernandosanchezjr/goasicminer/devices/bitaxe/protocol"
+	"time"
+)
+
+type Ultra struct {
+	base.ISerialDriver
+}
+
+func NewUltra() *Ultra {
+	return &Ultra{
+		ISerialDriver: base.NewSerialDriver(0xea60, 0x10c4, "Bitaxe Ultra", "Bitaxe Ultra"),
+	}
+}
+
+func (u *Ultra) NewController(
+	cfg *config.Config, context *base.Context, _ base.IDriver, transport base.Transport, serialNumber string,
+) base.IController {
+	var device = cfg.Device(serialNumber, config.Device{
+		Frequency: 485, MinFrequency: 50, MaxFrequency: 575,
+		Timeout: 30 * time.Second, Chips: 1,
+	})
+	return NewBM1366Controller(
+		u.ISerialDriver.NewController(cfg, context, u, transport, serialNumber),
+		protocol.BM1366ChipId, BM1366NumCores, device.MinFrequency, device.MaxFrequency, device.Frequency, device.Chips,
+		device.Timeout, cfg.SoftStart,
+	)
+}
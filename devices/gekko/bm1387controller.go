@@ -2,6 +2,7 @@ package gekko
 
 import (
 	"fmt"
+	"github.com/fernandosanchezjr/goasicminer/config"
 	"github.com/fernandosanchezjr/goasicminer/devices/base"
 	"github.com/fernandosanchezjr/goasicminer/devices/gekko/protocol"
 	"github.com/fernandosanchezjr/goasicminer/generators"
@@ -9,7 +10,7 @@ import (
 	protocol2 "github.com/fernandosanchezjr/goasicminer/stratum/protocol"
 	"github.com/fernandosanchezjr/goasicminer/utils"
 	log "github.com/sirupsen/logrus"
-	"github.com/ziutek/ftdi"
+	"io"
 	"math/big"
 	"strings"
 	"sync"
@@ -54,6 +55,13 @@ type BM1387Controller struct {
 	writeTicker      *time.Ticker
 	taskResultPool   *base.TaskResultPool
 	pendingTaskPool  *protocol.TaskPool
+	tuning           config.Tuning
+	tuner            *base.FrequencyTuner
+	softStart        config.SoftStart
+	ramp             *base.FrequencyRamp
+	chipTuner        *base.ChipTuner
+	chipOffsets      []float64
+	chipFrequencies  []float64
 }
 
 func NewBM1387Controller(
@@ -63,10 +71,13 @@ func NewBM1387Controller(
 	defaultFrequency float64,
 	targetChips int,
 	timeout time.Duration,
+	tuning config.Tuning,
+	softStart config.SoftStart,
 ) *BM1387Controller {
 	rc := &BM1387Controller{IController: controller, quit: make(chan struct{}), frequency: 0.0,
 		currentDiff: big.NewInt(0), targetDiff: big.NewInt(0), minFrequency: minFrequency, maxFrequency: maxFrequency,
-		defaultFrequency: defaultFrequency, targetChips: targetChips, timeout: timeout,
+		defaultFrequency: defaultFrequency, targetChips: targetChips, timeout: timeout, tuning: tuning,
+		softStart:       softStart,
 		taskResultPool:  base.NewTaskResultPool(BM1387MaxVerifyTasks),
 		pendingTaskPool: protocol.NewTaskPool(BM1387MaxJobId, BM1387MidstateCount),
 	}
@@ -99,18 +110,30 @@ func (bm *BM1387Controller) Reset() error {
 		go bm.Exit()
 		return err
 	}
+	bm.loadChipOffsets()
 	if err := bm.sendChainInactive(); err != nil {
 		return err
 	}
 	if err := bm.setBaud(); err != nil {
 		return err
 	}
-	if err := bm.setFrequency(bm.defaultFrequency); err != nil {
+	var frequency = bm.defaultFrequency
+	if bm.softStart.Enabled {
+		bm.ramp = base.NewFrequencyRamp(bm.softStart, bm.minFrequency, bm.defaultFrequency)
+		frequency = bm.ramp.Frequency()
+	}
+	if err := bm.setFrequency(frequency); err != nil {
 		return err
 	}
 	if err := bm.setTiming(); err != nil {
 		return err
 	}
+	if bm.tuning.Enabled {
+		bm.tuner = base.NewFrequencyTuner(bm.tuning, bm.minFrequency, bm.maxFrequency, bm.frequency, 1)
+		if bm.tuning.PerChip {
+			bm.chipTuner = base.NewChipTuner(bm.tuning, bm.chipOffsets)
+		}
+	}
 	if err := bm.initializeTasks(); err != nil {
 		go bm.Exit()
 		return err
@@ -119,34 +142,25 @@ func (bm *BM1387Controller) Reset() error {
 }
 
 func (bm *BM1387Controller) performReset() error {
-	device := bm.Device()
-	if err := device.Reset(); err != nil {
-		return err
-	}
-	if err := device.SetLineProperties2(ftdi.DataBits8, ftdi.StopBits1, ftdi.ParityNone, ftdi.BreakOff); err != nil {
-		return err
-	}
-	if err := device.SetBaudrate(BM1387InitialBaudRate); err != nil {
+	transport := bm.Transport()
+	if err := transport.Reset(); err != nil {
 		return err
 	}
-	if err := device.SetFlowControl(ftdi.FlowCtrlDisable); err != nil {
+	if err := transport.SetBaudRate(BM1387InitialBaudRate); err != nil {
 		return err
 	}
-	if err := device.PurgeWriteBuffer(); err != nil {
+	if err := transport.Purge(); err != nil {
 		return err
 	}
-	if err := device.PurgeReadBuffer(); err != nil {
-		return err
-	}
-	if err := device.SetBitmode(0xf2, ftdi.ModeCBUS); err != nil {
+	if err := transport.SetGPIO(0xf, 0x2); err != nil {
 		return err
 	}
 	time.Sleep(30 * time.Millisecond)
-	if err := device.SetBitmode(0xf0, ftdi.ModeCBUS); err != nil {
+	if err := transport.SetGPIO(0xf, 0x0); err != nil {
 		return err
 	}
 	time.Sleep(30 * time.Millisecond)
-	if err := device.SetBitmode(0xf2, ftdi.ModeCBUS); err != nil {
+	if err := transport.SetGPIO(0xf, 0x2); err != nil {
 		return err
 	}
 	time.Sleep(200 * time.Millisecond)
@@ -172,10 +186,7 @@ func (bm *BM1387Controller) countChips() error {
 			return err
 		} else {
 			bm.chipCount = len(ccr.Chips)
-			if bm.chipCount != bm.targetChips {
-				return fmt.Errorf("found %d chips instead of %d", bm.chipCount, bm.targetChips)
-			}
-			return nil
+			return bm.CheckChips(bm.chipCount, bm.targetChips)
 		}
 	}
 }
@@ -225,8 +236,7 @@ func (bm *BM1387Controller) setBaud() error {
 		time.Sleep(10 * time.Millisecond)
 	}
 	//Set baud
-	device := bm.Device()
-	if err := device.SetBaudrate(BM1387BaudRate); err != nil {
+	if err := bm.Transport().SetBaudRate(BM1387BaudRate); err != nil {
 		return err
 	}
 	if data, err := sbb.MarshalBinary(); err != nil {
@@ -240,23 +250,63 @@ func (bm *BM1387Controller) setBaud() error {
 	return nil
 }
 
+// loadChipOffsets resumes the frequency offsets persisted for every chip, running without any when they cannot be
+// read. Partial chains start without offsets, as theirs were tuned for chips at other positions.
+func (bm *BM1387Controller) loadChipOffsets() {
+	var err error
+	bm.chipFrequencies = make([]float64, bm.chipCount)
+	if bm.Degraded() {
+		bm.chipOffsets = make([]float64, bm.chipCount)
+		return
+	}
+	if bm.chipOffsets, err = base.LoadChipOffsets(base.GetChipOffsetsPath(), bm.String(), bm.chipCount); err != nil {
+		log.WithFields(log.Fields{
+			"serial": bm.Alias(),
+			"error":  err.Error(),
+		}).Warn("Error loading chip offsets")
+	}
+}
+
+// setFrequency clocks every chip at the clamped frequency plus its offset, skipping chips already there.
 func (bm *BM1387Controller) setFrequency(frequency float64) error {
 	if frequency < bm.minFrequency {
 		frequency = bm.minFrequency
 	} else if frequency > bm.maxFrequency {
 		frequency = bm.maxFrequency
 	}
-	if bm.frequency != frequency {
-		for i := 0; i < bm.chipCount; i++ {
-			if err := bm.setChipFrequency(frequency, i); err != nil {
-				return err
-			}
+	for i := 0; i < bm.chipCount; i++ {
+		var chipFrequency = bm.chipFrequency(frequency, i)
+		if bm.chipFrequencies[i] == chipFrequency {
+			continue
+		}
+		if err := bm.setChipFrequency(chipFrequency, i); err != nil {
+			return err
 		}
-		bm.frequency = frequency
+		bm.chipFrequencies[i] = chipFrequency
 	}
+	bm.frequency = frequency
 	return nil
 }
 
+func (bm *BM1387Controller) chipFrequency(frequency float64, chip int) float64 {
+	frequency += bm.chipOffsets[chip]
+	if frequency < bm.minFrequency {
+		return bm.minFrequency
+	} else if frequency > bm.maxFrequency {
+		return bm.maxFrequency
+	}
+	return frequency
+}
+
+// averageFrequency is the frequency of the chain as a whole, the mean of the chip frequencies.
+func (bm *BM1387Controller) averageFrequency() float64 {
+	var total float64
+	for _, frequency := range bm.chipFrequencies {
+		total += frequency
+	}
+	return total / float64(len(bm.chipFrequencies))
+}
+
 func (bm *BM1387Controller) setChipFrequency(frequency float64, chipId int) error {
 	buf, err := bm.AllocateReadBuffer()
 	if err != nil {
@@ -278,14 +328,16 @@ func (bm *BM1387Controller) setChipFrequency(frequency float64, chipId int) erro
 
 func (bm *BM1387Controller) setTiming() error {
 	var hashRate utils.HashRate
-	hashRate, bm.fullscanDuration, bm.maxTaskWait = protocol.Timing(bm.chipCount, bm.frequency, BM1387NumCores,
-		BM1387WaitFactor)
-	if err := bm.Device().SetLatencyTimer(1); err != nil {
+	hashRate, bm.fullscanDuration, bm.maxTaskWait = protocol.Timing(bm.chipCount, bm.averageFrequency(),
+		BM1387NumCores, BM1387WaitFactor)
+	bm.HashMeter().SetExpected(hashRate, 1)
+	if err := bm.Transport().SetLatencyTimer(1); err != nil {
 		return err
 	}
 	log.WithFields(log.Fields{
-		"serial":       bm.String(),
+		"serial":       bm.Alias(),
 		"frequency":    bm.frequency,
+		"chips":        bm.chipCount,
 		"hashRate":     hashRate,
 		"fullScanTime": bm.fullscanDuration,
 		"maxTaskWait":  bm.maxTaskWait,
@@ -307,14 +359,14 @@ func (bm *BM1387Controller) loopRecover(loopName string) {
 		if !strings.Contains(fmt.Sprint(err), "send on closed channel") &&
 			!strings.Contains(fmt.Sprint(err), "nil pointer dereference") {
 			log.WithFields(log.Fields{
-				"serial": bm.String(),
+				"serial": bm.Alias(),
 				"loop":   loopName,
 				"error":  fmt.Errorf("%#v", err),
 			}).Error("Loop error")
 		}
 		bm.waiter.Done()
 		if !bm.shuttingDown {
-			bm.Exit()
+			bm.Fail(fmt.Errorf("%s loop: %v", loopName, err))
 		}
 	}
 }
@@ -326,11 +378,16 @@ func closeTicker(ticker *time.Ticker) *time.Ticker {
 	return nil
 }
 
-func (bm *BM1387Controller) handlerExit() {
+// handlerExit ends a loop, failing the controller when err says why.
+func (bm *BM1387Controller) handlerExit(err error) {
 	bm.readTicker = closeTicker(bm.readTicker)
 	bm.writeTicker = closeTicker(bm.writeTicker)
 	bm.waiter.Done()
-	bm.Exit()
+	if err != nil {
+		bm.Fail(err)
+	} else {
+		bm.Exit()
+	}
 }
 
 func (bm *BM1387Controller) readLoop() {
@@ -346,7 +403,7 @@ func (bm *BM1387Controller) readLoop() {
 	for {
 		select {
 		case <-bm.quit:
-			bm.handlerExit()
+			bm.handlerExit(nil)
 			return
 		case readTime = <-bm.readTicker.C:
 			markRead = false
@@ -354,8 +411,8 @@ func (bm *BM1387Controller) readLoop() {
 				time.Sleep(1 * time.Millisecond)
 				continue
 			}
-			if read, died := bm.readResponseBlock(buf, rb); died {
-				bm.handlerExit()
+			if read, err := bm.readResponseBlock(buf, rb); err != nil {
+				bm.handlerExit(err)
 				return
 			} else if !read {
 				continue
@@ -368,27 +425,26 @@ func (bm *BM1387Controller) readLoop() {
 	}
 }
 
-func (bm *BM1387Controller) readResponseBlock(buf []byte, rb *protocol.ResponseBlock) (read bool, died bool) {
+func (bm *BM1387Controller) readResponseBlock(buf []byte, rb *protocol.ResponseBlock) (read bool, err error) {
 	var readCount int
-	var err error
 	if bm.warmupRead && time.Since(bm.lastRead) > bm.timeout {
-		return false, true
+		return false, base.ErrReadTimeout
 	}
 	if readCount, err = bm.Read(buf); err != nil {
 		log.WithFields(log.Fields{
-			"serial": bm.String(),
+			"serial": bm.Alias(),
 			"error":  err.Error(),
 		}).Error("Read error")
-		return false, true
+		return false, err
 	}
 	if err := rb.UnmarshalBinary(buf[:readCount]); err != nil {
 		log.WithFields(log.Fields{
-			"serial": bm.String(),
+			"serial": bm.Alias(),
 			"error":  err.Error(),
 		}).Error("Error decoding response block")
-		return false, false
+		return false, nil
 	}
-	return true, false
+	return true, nil
 }
 
 func (bm *BM1387Controller) dispatchResponseValidation(
@@ -417,6 +473,8 @@ func (bm *BM1387Controller) dispatchResponseValidation(
 		var nextResult = bm.taskResultPool.Next()
 		task = bm.pendingTaskPool.GetTask(index)
 		task.UpdateResult(nextResult, taskResponse.Nonce, midstate)
+		nextResult.Chip = taskResponse.ChipIndex(bm.chipCount)
+		nextResult.Core = taskResponse.CoreIndex()
 		bm.verifyQueue <- nextResult
 		read = true
 	}
@@ -431,21 +489,64 @@ func (bm *BM1387Controller) writeLoop() {
 	var workChan = bm.WorkChannel()
 	var versionMasks [BM1387MidstateCount]utils.Version
 	bm.writeTicker = time.NewTicker(bm.fullscanDuration)
+	var tuneChan <-chan time.Time
+	if bm.tuner != nil {
+		var tuneTicker = time.NewTicker(base.TuningPollInterval)
+		defer tuneTicker.Stop()
+		tuneChan = tuneTicker.C
+	}
+	var rampChan <-chan time.Time
+	if bm.ramp != nil {
+		var rampTicker = time.NewTicker(base.RampPollInterval)
+		defer rampTicker.Stop()
+		rampChan = rampTicker.C
+	}
 	var steps = 1
 	var currentTask, last = bm.pendingTaskPool.Next(steps)
 	for {
 		select {
 		case <-bm.quit:
-			bm.handlerExit()
+			bm.handlerExit(nil)
 			return
 		case bm.work = <-workChan:
 			continue
+		case now := <-rampChan:
+			if bm.work == nil {
+				bm.ramp.Pause()
+				continue
+			}
+			if err := bm.rampStep(now); err != nil {
+				bm.handlerExit(err)
+				return
+			}
+			if bm.ramp.Done() {
+				rampChan = nil
+			}
+		case now := <-tuneChan:
+			if bm.ramp != nil && !bm.ramp.Done() {
+				continue
+			}
+			if frequency, changed := bm.tuner.Next(now); changed {
+				if err := bm.retune(frequency); err != nil {
+					bm.handlerExit(err)
+					return
+				}
+			}
+			if bm.chipTuner == nil || !bm.tuner.Settled() {
+				continue
+			}
+			if offsets, changed := bm.chipTuner.Next(now); changed {
+				if err := bm.retuneChips(offsets); err != nil {
+					bm.handlerExit(err)
+					return
+				}
+			}
 		case <-bm.writeTicker.C:
 			if bm.work == nil {
 				continue
 			}
-			if !bm.writeTask(currentTask) {
-				bm.handlerExit()
+			if err := bm.writeTask(currentTask); err != nil {
+				bm.handlerExit(err)
 				return
 			}
 			currentTask, last = bm.pendingTaskPool.Next(steps)
@@ -454,11 +555,7 @@ func (bm *BM1387Controller) writeLoop() {
 				steps = BM1387MidstateCount
 			}
 			if bm.warmupWritten {
-				generated = <-generatorChan
-				versionMasks[0] = generated.Version0
-				versionMasks[1] = generated.Version1
-				versionMasks[2] = generated.Version2
-				versionMasks[3] = generated.Version3
+				generated = bm.nextAllowed(generatorChan, versionMasks[:])
 				task.Update(generated.Work, versionMasks[:])
 				currentTask.Update(task)
 			}
@@ -466,35 +563,131 @@ func (bm *BM1387Controller) writeLoop() {
 	}
 }
 
-func (bm *BM1387Controller) writeTask(currentTask *protocol.Task) (succeeded bool) {
-	var written int
-	var data []byte
-	var err error
-	if data, err = currentTask.MarshalBinary(); err != nil {
+// nextAllowed takes generated headers until one fits the template's ntime bounds and mutability, leaving only the
+// versions the template accepts in versionMasks.
+func (bm *BM1387Controller) nextAllowed(
+	generatorChan chan *generators.Generated,
+	versionMasks []utils.Version,
+) *generators.Generated {
+	for {
+		var generated = <-generatorChan
+		if err := generated.AllowedVersions(versionMasks); err != nil {
+			log.WithFields(log.Fields{
+				"serial": bm.Alias(),
+				"error":  err.Error(),
+			}).Debug("Refusing generated header")
+			continue
+		}
+		return generated
+	}
+}
+
+// applyFrequency moves the chips to a frequency, pacing writes to the new full scan time. It runs on the write loop
+// so no task goes out while the chips are being clocked.
+func (bm *BM1387Controller) applyFrequency(frequency float64) error {
+	if err := bm.setFrequency(frequency); err != nil {
 		log.WithFields(log.Fields{
-			"serial": bm.String(),
+			"serial": bm.Alias(),
 			"error":  err.Error(),
-		}).Error("Task marshalling error")
-		bm.handlerExit()
-		return false
+		}).Error("Frequency change error")
+		return err
+	}
+	if err := bm.setTiming(); err != nil {
+		return err
+	}
+	bm.writeTicker.Stop()
+	bm.writeTicker = time.NewTicker(bm.fullscanDuration)
+	return nil
+}
+
+// rampStep takes the next soft start step once the ramp allows it, handing the frequency over to the tuner when the
+// ramp is done.
+func (bm *BM1387Controller) rampStep(now time.Time) error {
+	frequency, changed := bm.ramp.Next(now)
+	if changed {
+		if err := bm.applyFrequency(frequency); err != nil {
+			return err
+		}
+	}
+	if !bm.ramp.Done() {
+		return nil
+	}
+	var fields = log.Fields{
+		"serial":    bm.Alias(),
+		"frequency": bm.frequency,
+		"target":    bm.ramp.Target,
+	}
+	if bm.ramp.Aborted() {
+		log.WithFields(fields).Warnln("Soft start stopped short of target")
+	} else {
+		log.WithFields(fields).Infoln("Soft start finished")
+	}
+	if bm.tuner != nil {
+		bm.tuner.Restart(bm.frequency, now)
+	}
+	return nil
+}
+
+// retune moves the chips to a frequency picked by the tuner.
+func (bm *BM1387Controller) retune(frequency float64) error {
+	var previous = bm.frequency
+	if err := bm.applyFrequency(frequency); err != nil {
+		return err
 	}
-	if written, err = bm.Write(data); err != nil {
+	log.WithFields(log.Fields{
+		"serial":    bm.Alias(),
+		"previous":  previous,
+		"frequency": bm.frequency,
+		"hashRate":  bm.tuner.HashRate,
+		"errorRate": bm.tuner.ErrorRate,
+		"settled":   bm.tuner.Settled(),
+	}).Infoln("Frequency tuned")
+	return nil
+}
+
+// retuneChips moves chips to the offsets picked by the chip tuner and persists them for the next start.
+func (bm *BM1387Controller) retuneChips(offsets []float64) error {
+	copy(bm.chipOffsets, offsets)
+	if err := bm.retune(bm.frequency); err != nil {
+		return err
+	}
+	// offsets of a partial chain would not fit the full chain once it is repaired
+	if !bm.Degraded() {
+		if err := base.SaveChipOffsets(base.GetChipOffsetsPath(), bm.String(), offsets); err != nil {
+			log.WithFields(log.Fields{
+				"serial": bm.Alias(),
+				"error":  err.Error(),
+			}).Warn("Error saving chip offsets")
+		}
+	}
+	log.WithFields(log.Fields{
+		"serial":  bm.Alias(),
+		"offsets": offsets,
+	}).Infoln("Chip frequencies tuned")
+	return nil
+}
+
+func (bm *BM1387Controller) writeTask(currentTask *protocol.Task) error {
+	data, err := currentTask.MarshalBinary()
+	if err != nil {
 		log.WithFields(log.Fields{
-			"serial": bm.String(),
+			"serial": bm.Alias(),
 			"error":  err.Error(),
-		}).Error("Write error")
-		bm.handlerExit()
-		return false
+		}).Error("Task marshalling error")
+		return err
+	}
+	written, err := bm.Write(data)
+	if err == nil && written != len(data) {
+		err = io.ErrShortWrite
 	}
-	if written != len(data) {
+	if err != nil {
 		log.WithFields(log.Fields{
-			"serial": bm.String(),
+			"serial": bm.Alias(),
 			"error":  err.Error(),
-		}).Error("Write incomplete")
-		bm.handlerExit()
-		return false
+		}).Error("Write error")
+		return err
 	}
-	return true
+	return nil
 }
 
 func (bm *BM1387Controller) verifyLoop() {
@@ -506,7 +699,19 @@ func (bm *BM1387Controller) verifyLoop() {
 			bm.waiter.Done()
 			return
 		case task = <-bm.verifyQueue:
-			task.Verify(bm.String())
+			var outcome = base.VerifyResult(bm, task)
+			if outcome == base.NonceDuplicate {
+				continue
+			}
+			var valid = outcome == base.NonceValid
+			if bm.ramp != nil && !bm.ramp.Done() {
+				bm.ramp.Record(valid)
+			} else if bm.tuner != nil {
+				bm.tuner.Record(valid)
+				if bm.chipTuner != nil && bm.tuner.Settled() {
+					bm.chipTuner.Record(task.Chip, valid)
+				}
+			}
 		}
 	}
 }
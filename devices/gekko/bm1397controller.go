@@ -0,0 +1,519 @@
+package gekko
+
+import (
+	"fmt"
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"github.com/fernandosanchezjr/goasicminer/devices/base"
+	"github.com/fernandosanchezjr/goasicminer/devices/gekko/protocol"
+	"github.com/fernandosanchezjr/goasicminer/generators"
+	"github.com/fernandosanchezjr/goasicminer/node"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	BM1397BaudRate       = 115200
+	BM1397NumCores       = 672
+	BM1397MidstateCount  = 4
+	BM1397MaxVerifyTasks = BM1397MidstateCount * protocol.BM1397MaxJobId
+	BM1397WaitFactor     = 0.5
+	// BM1397NonceDifficulty is the difficulty the 256 ticket mask has chips report nonces at.
+	BM1397NonceDifficulty = 256
+	// BM1397CoreReset and BM1397CoreEnable are written to the core control register in turn to bring the cores up.
+	BM1397CoreReset  = 0x80008540
+	BM1397CoreEnable = 0x80008020
+	BM1397AnalogMux  = 0x00000003
+	BM1397IODriver   = 0x02111111
+)
+
+// BM1397Controller drives a chain of BM1397 chips, which take jobs carrying the header tail and up to four midstates
+// and roll through the midstates on chip. The chain is left at its default baud rate, as a job spans four full scans
+// of the nonce range.
+type BM1397Controller struct {
+	base.IController
+	frequency        float64
+	chipCount        int
+	quit             chan struct{}
+	waiter           sync.WaitGroup
+	verifyQueue      chan *base.TaskResult
+	timeout          time.Duration
+	fullscanDuration time.Duration
+	shuttingDown     bool
+	minFrequency     float64
+	maxFrequency     float64
+	defaultFrequency float64
+	targetChips      int
+	work             *node.Work
+	workMtx          sync.Mutex
+	lastRead         time.Time
+	readTicker       *time.Ticker
+	writeTicker      *time.Ticker
+	softStart        config.SoftStart
+	ramp             *base.FrequencyRamp
+	taskResultPool   *base.TaskResultPool
+	pendingTaskPool  *protocol.BM1397TaskPool
+}
+
+func NewBM1397Controller(
+	controller base.IController,
+	minFrequency float64,
+	maxFrequency float64,
+	defaultFrequency float64,
+	targetChips int,
+	timeout time.Duration,
+	softStart config.SoftStart,
+) *BM1397Controller {
+	return &BM1397Controller{IController: controller, quit: make(chan struct{}), minFrequency: minFrequency,
+		maxFrequency: maxFrequency, defaultFrequency: defaultFrequency, targetChips: targetChips, timeout: timeout,
+		softStart:       softStart,
+		taskResultPool:  base.NewTaskResultPool(BM1397MaxVerifyTasks),
+		pendingTaskPool: protocol.NewBM1397TaskPool(BM1397MidstateCount),
+	}
+}
+
+func (bm *BM1397Controller) Close() {
+	bm.shuttingDown = true
+	waitForLoops := bm.quit != nil
+	if bm.quit != nil {
+		close(bm.quit)
+	}
+	if bm.verifyQueue != nil {
+		close(bm.verifyQueue)
+	}
+	if waitForLoops {
+		bm.waiter.Wait()
+		bm.quit = nil
+	}
+	bm.IController.Close()
+}
+
+func (bm *BM1397Controller) Reset() error {
+	defer bm.loopRecover("init")
+	if err := bm.performReset(); err != nil {
+		go bm.Exit()
+		return err
+	}
+	if err := bm.countChips(); err != nil {
+		go bm.Exit()
+		return err
+	}
+	if err := bm.setAddresses(); err != nil {
+		return err
+	}
+	if err := bm.initRegisters(); err != nil {
+		return err
+	}
+	// TODO: run base.FrequencyTuner once the ramp is done, as the BM1387 controller does; until then Tuning is ignored
+	// and the chips stay at their configured frequency. The R909 chain would also want base.ChipTuner offsets, which
+	// need nonces attributed to chips by their address first.
+	var frequency = bm.defaultFrequency
+	if bm.softStart.Enabled {
+		bm.ramp = base.NewFrequencyRamp(bm.softStart, bm.minFrequency, bm.defaultFrequency)
+		frequency = bm.ramp.Frequency()
+	}
+	if err := bm.setFrequency(frequency); err != nil {
+		return err
+	}
+	if err := bm.setTiming(); err != nil {
+		return err
+	}
+	bm.initializeTasks()
+	return nil
+}
+
+func (bm *BM1397Controller) performReset() error {
+	transport := bm.Transport()
+	if err := transport.Reset(); err != nil {
+		return err
+	}
+	if err := transport.SetBaudRate(BM1397BaudRate); err != nil {
+		return err
+	}
+	if err := transport.Purge(); err != nil {
+		return err
+	}
+	if err := transport.SetGPIO(0xf, 0x2); err != nil {
+		return err
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := transport.SetGPIO(0xf, 0x0); err != nil {
+		return err
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := transport.SetGPIO(0xf, 0x2); err != nil {
+		return err
+	}
+	time.Sleep(200 * time.Millisecond)
+	return nil
+}
+
+func (bm *BM1397Controller) writeCommand(command *protocol.BM1397Command) error {
+	data, _ := command.MarshalBinary()
+	_, err := bm.Write(data)
+	return err
+}
+
+func (bm *BM1397Controller) countChips() error {
+	buf, err := bm.AllocateReadBuffer()
+	if err != nil {
+		return err
+	}
+	if err := bm.writeCommand(protocol.NewBM1397ReadRegister(protocol.BM1397ChipAddressReg)); err != nil {
+		return err
+	}
+	time.Sleep(10 * time.Millisecond)
+	read, err := bm.Read(buf)
+	if err != nil {
+		return err
+	}
+	cr := protocol.NewBM1397ChipsResponse()
+	if err := cr.UnmarshalBinary(buf[:read]); err != nil {
+		return err
+	}
+	bm.chipCount = len(cr.Chips)
+	return bm.CheckChips(bm.chipCount, bm.targetChips)
+}
+
+func (bm *BM1397Controller) chipAddress(chip int) byte {
+	return byte((0x100 / bm.chipCount) * chip)
+}
+
+func (bm *BM1397Controller) setAddresses() error {
+	for i := 0; i < 3; i++ {
+		if err := bm.writeCommand(protocol.NewBM1397ChainInactive()); err != nil {
+			return err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for i := 0; i < bm.chipCount; i++ {
+		if err := bm.writeCommand(protocol.NewBM1397SetAddress(bm.chipAddress(i))); err != nil {
+			return err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return nil
+}
+
+func (bm *BM1397Controller) initRegisters() error {
+	var registers = []struct {
+		register byte
+		value    uint32
+	}{
+		{protocol.BM1397CoreControlReg, BM1397CoreReset},
+		{protocol.BM1397CoreControlReg, BM1397CoreEnable},
+		{protocol.BM1397TicketMaskReg, protocol.BM1397TicketMask256},
+		{protocol.BM1397AnalogMuxReg, BM1397AnalogMux},
+		{protocol.BM1397IODriverReg, BM1397IODriver},
+	}
+	for _, r := range registers {
+		if err := bm.writeCommand(protocol.NewBM1397WriteRegisterAll(r.register, r.value)); err != nil {
+			return err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return nil
+}
+
+// setFrequency programs PLL0 of every chip with the dividers closest to the clamped frequency.
+func (bm *BM1397Controller) setFrequency(frequency float64) error {
+	if frequency < bm.minFrequency {
+		frequency = bm.minFrequency
+	} else if frequency > bm.maxFrequency {
+		frequency = bm.maxFrequency
+	}
+	var pll = protocol.NewBM1397PLL(frequency)
+	if bm.frequency == pll.Frequency {
+		return nil
+	}
+	if err := bm.writeCommand(protocol.NewBM1397WriteRegisterAll(protocol.BM1397PLL0DividerReg,
+		protocol.BM1397PLL0DividerInit)); err != nil {
+		return err
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := bm.writeCommand(protocol.NewBM1397WriteRegisterAll(protocol.BM1397PLL0Reg, pll.Register())); err != nil {
+		return err
+	}
+	time.Sleep(10 * time.Millisecond)
+	bm.frequency = pll.Frequency
+	return nil
+}
+
+func (bm *BM1397Controller) setTiming() error {
+	var hashRate utils.HashRate
+	hashRate, bm.fullscanDuration, _ = protocol.Timing(bm.chipCount, bm.frequency, BM1397NumCores,
+		BM1397WaitFactor)
+	bm.HashMeter().SetExpected(hashRate, BM1397NonceDifficulty)
+	if err := bm.Transport().SetLatencyTimer(1); err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"serial":       bm.Alias(),
+		"frequency":    bm.frequency,
+		"chips":        bm.chipCount,
+		"hashRate":     hashRate,
+		"fullScanTime": bm.fullscanDuration,
+	}).Infoln("Timing set up")
+	return nil
+}
+
+func (bm *BM1397Controller) initializeTasks() {
+	bm.verifyQueue = make(chan *base.TaskResult, BM1397MaxVerifyTasks)
+	bm.lastRead = time.Now()
+	bm.waiter.Add(3)
+	go bm.verifyLoop()
+	go bm.readLoop()
+	go bm.writeLoop()
+}
+
+func (bm *BM1397Controller) loopRecover(loopName string) {
+	if err := recover(); err != nil {
+		if !strings.Contains(fmt.Sprint(err), "send on closed channel") &&
+			!strings.Contains(fmt.Sprint(err), "nil pointer dereference") {
+			log.WithFields(log.Fields{
+				"serial": bm.Alias(),
+				"loop":   loopName,
+				"error":  fmt.Errorf("%#v", err),
+			}).Error("Loop error")
+		}
+		bm.waiter.Done()
+		if !bm.shuttingDown {
+			bm.Fail(fmt.Errorf("%s loop: %v", loopName, err))
+		}
+	}
+}
+
+// handlerExit ends a loop, failing the controller when err says why.
+func (bm *BM1397Controller) handlerExit(err error) {
+	bm.readTicker = closeTicker(bm.readTicker)
+	bm.writeTicker = closeTicker(bm.writeTicker)
+	bm.waiter.Done()
+	if err != nil {
+		bm.Fail(err)
+	} else {
+		bm.Exit()
+	}
+}
+
+// readLoop dispatches nonces to their job and midstate. A chain is taken for dead when it stays silent for longer
+// than the timeout while it has work.
+// setWork hands new work to the write loop, guarded as the read loop checks for it too.
+func (bm *BM1397Controller) setWork(work *node.Work) {
+	bm.workMtx.Lock()
+	defer bm.workMtx.Unlock()
+	bm.work = work
+}
+
+// hasWork reports to the read loop whether the chips were given work, as reads only time out once they were.
+func (bm *BM1397Controller) hasWork() bool {
+	bm.workMtx.Lock()
+	defer bm.workMtx.Unlock()
+	return bm.work != nil
+}
+
+func (bm *BM1397Controller) readLoop() {
+	defer bm.loopRecover("read")
+	buf, err := bm.AllocateReadBuffer()
+	if err != nil {
+		panic(err)
+	}
+	rb := protocol.NewBM1397ResponseBlock()
+	bm.readTicker = time.NewTicker(bm.fullscanDuration)
+	for {
+		select {
+		case <-bm.quit:
+			bm.handlerExit(nil)
+			return
+		case readTime := <-bm.readTicker.C:
+			if !bm.hasWork() {
+				bm.lastRead = readTime
+				continue
+			}
+			if time.Since(bm.lastRead) > bm.timeout {
+				bm.handlerExit(base.ErrReadTimeout)
+				return
+			}
+			read, err := bm.Read(buf)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"serial": bm.Alias(),
+					"error":  err.Error(),
+				}).Error("Read error")
+				bm.handlerExit(err)
+				return
+			}
+			if err := rb.UnmarshalBinary(buf[:read]); err != nil {
+				log.WithFields(log.Fields{
+					"serial": bm.Alias(),
+					"error":  err.Error(),
+				}).Error("Error decoding response block")
+				continue
+			}
+			if bm.dispatchResponseValidation(rb) {
+				bm.lastRead = readTime
+			}
+		}
+	}
+}
+
+func (bm *BM1397Controller) dispatchResponseValidation(rb *protocol.BM1397ResponseBlock) bool {
+	var read bool
+	for i := 0; i < rb.Count; i++ {
+		var response = rb.Responses[i]
+		var task = bm.pendingTaskPool.GetTask(response.JobId)
+		if task == nil || response.Midstate >= task.VersionsCount() || task.GetWorkId() == 0 {
+			continue
+		}
+		var nextResult = bm.taskResultPool.Next()
+		task.UpdateResult(nextResult, response.Nonce, response.Midstate)
+		nextResult.Chip, nextResult.Core = bm.singleChip(), -1
+		bm.verifyQueue <- nextResult
+		read = true
+	}
+	return read
+}
+
+func (bm *BM1397Controller) writeLoop() {
+	defer bm.loopRecover("write")
+	var generatorChan = bm.GetGenerator()
+	var task = node.NewTask(BM1397MidstateCount, true)
+	var workChan = bm.WorkChannel()
+	var versionMasks [BM1397MidstateCount]utils.Version
+	bm.writeTicker = time.NewTicker(BM1397MidstateCount * bm.fullscanDuration)
+	var rampChan <-chan time.Time
+	if bm.ramp != nil {
+		var rampTicker = time.NewTicker(base.RampPollInterval)
+		defer rampTicker.Stop()
+		rampChan = rampTicker.C
+	}
+	for {
+		select {
+		case <-bm.quit:
+			bm.handlerExit(nil)
+			return
+		case work := <-workChan:
+			bm.setWork(work)
+			continue
+		case now := <-rampChan:
+			if bm.work == nil {
+				bm.ramp.Pause()
+				continue
+			}
+			if err := bm.rampStep(now); err != nil {
+				bm.handlerExit(err)
+				return
+			}
+			if bm.ramp.Done() {
+				rampChan = nil
+			}
+		case <-bm.writeTicker.C:
+			if bm.work == nil {
+				continue
+			}
+			var generated = bm.nextAllowed(generatorChan, versionMasks[:])
+			var currentTask = bm.pendingTaskPool.Next()
+			task.Update(generated.Work, versionMasks[:])
+			currentTask.Update(task)
+			data, _ := currentTask.MarshalBinary()
+			if written, err := bm.Write(data); err != nil || written != len(data) {
+				if err == nil {
+					err = io.ErrShortWrite
+				}
+				log.WithFields(log.Fields{
+					"serial": bm.Alias(),
+					"error":  err.Error(),
+				}).Error("Write error")
+				bm.handlerExit(err)
+				return
+			}
+		}
+	}
+}
+
+// nextAllowed takes generated headers until one fits the template's ntime bounds and mutability, leaving only the
+// versions the template accepts in versionMasks.
+func (bm *BM1397Controller) nextAllowed(
+	generatorChan chan *generators.Generated,
+	versionMasks []utils.Version,
+) *generators.Generated {
+	for {
+		var generated = <-generatorChan
+		if err := generated.AllowedVersions(versionMasks); err != nil {
+			log.WithFields(log.Fields{
+				"serial": bm.Alias(),
+				"error":  err.Error(),
+			}).Debug("Refusing generated header")
+			continue
+		}
+		return generated
+	}
+}
+
+// singleChip attributes nonces to the only chip of single chip devices, leaving them to the device on chains.
+func (bm *BM1397Controller) singleChip() int {
+	if bm.chipCount == 1 {
+		return 0
+	}
+	return -1
+}
+
+// applyFrequency moves the chips to a frequency, pacing writes to the new full scan time. It runs on the write loop
+// so no task goes out while the chips are being clocked.
+func (bm *BM1397Controller) applyFrequency(frequency float64) error {
+	if err := bm.setFrequency(frequency); err != nil {
+		log.WithFields(log.Fields{
+			"serial": bm.Alias(),
+			"error":  err.Error(),
+		}).Error("Frequency change error")
+		return err
+	}
+	if err := bm.setTiming(); err != nil {
+		return err
+	}
+	bm.writeTicker.Stop()
+	bm.writeTicker = time.NewTicker(BM1397MidstateCount * bm.fullscanDuration)
+	return nil
+}
+
+// rampStep takes the next soft start step once the ramp allows it.
+func (bm *BM1397Controller) rampStep(now time.Time) error {
+	frequency, changed := bm.ramp.Next(now)
+	if changed {
+		if err := bm.applyFrequency(frequency); err != nil {
+			return err
+		}
+	}
+	if !bm.ramp.Done() {
+		return nil
+	}
+	var fields = log.Fields{
+		"serial":    bm.Alias(),
+		"frequency": bm.frequency,
+		"target":    bm.ramp.Target,
+	}
+	if bm.ramp.Aborted() {
+		log.WithFields(fields).Warnln("Soft start stopped short of target")
+	} else {
+		log.WithFields(fields).Infoln("Soft start finished")
+	}
+	return nil
+}
+
+func (bm *BM1397Controller) verifyLoop() {
+	defer bm.loopRecover("verify")
+	for {
+		select {
+		case <-bm.quit:
+			bm.waiter.Done()
+			return
+		case task := <-bm.verifyQueue:
+			var outcome = base.VerifyResult(bm, task)
+			if bm.ramp != nil && outcome != base.NonceDuplicate {
+				bm.ramp.Record(outcome == base.NonceValid)
+			}
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package gekko
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"github.com/fernandosanchezjr/goasicminer/devices/base"
+	"github.com/ziutek/ftdi"
+	"time"
+)
+
+type CompacF struct {
+	base.IFTDIDriver
+}
+
+func NewCompacF() *CompacF {
+	return &CompacF{
+		IFTDIDriver: base.NewDriver(0x6015, 0x0403, "GekkoScience",
+			"CompacF Bitcoin Miner", ftdi.ChannelA),
+	}
+}
+
+func (cf *CompacF) NewController(
+	cfg *config.Config, context *base.Context, _ base.IDriver, transport base.Transport, serialNumber string,
+) base.IController {
+	var device = cfg.Device(serialNumber, config.Device{
+		Frequency: 400, MinFrequency: 100, MaxFrequency: 800, Timeout: 2 * time.Second, Chips: 1,
+	})
+	return NewBM1397Controller(
+		cf.IFTDIDriver.NewController(cfg, context, cf, transport, serialNumber),
+		device.MinFrequency, device.MaxFrequency, device.Frequency, device.Chips, device.Timeout,
+		cfg.SoftStart,
+	)
+}
@@ -0,0 +1,414 @@
+// Package emulator provides software stand-ins for ASIC chains, speaking the chip protocol over a base.Transport so
+// controllers can be developed and tested without hardware.
+package emulator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"github.com/fernandosanchezjr/goasicminer/devices/gekko/utils"
+	"github.com/howeyc/crc16"
+	"math/big"
+	"sync"
+)
+
+const (
+	BM1387InitialBaudRate = 115200
+	BM1387ResponseSize    = 7
+	BM1387ChunkSize       = 4096
+	BM1387TaskQueue       = 128
+	DefaultScanWindow     = 1024
+)
+
+// Command headers of the BM1387 serial protocol, the byte after each one is the frame length.
+const (
+	bm1387Task              = 0x21
+	bm1387ChainInactiveChip = 0x41
+	bm1387SetRegister       = 0x48
+	bm1387CountChips        = 0x54
+	bm1387ChainInactive     = 0x55
+	bm1387SetRegisterAll    = 0x58
+)
+
+const (
+	bm1387ResetPin       = 0x2
+	bm1387NonceResponse  = 0x80
+	bm1387ChipIdResponse = 0x07
+	bm1387FrequencyReg   = 0x0C
+)
+
+// BM1387BusyNonces are the nonces every chip returns for the busy work controllers send while warming up.
+var BM1387BusyNonces = []uint32{0x83ea0372, 0x09f86be1}
+
+var bm1387ChipId = []byte{0x13, 0x87, 0x90, 0x00}
+
+var ErrClosed = errors.New("emulator closed")
+
+// EasyTarget is a share target with 8 leading zero bits, about one share every 256 hashes.
+var EasyTarget = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 248), big.NewInt(1))
+
+type bm1387Job struct {
+	jobId     byte
+	tail      [12]byte
+	midstates [][8]uint32
+}
+
+// BM1387Chain emulates a chain of BM1387 chips behind a UART. Commands are answered as they are written, while task
+// frames are hashed in the background: every chip scans the first ScanWindow nonces of its slice of the nonce range
+// for each midstate and returns those whose header hash meets the target, much like a chip whose ticket mask is set
+// to an easy difficulty.
+type BM1387Chain struct {
+	ScanWindow uint32
+	chipCount  int
+	target     [32]byte
+	mtx        sync.Mutex
+	open       bool
+	baudRate   int
+	addresses  []byte
+	addressed  int
+	frequency  []float64
+	registers  map[byte]uint32
+	output     []byte
+	tasks      int
+	crcErrors  int
+	jobs       chan *bm1387Job
+	quit       chan struct{}
+	waiter     sync.WaitGroup
+}
+
+func NewBM1387Chain(chipCount int, target *big.Int) *BM1387Chain {
+	bc := &BM1387Chain{
+		ScanWindow: DefaultScanWindow,
+		chipCount:  chipCount,
+		open:       true,
+		baudRate:   BM1387InitialBaudRate,
+		addresses:  make([]byte, chipCount),
+		frequency:  make([]float64, chipCount),
+		registers:  map[byte]uint32{},
+		jobs:       make(chan *bm1387Job, BM1387TaskQueue),
+		quit:       make(chan struct{}),
+	}
+	var targetBytes = target.Bytes()
+	copy(bc.target[len(bc.target)-len(targetBytes):], targetBytes)
+	bc.waiter.Add(1)
+	go bc.hashLoop()
+	return bc
+}
+
+// Read returns the pending responses, whole ones only, and never blocks.
+func (bc *BM1387Chain) Read(data []byte) (int, error) {
+	bc.mtx.Lock()
+	defer bc.mtx.Unlock()
+	if !bc.open {
+		return 0, ErrClosed
+	}
+	var size = len(bc.output)
+	if size > len(data) {
+		size = len(data) - len(data)%BM1387ResponseSize
+	}
+	copy(data, bc.output[:size])
+	bc.output = bc.output[size:]
+	return size, nil
+}
+
+// Write parses every frame in data. Like the chips it drops whatever follows the last frame it can make sense of,
+// such as the zero padding of a task buffer.
+func (bc *BM1387Chain) Write(data []byte) (int, error) {
+	bc.mtx.Lock()
+	if !bc.open {
+		bc.mtx.Unlock()
+		return 0, ErrClosed
+	}
+	var jobs []*bm1387Job
+	for frame := data; len(frame) >= 2; {
+		var size = int(frame[1])
+		if size < 5 || size > len(frame) || !bc.knownCommand(frame[0]) {
+			break
+		}
+		if job := bc.command(frame[:size]); job != nil {
+			jobs = append(jobs, job)
+		}
+		frame = frame[size:]
+	}
+	bc.mtx.Unlock()
+	for _, job := range jobs {
+		select {
+		case bc.jobs <- job:
+		case <-bc.quit:
+			return 0, ErrClosed
+		}
+	}
+	return len(data), nil
+}
+
+func (bc *BM1387Chain) Close() error {
+	bc.mtx.Lock()
+	if !bc.open {
+		bc.mtx.Unlock()
+		return nil
+	}
+	bc.open = false
+	close(bc.quit)
+	bc.mtx.Unlock()
+	bc.waiter.Wait()
+	return nil
+}
+
+func (bc *BM1387Chain) Reset() error {
+	return nil
+}
+
+func (bc *BM1387Chain) SetBaudRate(baudRate int) error {
+	bc.mtx.Lock()
+	defer bc.mtx.Unlock()
+	bc.baudRate = baudRate
+	return nil
+}
+
+func (bc *BM1387Chain) Purge() error {
+	bc.mtx.Lock()
+	defer bc.mtx.Unlock()
+	bc.output = nil
+	return nil
+}
+
+func (bc *BM1387Chain) SetLatencyTimer(int) error {
+	return nil
+}
+
+// SetGPIO holds the chips in reset while the reset pin is driven low, which clears their addresses and registers.
+func (bc *BM1387Chain) SetGPIO(outputs, levels byte) error {
+	bc.mtx.Lock()
+	defer bc.mtx.Unlock()
+	if outputs&bm1387ResetPin != 0 && levels&bm1387ResetPin == 0 {
+		bc.addresses = make([]byte, bc.chipCount)
+		bc.addressed = 0
+		bc.frequency = make([]float64, bc.chipCount)
+		bc.registers = map[byte]uint32{}
+		bc.output = nil
+	}
+	return nil
+}
+
+func (bc *BM1387Chain) ReadChunkSize() (int, error) {
+	return BM1387ChunkSize, nil
+}
+
+func (bc *BM1387Chain) WriteChunkSize() (int, error) {
+	return BM1387ChunkSize, nil
+}
+
+func (bc *BM1387Chain) BaudRate() int {
+	bc.mtx.Lock()
+	defer bc.mtx.Unlock()
+	return bc.baudRate
+}
+
+// Addressed reports how many chips were given an address by chain inactive commands since the last reset.
+func (bc *BM1387Chain) Addressed() int {
+	bc.mtx.Lock()
+	defer bc.mtx.Unlock()
+	return bc.addressed
+}
+
+// Frequency is the last frequency written to a chip, or 0 if none was since the last reset.
+func (bc *BM1387Chain) Frequency(chip int) float64 {
+	bc.mtx.Lock()
+	defer bc.mtx.Unlock()
+	return bc.frequency[chip]
+}
+
+// Register is the last value broadcast to a register of every chip.
+func (bc *BM1387Chain) Register(register byte) uint32 {
+	bc.mtx.Lock()
+	defer bc.mtx.Unlock()
+	return bc.registers[register]
+}
+
+// Tasks counts the task frames hashed so far.
+func (bc *BM1387Chain) Tasks() int {
+	bc.mtx.Lock()
+	defer bc.mtx.Unlock()
+	return bc.tasks
+}
+
+// CRCErrors counts the frames dropped for a bad checksum.
+func (bc *BM1387Chain) CRCErrors() int {
+	bc.mtx.Lock()
+	defer bc.mtx.Unlock()
+	return bc.crcErrors
+}
+
+func (bc *BM1387Chain) knownCommand(header byte) bool {
+	switch header {
+	case bm1387Task, bm1387ChainInactiveChip, bm1387SetRegister, bm1387CountChips, bm1387ChainInactive,
+		bm1387SetRegisterAll:
+		return true
+	}
+	return false
+}
+
+// chipIndex maps an address handed out by chain inactive to the chip holding it.
+func (bc *BM1387Chain) chipIndex(address byte) int {
+	for i := 0; i < bc.addressed; i++ {
+		if bc.addresses[i] == address {
+			return i
+		}
+	}
+	return -1
+}
+
+func validCRC5(frame []byte) bool {
+	var check = append([]byte{}, frame...)
+	utils.BMCRC(check)
+	return check[len(check)-1] == frame[len(frame)-1]&0x1f
+}
+
+func validCRC16(frame []byte) bool {
+	var size = len(frame)
+	return crc16.ChecksumCCITTFalse(frame[:size-2]) == binary.BigEndian.Uint16(frame[size-2:])
+}
+
+// respond queues a response. The controllers never check response checksums, so the last byte is left as the
+// trailer a chain at reset sends rather than a computed CRC.
+func (bc *BM1387Chain) respond(response []byte, trailer byte) {
+	response[len(response)-1] = trailer
+	bc.output = append(bc.output, response...)
+}
+
+// command applies a frame to the chain, returning the job to hash for task frames. Callers must hold the lock.
+func (bc *BM1387Chain) command(frame []byte) *bm1387Job {
+	if frame[0] == bm1387Task {
+		if !validCRC16(frame) {
+			bc.crcErrors += 1
+			return nil
+		}
+		return bc.parseTask(frame)
+	}
+	if !validCRC5(frame) {
+		bc.crcErrors += 1
+		return nil
+	}
+	switch frame[0] {
+	case bm1387CountChips:
+		for i := 0; i < bc.chipCount; i++ {
+			var response = make([]byte, BM1387ResponseSize)
+			copy(response, bm1387ChipId)
+			response[4] = bc.addresses[i]
+			bc.respond(response, bm1387ChipIdResponse)
+		}
+	case bm1387ChainInactiveChip:
+		if bc.addressed < bc.chipCount {
+			bc.addresses[bc.addressed] = frame[2]
+			bc.addressed += 1
+		}
+	case bm1387SetRegister:
+		if chip := bc.chipIndex(frame[2]); chip >= 0 && frame[3] == bm1387FrequencyReg && len(frame) == 9 {
+			if frame[7] == 0x41 {
+				bc.frequency[chip] = float64(frame[5]) * 25 / 8
+			} else {
+				bc.frequency[chip] = float64(frame[5]) * 25 / 4
+			}
+		}
+	case bm1387SetRegisterAll:
+		if len(frame) == 9 {
+			bc.registers[frame[3]] = binary.BigEndian.Uint32(frame[4:8])
+		}
+	}
+	return nil
+}
+
+func (bc *BM1387Chain) parseTask(frame []byte) *bm1387Job {
+	var count = int(frame[3])
+	if len(frame) != 20+32*count+2 {
+		bc.crcErrors += 1
+		return nil
+	}
+	var job = &bm1387Job{jobId: frame[2], midstates: make([][8]uint32, count)}
+	copy(job.tail[:], frame[8:20])
+	for i := range job.midstates {
+		// midstates are sent byte reversed, which leaves the state words last to first in big endian
+		var midstate = frame[20+32*i : 52+32*i]
+		for j := 0; j < 8; j++ {
+			job.midstates[i][j] = binary.BigEndian.Uint32(midstate[28-4*j:])
+		}
+	}
+	return job
+}
+
+func (job *bm1387Job) busy() bool {
+	return len(job.midstates) == 1 && bytes.Equal(job.tail[:], bytes.Repeat([]byte{0xff}, len(job.tail)))
+}
+
+func (bc *BM1387Chain) hashLoop() {
+	defer bc.waiter.Done()
+	for {
+		select {
+		case <-bc.quit:
+			return
+		case job := <-bc.jobs:
+			var responses = bc.hash(job)
+			bc.mtx.Lock()
+			bc.tasks += 1
+			for _, response := range responses {
+				bc.respond(response, bm1387NonceResponse)
+			}
+			bc.mtx.Unlock()
+		}
+	}
+}
+
+func nonceResponse(nonce uint32, core byte, jobId byte) []byte {
+	var response = make([]byte, BM1387ResponseSize)
+	binary.LittleEndian.PutUint32(response, nonce)
+	response[4] = core
+	response[5] = jobId
+	return response
+}
+
+// hash scans the nonce window of every chip. The header tail travels as the bits, ntime and merkle root words in
+// reverse, each already in the byte order the header is hashed in.
+func (bc *BM1387Chain) hash(job *bm1387Job) [][]byte {
+	var responses [][]byte
+	if job.busy() {
+		for i, nonce := range BM1387BusyNonces {
+			responses = append(responses, nonceResponse(nonce, byte(i), job.jobId))
+		}
+		return responses
+	}
+	var block [64]byte
+	copy(block[0:4], job.tail[8:12])
+	copy(block[4:8], job.tail[4:8])
+	copy(block[8:12], job.tail[0:4])
+	block[16] = 0x80
+	binary.BigEndian.PutUint64(block[56:], 80*8)
+	var rangeSize = uint64(1<<32) / uint64(bc.chipCount)
+	for midstate, state := range job.midstates {
+		for chip := 0; chip < bc.chipCount; chip++ {
+			var start = uint32(uint64(chip) * rangeSize)
+			for offset := uint32(0); offset < bc.ScanWindow && uint64(offset) < rangeSize; offset++ {
+				var nonce = start + offset
+				binary.LittleEndian.PutUint32(block[12:16], nonce)
+				if bc.meetsTarget(state, block[:]) {
+					responses = append(responses, nonceResponse(nonce, 0, job.jobId+byte(midstate)))
+				}
+			}
+		}
+	}
+	return responses
+}
+
+func (bc *BM1387Chain) meetsTarget(midstate [8]uint32, block []byte) bool {
+	var state = midstate
+	sha256Block(&state, block)
+	var first [32]byte
+	for i, word := range state {
+		binary.BigEndian.PutUint32(first[i*4:], word)
+	}
+	var hash = sha256.Sum256(first[:])
+	for i, j := 0, len(hash)-1; i < j; i, j = i+1, j-1 {
+		hash[i], hash[j] = hash[j], hash[i]
+	}
+	return bytes.Compare(hash[:], bc.target[:]) <= 0
+}
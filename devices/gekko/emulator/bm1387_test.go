@@ -0,0 +1,182 @@
+package emulator
+
+import (
+	"flag"
+	"github.com/fernandosanchezjr/goasicminer/devices/base"
+	"github.com/fernandosanchezjr/goasicminer/devices/gekko/protocol"
+	"github.com/fernandosanchezjr/goasicminer/node"
+	"github.com/fernandosanchezjr/goasicminer/node/nodetest"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+const testChips = 4
+
+func testWrite(t *testing.T, chain *BM1387Chain, data []byte) {
+	if _, err := chain.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testReadResponses(t *testing.T, chain *BM1387Chain, tasks int) *protocol.ResponseBlock {
+	var timeout = time.After(5 * time.Second)
+	for chain.Tasks() < tasks {
+		select {
+		case <-timeout:
+			t.Fatal("task not hashed")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	buf := make([]byte, BM1387ChunkSize)
+	read, err := chain.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rb := protocol.NewResponseBlock()
+	if err := rb.UnmarshalBinary(buf[:read]); err != nil {
+		t.Fatal(err)
+	}
+	return rb
+}
+
+func TestBM1387Chain_Commands(t *testing.T) {
+	chain := NewBM1387Chain(testChips, EasyTarget)
+	defer chain.Close()
+	countChips, _ := protocol.NewCountChips().MarshalBinary()
+	testWrite(t, chain, countChips)
+	buf := make([]byte, BM1387ChunkSize)
+	read, err := chain.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ccr := protocol.NewCountChipsResponse()
+	if err := ccr.UnmarshalBinary(buf[:read]); err != nil {
+		t.Fatal(err)
+	}
+	if len(ccr.Chips) != testChips || ccr.Chips[0] != "13879000000007" {
+		t.Fatalf("unexpected chips %v", ccr.Chips)
+	}
+	chainInactive, _ := protocol.NewChainInactive().MarshalBinary()
+	testWrite(t, chain, chainInactive)
+	cic := protocol.NewChainInactiveChip(testChips)
+	for i := 0; i < testChips; i++ {
+		cic.SetCurrentChip(i)
+		data, _ := cic.MarshalBinary()
+		testWrite(t, chain, data)
+	}
+	if chain.Addressed() != testChips {
+		t.Fatalf("addressed %d chips", chain.Addressed())
+	}
+	baud, _ := protocol.NewSetBaudGateBlockMessage(1).MarshalBinary()
+	testWrite(t, chain, baud)
+	if chain.Register(0x1C) != 0x40208180 {
+		t.Fatalf("unexpected baud register %08x", chain.Register(0x1C))
+	}
+	for i := 0; i < testChips; i++ {
+		sf := protocol.NewSetFrequency(float64(400+50*i), testChips, i)
+		data, _ := sf.MarshalBinary()
+		testWrite(t, chain, data)
+		if chain.Frequency(i) != sf.Frequency {
+			t.Fatalf("chip %d at %f, expected %f", i, chain.Frequency(i), sf.Frequency)
+		}
+	}
+	var corrupted = append([]byte{}, countChips...)
+	corrupted[len(corrupted)-1] ^= 0x01
+	testWrite(t, chain, corrupted)
+	if chain.CRCErrors() != 1 {
+		t.Fatal("corrupted frame accepted")
+	}
+	if err := chain.SetGPIO(0xf, 0x0); err != nil {
+		t.Fatal(err)
+	}
+	if chain.Addressed() != 0 || chain.Frequency(0) != 0 {
+		t.Fatal("chips kept their state through reset")
+	}
+}
+
+func TestBM1387Chain_BusyWork(t *testing.T) {
+	chain := NewBM1387Chain(testChips, EasyTarget)
+	defer chain.Close()
+	data, _ := protocol.NewTask(8, 4).MarshalBinary()
+	testWrite(t, chain, data)
+	rb := testReadResponses(t, chain, 1)
+	if rb.Count != len(BM1387BusyNonces) {
+		t.Fatalf("expected %d busy responses, got %d", len(BM1387BusyNonces), rb.Count)
+	}
+	for i := 0; i < rb.Count; i++ {
+		if !rb.Responses[i].BusyResponse() || rb.Responses[i].JobId != 8 {
+			t.Fatalf("unexpected response %+v", rb.Responses[i])
+		}
+	}
+}
+
+// TestBM1387Chain_SubmitsValidBlocks mines regtest blocks through the emulated chain, taking responses back to their
+// task and midstate the way the controller does and verifying them into submitted blocks.
+func TestBM1387Chain_SubmitsValidBlocks(t *testing.T) {
+	folder, err := ioutil.TempDir("", "goasicminer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	if err := flag.Set("home-folder", folder); err != nil {
+		t.Fatal(err)
+	}
+	server, err := nodetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.LongPollTimeout = 100 * time.Millisecond
+	n := node.NewNode(server.Config())
+	if err := n.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer n.Disconnect()
+	var work *node.Work
+	for work == nil || work.Height != 1 {
+		select {
+		case work = <-n.GetWorkChan():
+		case <-time.After(5 * time.Second):
+			t.Fatal("no work")
+		}
+	}
+	work.BigDifficulty = EasyTarget
+	chain := NewBM1387Chain(testChips, EasyTarget)
+	defer chain.Close()
+	chain.ScanWindow = 256
+	var versions = []utils.Version{work.Version, work.Version | 0x2000, work.Version | 0x4000, work.Version | 0x6000}
+	var task = node.NewTask(len(versions), true)
+	task.Update(work, versions)
+	var jobId = byte(12)
+	var pendingTask = protocol.NewTask(jobId, len(versions))
+	pendingTask.Update(task)
+	data, _ := pendingTask.MarshalBinary()
+	testWrite(t, chain, data)
+	rb := testReadResponses(t, chain, 1)
+	if rb.Count == 0 {
+		t.Fatal("no nonces found")
+	}
+	var first = rb.Responses[0]
+	for i := 0; i < rb.Count; i++ {
+		var response = rb.Responses[i]
+		var midstate = response.JobId % len(versions)
+		if response.JobId-midstate != int(jobId) {
+			t.Fatalf("response for job %d", response.JobId)
+		}
+		var result = base.NewTaskResult()
+		pendingTask.UpdateResult(result, response.Nonce, midstate)
+		result.Verify("emulator")
+	}
+	submissions := server.Submissions()
+	if server.Height() != 1 || len(submissions) == 0 || !submissions[0].Accepted() {
+		t.Fatal("block not accepted")
+	}
+	var header = submissions[0].Block.Header
+	if header.Nonce != uint32(first.Nonce) ||
+		utils.Version(header.Version) != versions[first.JobId%len(versions)] {
+		t.Fatalf("submitted nonce %08x version %08x", header.Nonce, header.Version)
+	}
+}
@@ -3,11 +3,12 @@ package gekko
 import (
 	"github.com/fernandosanchezjr/goasicminer/config"
 	"github.com/fernandosanchezjr/goasicminer/devices/base"
+	"github.com/fernandosanchezjr/goasicminer/generators"
 	"testing"
 )
 
 func TestGekkoCatalog_FindDevices(t *testing.T) {
-	context := base.NewContext()
+	context := base.NewContext(func() generators.Generator { return generators.NewUsedNTimes() }, &base.Supervisor{})
 	defer context.Close()
 	cfg := &config.Config{}
 	gekko := NewGekkoCatalog()
@@ -8,21 +8,25 @@ import (
 )
 
 type NewPac struct {
-	base.IDriver
+	base.IFTDIDriver
 }
 
 func NewNewPac() *NewPac {
 	return &NewPac{
-		IDriver: base.NewDriver(0x6015, 0x0403, "GekkoScience",
+		IFTDIDriver: base.NewDriver(0x6015, 0x0403, "GekkoScience",
 			"NewPac Bitcoin Miner", ftdi.ChannelA),
 	}
 }
 
 func (np *NewPac) NewController(
-	config *config.Config, context *base.Context, _ base.IDriver, device *ftdi.Device, serialNumber string,
+	cfg *config.Config, context *base.Context, _ base.IDriver, transport base.Transport, serialNumber string,
 ) base.IController {
+	var device = cfg.Device(serialNumber, config.Device{
+		Frequency: 550, MinFrequency: 100, MaxFrequency: 700, Timeout: 2 * time.Second, Chips: 2,
+	})
 	return NewBM1387Controller(
-		np.IDriver.NewController(config, context, np, device, serialNumber),
-		100, 700, 550, 2, 2*time.Second,
+		np.IFTDIDriver.NewController(cfg, context, np, transport, serialNumber),
+		device.MinFrequency, device.MaxFrequency, device.Frequency, device.Chips, device.Timeout, cfg.Tuning,
+		cfg.SoftStart,
 	)
 }
@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"github.com/fernandosanchezjr/goasicminer/devices/gekko/utils"
+)
+
+// BM1397 packets start with a preamble, then a header byte made of a type, a group and a command.
+const (
+	bm1397TypeJob       = 0x20
+	bm1397TypeCmd       = 0x40
+	bm1397GroupAll      = 0x10
+	bm1397CmdSetAddress = 0x00
+	bm1397CmdWrite      = 0x01
+	bm1397CmdRead       = 0x02
+	bm1397CmdInactive   = 0x03
+)
+
+// BM1397 registers
+const (
+	BM1397ChipAddressReg  = 0x00
+	BM1397PLL0Reg         = 0x08
+	BM1397TicketMaskReg   = 0x14
+	BM1397MiscControlReg  = 0x18
+	BM1397CoreControlReg  = 0x3C
+	BM1397AnalogMuxReg    = 0x54
+	BM1397IODriverReg     = 0x58
+	BM1397PLL0DividerReg  = 0x70
+	BM1397TicketMask256   = 0x000000FF
+	BM1397PLL0DividerInit = 0x0F0F0F00
+)
+
+var (
+	BM1397Preamble         = []byte{0x55, 0xAA}
+	BM1397ResponsePreamble = []byte{0xAA, 0x55}
+)
+
+type BM1397Command struct {
+	data []byte
+}
+
+// newBM1397Command frames a command as preamble, header, length, payload and a crc5 over all but the preamble.
+func newBM1397Command(header byte, payload ...byte) *BM1397Command {
+	data := append(append([]byte{}, BM1397Preamble...), header, byte(len(payload)+3))
+	data = append(append(data, payload...), 0x00)
+	utils.BMCRC(data[len(BM1397Preamble):])
+	return &BM1397Command{data: data}
+}
+
+// NewBM1397ReadRegister asks every chip for a register, the chip address register doubling as chip count.
+func NewBM1397ReadRegister(register byte) *BM1397Command {
+	return newBM1397Command(bm1397TypeCmd|bm1397GroupAll|bm1397CmdRead, 0x00, register)
+}
+
+func NewBM1397ChainInactive() *BM1397Command {
+	return newBM1397Command(bm1397TypeCmd|bm1397GroupAll|bm1397CmdInactive, 0x00, 0x00)
+}
+
+// NewBM1397SetAddress gives the first chip without an address the one passed.
+func NewBM1397SetAddress(address byte) *BM1397Command {
+	return newBM1397Command(bm1397TypeCmd|bm1397CmdSetAddress, address, 0x00)
+}
+
+func NewBM1397WriteRegister(address byte, register byte, value uint32) *BM1397Command {
+	var data [4]byte
+	binary.BigEndian.PutUint32(data[:], value)
+	return newBM1397Command(bm1397TypeCmd|bm1397CmdWrite, address, register, data[0], data[1], data[2], data[3])
+}
+
+func NewBM1397WriteRegisterAll(register byte, value uint32) *BM1397Command {
+	var data [4]byte
+	binary.BigEndian.PutUint32(data[:], value)
+	return newBM1397Command(bm1397TypeCmd|bm1397GroupAll|bm1397CmdWrite, 0x00, register, data[0], data[1], data[2],
+		data[3])
+}
+
+func (c *BM1397Command) MarshalBinary() ([]byte, error) {
+	return c.data, nil
+}
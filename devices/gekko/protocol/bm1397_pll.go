@@ -0,0 +1,68 @@
+package protocol
+
+import (
+	"math"
+)
+
+const (
+	BM1397RefClock    = 25.0
+	BM1397MinFBDiv    = 16
+	BM1397MaxFBDiv    = 235
+	BM1397MaxRefDiv   = 2
+	BM1397MaxPostDiv  = 7
+	BM1397HighVCO     = 2400.0
+	bm1397PLLEnable   = 0x40
+	bm1397PLLHighBand = 0x10
+)
+
+// BM1397PLL holds the dividers of PLL0, which clocks the cores at RefClock * FBDiv / (RefDiv * PostDiv1 * PostDiv2).
+type BM1397PLL struct {
+	FBDiv     int
+	RefDiv    int
+	PostDiv1  int
+	PostDiv2  int
+	Frequency float64
+}
+
+// NewBM1397PLL picks the dividers reaching the closest frequency to the one asked for. The second post divider may
+// not exceed the first.
+func NewBM1397PLL(frequency float64) *BM1397PLL {
+	return NewBM1397PLLWithin(frequency, BM1397MinFBDiv, BM1397MaxFBDiv)
+}
+
+// NewBM1397PLLWithin picks dividers like NewBM1397PLL with the feedback divider bounded, for later chips sharing the
+// PLL layout over a narrower range.
+func NewBM1397PLLWithin(frequency float64, minFBDiv, maxFBDiv int) *BM1397PLL {
+	var best *BM1397PLL
+	for refDiv := 1; refDiv <= BM1397MaxRefDiv; refDiv++ {
+		for postDiv1 := BM1397MaxPostDiv; postDiv1 > 0; postDiv1-- {
+			for postDiv2 := postDiv1; postDiv2 > 0; postDiv2-- {
+				var divider = float64(refDiv * postDiv1 * postDiv2)
+				var fbDiv = int(math.Round(frequency * divider / BM1397RefClock))
+				if fbDiv < minFBDiv || fbDiv > maxFBDiv {
+					continue
+				}
+				var actual = BM1397RefClock * float64(fbDiv) / divider
+				if best == nil || math.Abs(actual-frequency) < math.Abs(best.Frequency-frequency) {
+					best = &BM1397PLL{FBDiv: fbDiv, RefDiv: refDiv, PostDiv1: postDiv1, PostDiv2: postDiv2,
+						Frequency: actual}
+				}
+			}
+		}
+	}
+	return best
+}
+
+func (p *BM1397PLL) VCO() float64 {
+	return BM1397RefClock * float64(p.FBDiv) / float64(p.RefDiv)
+}
+
+// Register is the PLL0 parameter register value, enabling the PLL on its high band for fast VCOs.
+func (p *BM1397PLL) Register() uint32 {
+	var flags uint32 = bm1397PLLEnable
+	if p.VCO() >= BM1397HighVCO {
+		flags |= bm1397PLLHighBand
+	}
+	var postDiv = uint32((p.PostDiv1-1)&0x7)<<4 | uint32((p.PostDiv2-1)&0x7)
+	return flags<<24 | uint32(p.FBDiv)<<16 | uint32(p.RefDiv)<<8 | postDiv
+}
@@ -0,0 +1,96 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+)
+
+const (
+	BM1397ResponseSize   = 9
+	BM1397ChipId         = 0x1397
+	bm1397NonceResponse  = 0x80
+	bm1397MidstateMask   = BM1397JobIdStep - 1
+	bm1397MaxPendingRead = BM1397ResponseSize - 1
+)
+
+type BM1397Response struct {
+	Nonce    utils.Nonce32
+	JobId    int
+	Midstate int
+}
+
+// BM1397ResponseBlock decodes the responses of a read. Responses are found by their preamble, and a response cut
+// short by the end of a read is kept for the next one.
+type BM1397ResponseBlock struct {
+	Responses []*BM1397Response
+	Count     int
+	pending   []byte
+}
+
+func NewBM1397ResponseBlock() *BM1397ResponseBlock {
+	rb := &BM1397ResponseBlock{Responses: make([]*BM1397Response, MaxTaskResponses)}
+	for i := range rb.Responses {
+		rb.Responses[i] = &BM1397Response{}
+	}
+	return rb
+}
+
+func (rb *BM1397ResponseBlock) UnmarshalBinary(data []byte) error {
+	rb.Count = 0
+	data = append(rb.pending, data...)
+	rb.pending = nil
+	for len(data) >= BM1397ResponseSize && rb.Count < len(rb.Responses) {
+		var start = bytes.Index(data, BM1397ResponsePreamble)
+		if start < 0 {
+			data = data[len(data)-1:]
+			break
+		}
+		data = data[start:]
+		if len(data) < BM1397ResponseSize {
+			break
+		}
+		var response = data[:BM1397ResponseSize]
+		data = data[BM1397ResponseSize:]
+		if response[8]&bm1397NonceResponse == 0 {
+			continue
+		}
+		var current = rb.Responses[rb.Count]
+		current.Nonce = utils.Nonce32(response[2]) | utils.Nonce32(response[3])<<8 |
+			utils.Nonce32(response[4])<<16 | utils.Nonce32(response[5])<<24
+		current.JobId = int(response[7]) &^ bm1397MidstateMask
+		current.Midstate = int(response[7]) & bm1397MidstateMask
+		rb.Count += 1
+	}
+	if len(data) > 0 && len(data) <= bm1397MaxPendingRead {
+		rb.pending = append([]byte{}, data...)
+	}
+	return nil
+}
+
+// BM1397ChipsResponse lists the chips answering a chip address register read.
+type BM1397ChipsResponse struct {
+	Chips []string
+}
+
+func NewBM1397ChipsResponse() *BM1397ChipsResponse {
+	return &BM1397ChipsResponse{}
+}
+
+func (cr *BM1397ChipsResponse) UnmarshalBinary(data []byte) error {
+	if len(data)%BM1397ResponseSize != 0 {
+		return fmt.Errorf("invalid BM1397ChipsResponse length")
+	}
+	for ; len(data) > 0; data = data[BM1397ResponseSize:] {
+		var response = data[:BM1397ResponseSize]
+		if !bytes.HasPrefix(response, BM1397ResponsePreamble) {
+			return fmt.Errorf("invalid BM1397ChipsResponse preamble")
+		}
+		if chipId := int(response[2])<<8 | int(response[3]); chipId != BM1397ChipId {
+			return fmt.Errorf("unexpected chip %04x", chipId)
+		}
+		cr.Chips = append(cr.Chips, hex.EncodeToString(response))
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package protocol
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/devices/base"
+	"github.com/fernandosanchezjr/goasicminer/node"
+	"github.com/howeyc/crc16"
+)
+
+const (
+	BM1397JobIdStep = 4
+	BM1397MaxJobId  = 0x80
+	bm1397JobFields = 18
+)
+
+// BM1397Task is a job carrying the header tail with a starting nonce and one midstate per rolled version. The chip
+// rolls through the midstates itself and reports which one a nonce belongs to in the low bits of the job id, so job
+// ids step by BM1397JobIdStep.
+type BM1397Task struct {
+	base.ITask
+	jobId byte
+	data  []byte
+	size  int
+}
+
+func NewBM1397Task(jobId byte, versionsCount int) *BM1397Task {
+	t := &BM1397Task{ITask: base.NewTask(int(jobId), versionsCount), jobId: jobId,
+		data: make([]byte, len(BM1397Preamble)+4+bm1397JobFields+32*versionsCount)}
+	copy(t.data, BM1397Preamble)
+	t.data[2] = bm1397TypeJob | bm1397CmdWrite
+	return t
+}
+
+func (t *BM1397Task) crc() {
+	checkSum := crc16.ChecksumCCITTFalse(t.data[len(BM1397Preamble) : t.size-2])
+	t.data[t.size-2] = byte(checkSum>>8) & 0xff
+	t.data[t.size-1] = byte(checkSum & 0xff)
+}
+
+// MarshalBinary returns the job, or nothing before the first update.
+func (t *BM1397Task) MarshalBinary() ([]byte, error) {
+	t.Lock()
+	defer t.Unlock()
+	return t.data[:t.size], nil
+}
+
+// Update takes a reversed node task, whose endstate holds the nbits, ntime and merkle root tail words last to first
+// and each byte swapped, which puts them back in header order one word at a time.
+func (t *BM1397Task) Update(task *node.Task) {
+	t.Lock()
+	defer t.Unlock()
+	var versionCount = len(task.Midstates)
+	var fields = t.data[4:]
+	t.size = len(BM1397Preamble) + 4 + bm1397JobFields + 32*versionCount
+	t.data[3] = byte(t.size - len(BM1397Preamble))
+	fields[0] = t.jobId
+	fields[1] = byte(versionCount)
+	fields[2], fields[3], fields[4], fields[5] = 0, 0, 0, 0
+	copy(fields[6:10], task.Endstate[4:8])
+	copy(fields[10:14], task.Endstate[8:12])
+	copy(fields[14:18], task.Endstate[12:16])
+	for i, midstate := range task.Midstates {
+		copy(fields[bm1397JobFields+32*i:], midstate[:])
+	}
+	t.crc()
+	t.ITask.Update(task)
+}
+
+// BM1397TaskPool cycles through one task for every job id the chips can report.
+type BM1397TaskPool struct {
+	Tasks   []*BM1397Task
+	current int
+}
+
+func NewBM1397TaskPool(versionsCount int) *BM1397TaskPool {
+	var tp = &BM1397TaskPool{Tasks: make([]*BM1397Task, BM1397MaxJobId/BM1397JobIdStep)}
+	for i := range tp.Tasks {
+		tp.Tasks[i] = NewBM1397Task(byte(i*BM1397JobIdStep), versionsCount)
+	}
+	return tp
+}
+
+func (tp *BM1397TaskPool) GetTask(jobId int) *BM1397Task {
+	if jobId < 0 || jobId >= BM1397MaxJobId || jobId%BM1397JobIdStep != 0 {
+		return nil
+	}
+	return tp.Tasks[jobId/BM1397JobIdStep]
+}
+
+func (tp *BM1397TaskPool) Next() *BM1397Task {
+	var next = tp.Tasks[tp.current]
+	tp.current = (tp.current + 1) % len(tp.Tasks)
+	return next
+}
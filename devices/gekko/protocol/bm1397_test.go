@@ -0,0 +1,109 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/fernandosanchezjr/goasicminer/node"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"github.com/howeyc/crc16"
+	"math"
+	"testing"
+)
+
+func TestBM1397Command_MarshalBinary(t *testing.T) {
+	var expected = []struct {
+		command *BM1397Command
+		data    string
+	}{
+		{NewBM1397ReadRegister(BM1397ChipAddressReg), "55aa520500000a"},
+		{NewBM1397ChainInactive(), "55aa5305000003"},
+		{NewBM1397WriteRegisterAll(BM1397CoreControlReg, 0x80008540), "55aa5109003c800085400c"},
+	}
+	for _, e := range expected {
+		data, _ := e.command.MarshalBinary()
+		if hex.EncodeToString(data) != e.data {
+			t.Fatalf("encoded %x, expected %s", data, e.data)
+		}
+	}
+}
+
+func TestNewBM1397PLL(t *testing.T) {
+	for _, frequency := range []float64{100, 200, 400, 487.5, 650, 800} {
+		var pll = NewBM1397PLL(frequency)
+		if pll == nil || math.Abs(pll.Frequency-frequency) > 1 {
+			t.Fatalf("%f reached %+v", frequency, pll)
+		}
+		if pll.PostDiv2 > pll.PostDiv1 || pll.FBDiv < BM1397MinFBDiv || pll.FBDiv > BM1397MaxFBDiv {
+			t.Fatalf("invalid dividers %+v", pll)
+		}
+		var actual = BM1397RefClock * float64(pll.FBDiv) / float64(pll.RefDiv*pll.PostDiv1*pll.PostDiv2)
+		if actual != pll.Frequency {
+			t.Fatalf("dividers %+v reach %f", pll, actual)
+		}
+	}
+	var pll = &BM1397PLL{FBDiv: 112, RefDiv: 1, PostDiv1: 7, PostDiv2: 1}
+	if pll.Register() != 0x50700160 {
+		t.Fatalf("unexpected register %08x", pll.Register())
+	}
+}
+
+func TestBM1397Task_Update(t *testing.T) {
+	var task = node.NewTask(2, true)
+	var header [80]byte
+	for i := range header {
+		header[i] = byte(i)
+	}
+	copy(task.PlainHeader[:], header[:])
+	copy(task.Endstate[:], header[64:])
+	for j, k := 0, len(task.Endstate)-1; j < k; j, k = j+1, k-1 {
+		task.Endstate[j], task.Endstate[k] = task.Endstate[k], task.Endstate[j]
+	}
+	task.Versions = []utils.Version{0x20000000, 0x20002000}
+	task.Midstates = [][32]byte{{1}, {2}}
+	var bt = NewBM1397Task(8, 2)
+	bt.Update(task)
+	data, _ := bt.MarshalBinary()
+	if len(data) != 2+4+18+64 || int(data[3]) != len(data)-2 || data[2] != 0x21 || data[4] != 8 || data[5] != 2 {
+		t.Fatalf("unexpected job header %x", data[:6])
+	}
+	// the header tail goes out in hashing order: merkle root tail, ntime and nbits words byte swapped
+	var wire = append([]byte{}, header[64:76]...)
+	utils.SwapUint32Bytes(wire)
+	if !bytes.Equal(data[10:14], wire[8:12]) || !bytes.Equal(data[14:18], wire[4:8]) ||
+		!bytes.Equal(data[18:22], wire[0:4]) {
+		t.Fatalf("unexpected header tail %x", data[10:22])
+	}
+	if data[22] != 1 || data[54] != 2 {
+		t.Fatal("midstates out of place")
+	}
+	if crc16.ChecksumCCITTFalse(data[2:len(data)-2]) != uint16(data[len(data)-2])<<8|uint16(data[len(data)-1]) {
+		t.Fatal("invalid crc")
+	}
+}
+
+func TestBM1397ResponseBlock_UnmarshalBinary(t *testing.T) {
+	data, err := hex.DecodeString("00aa5578563412000a9faa551397180000000655aa5501020304000d80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rb := NewBM1397ResponseBlock()
+	if err := rb.UnmarshalBinary(data[:23]); err != nil {
+		t.Fatal(err)
+	}
+	if rb.Count != 1 || rb.Responses[0].Nonce != 0x12345678 || rb.Responses[0].JobId != 8 ||
+		rb.Responses[0].Midstate != 2 {
+		t.Fatalf("unexpected responses %d %+v", rb.Count, rb.Responses[0])
+	}
+	// the response cut by the first read completes with the second
+	if err := rb.UnmarshalBinary(data[23:]); err != nil {
+		t.Fatal(err)
+	}
+	if rb.Count != 1 || rb.Responses[0].Nonce != 0x04030201 || rb.Responses[0].JobId != 12 ||
+		rb.Responses[0].Midstate != 1 {
+		t.Fatalf("unexpected responses %d %+v", rb.Count, rb.Responses[0])
+	}
+	cr := NewBM1397ChipsResponse()
+	if err := cr.UnmarshalBinary(data[10:19]); err != nil || len(cr.Chips) != 1 {
+		t.Fatalf("chips %v: %v", cr.Chips, err)
+	}
+}
@@ -20,3 +20,18 @@ func (tr *TaskResponse) UnmarshalBinary(data []byte) error {
 func (tr *TaskResponse) BusyResponse() bool {
 	return tr.Nonce == 0x83ea0372 || tr.Nonce == 0x09f86be1
 }
+
+// ChipIndex attributes a nonce to the chip that found it. Chips split the nonce range by their address, so the top
+// byte of a nonce falls in the address slice of its finder.
+func (tr *TaskResponse) ChipIndex(chipCount int) int {
+	var chip = int(tr.Nonce>>24) / (0x100 / chipCount)
+	if chip >= chipCount {
+		chip = chipCount - 1
+	}
+	return chip
+}
+
+// CoreIndex attributes a nonce to a core of its chip, from the address bits below the chip address.
+func (tr *TaskResponse) CoreIndex() int {
+	return int(tr.Nonce>>17) & 0x7f
+}
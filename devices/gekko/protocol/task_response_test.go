@@ -0,0 +1,39 @@
+package protocol
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"testing"
+)
+
+func TestTaskResponse_ChipIndex(t *testing.T) {
+	var expected = []struct {
+		nonce     utils.Nonce32
+		chipCount int
+		chip      int
+	}{
+		{0x00ffffff, 12, 0},
+		{0x15000000, 12, 1},
+		{0xe7123456, 12, 11},
+		{0xffffffff, 12, 11},
+		{0x7fffffff, 2, 0},
+		{0x80000000, 2, 1},
+		{0xffffffff, 1, 0},
+	}
+	for _, e := range expected {
+		var tr = &TaskResponse{Nonce: e.nonce}
+		if chip := tr.ChipIndex(e.chipCount); chip != e.chip {
+			t.Fatalf("%s attributed to chip %d of %d, expected %d", e.nonce, chip, e.chipCount, e.chip)
+		}
+	}
+}
+
+func TestTaskResponse_CoreIndex(t *testing.T) {
+	var tr = &TaskResponse{Nonce: 0xabfe0000 | 0x1ffff}
+	if core := tr.CoreIndex(); core != 0x7f {
+		t.Fatalf("attributed to core %d", core)
+	}
+	tr.Nonce = 0xff020000
+	if core := tr.CoreIndex(); core != 1 {
+		t.Fatalf("attributed to core %d", core)
+	}
+}
@@ -8,27 +8,25 @@ import (
 )
 
 type R606 struct {
-	base.IDriver
+	base.IFTDIDriver
 }
 
 func NewR606() *R606 {
 	return &R606{
-		IDriver: base.NewDriver(0x6015, 0x0403, "GekkoScience",
+		IFTDIDriver: base.NewDriver(0x6015, 0x0403, "GekkoScience",
 			"R606 Bitcoin Miner", ftdi.ChannelA),
 	}
 }
 
 func (r606 *R606) NewController(
-	config *config.Config, context *base.Context, _ base.IDriver, device *ftdi.Device, serialNumber string,
+	cfg *config.Config, context *base.Context, _ base.IDriver, transport base.Transport, serialNumber string,
 ) base.IController {
-	var frequency = 700.0
-	for _, cfg := range config.R606 {
-		if cfg.Serial == serialNumber {
-			frequency = cfg.Frequency
-		}
-	}
+	var device = cfg.Device(serialNumber, config.Device{
+		Frequency: 700, MinFrequency: 200, MaxFrequency: 1200, Timeout: 1000 * time.Millisecond, Chips: 12,
+	})
 	return NewBM1387Controller(
-		r606.IDriver.NewController(config, context, r606, device, serialNumber),
-		200, 1200, frequency, 12, 1000*time.Millisecond,
+		r606.IFTDIDriver.NewController(cfg, context, r606, transport, serialNumber),
+		device.MinFrequency, device.MaxFrequency, device.Frequency, device.Chips, device.Timeout, cfg.Tuning,
+		cfg.SoftStart,
 	)
 }
@@ -3,6 +3,7 @@ package gekko
 import (
 	"github.com/fernandosanchezjr/goasicminer/config"
 	"github.com/fernandosanchezjr/goasicminer/devices/base"
+	"github.com/fernandosanchezjr/goasicminer/generators"
 	"github.com/fernandosanchezjr/goasicminer/stratum"
 	"testing"
 	"time"
@@ -14,7 +15,7 @@ func TestR606_Mine(t *testing.T) {
 		t.Fatal(err)
 	}
 	cfg := &config.Config{}
-	context := base.NewContext()
+	context := base.NewContext(func() generators.Generator { return generators.NewUsedNTimes() }, &base.Supervisor{})
 	defer context.Close()
 	gekko := NewGekkoCatalog()
 	if _, err := gekko.FindControllers(cfg, context); err != nil {
@@ -0,0 +1,32 @@
+package gekko
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"github.com/fernandosanchezjr/goasicminer/devices/base"
+	"github.com/ziutek/ftdi"
+	"time"
+)
+
+type R909 struct {
+	base.IFTDIDriver
+}
+
+func NewR909() *R909 {
+	return &R909{
+		IFTDIDriver: base.NewDriver(0x6015, 0x0403, "GekkoScience",
+			"R909 Bitcoin Miner", ftdi.ChannelA),
+	}
+}
+
+func (r909 *R909) NewController(
+	cfg *config.Config, context *base.Context, _ base.IDriver, transport base.Transport, serialNumber string,
+) base.IController {
+	var device = cfg.Device(serialNumber, config.Device{
+		Frequency: 450, MinFrequency: 100, MaxFrequency: 800, Timeout: 2 * time.Second, Chips: 8,
+	})
+	return NewBM1397Controller(
+		r909.IFTDIDriver.NewController(cfg, context, r909, transport, serialNumber),
+		device.MinFrequency, device.MaxFrequency, device.Frequency, device.Chips, device.Timeout,
+		cfg.SoftStart,
+	)
+}
@@ -13,3 +13,28 @@ type Generated struct {
 	Version2 utils.Version
 	Version3 utils.Version
 }
+
+// AllowedVersions packs the generated versions the template accepts at the front of dest and repeats them over the
+// rest, so chips never hash a stale midstate, falling back to the template version when none are accepted. Headers
+// with an ntime outside the template bounds are refused.
+func (g *Generated) AllowedVersions(dest []utils.Version) error {
+	var templateVersion = utils.Version(g.Work.Block.MsgBlock().Header.Version)
+	if err := g.Work.CheckHeader(g.NTime, templateVersion); err != nil {
+		return err
+	}
+	var pos int
+	for _, version := range []utils.Version{g.Version0, g.Version1, g.Version2, g.Version3} {
+		if pos < len(dest) && version != 0 && g.Work.CheckVersion(version) == nil {
+			dest[pos] = version
+			pos += 1
+		}
+	}
+	if pos == 0 && len(dest) > 0 {
+		dest[0] = templateVersion
+		pos = 1
+	}
+	for i := pos; i < len(dest); i++ {
+		dest[i] = dest[i%pos]
+	}
+	return nil
+}
@@ -73,7 +73,7 @@ func (pb *PreviouslyUsedNTimes) Next(generated *Generated, work *node.Work) {
 	var nTime utils.NTime
 
 	nTime, versions = pb.usedNTimes.Next()
-	generated.NTime = (pb.nTime & 0xffffff00) | nTime
+	generated.NTime = work.ClampNtime((pb.nTime & 0xffffff00) | nTime)
 
 	generated.Work.SetNtime(generated.NTime)
 	generated.Version0 = versions[0]
@@ -107,7 +107,7 @@ func (pb *PreviouslyUsedNTimes) generatorLoop() {
 			pb.workId = work.WorkId
 			if txCountRI == nil || txCount != work.TotalTransactions {
 				txCount = work.TotalTransactions
-				txCountRI = utils.NewRandomIndex(txCount)
+				txCountRI = utils.NewRandomIndex(utils.Max(txCount, 1))
 				txCountRI.Shuffle(pb.rng)
 			}
 			pb.usedNTimes.Reset()
@@ -72,7 +72,7 @@ func (pb *Random) Next(generated *Generated, work *node.Work) {
 		pb.versionsRI.Shuffle(pb.rng)
 		pb.nTimeReuse = 0
 	}
-	generated.NTime = pb.nTime
+	generated.NTime = work.ClampNtime(pb.nTime)
 	//generated.NTime = pb.minnTime + utils.NTime(pb.nTimeRI.Next(pb.rng))
 
 	generated.Work.SetNtime(generated.NTime)
@@ -102,7 +102,7 @@ func (pb *Random) generatorLoop() {
 			pb.workId = work.WorkId
 			if txCountRI == nil || txCount != work.TotalTransactions {
 				txCount = work.TotalTransactions
-				txCountRI = utils.NewRandomIndex(txCount)
+				txCountRI = utils.NewRandomIndex(utils.Max(txCount, 1))
 				pb.nTimeRI = utils.NewRandomIndex(int(work.Ntime - pb.minnTime + 300))
 				txCountRI.Shuffle(pb.rng)
 			}
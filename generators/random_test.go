@@ -0,0 +1,73 @@
+package generators
+
+import (
+	"flag"
+	"github.com/fernandosanchezjr/goasicminer/node"
+	"github.com/fernandosanchezjr/goasicminer/node/nodetest"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRandom_SubmitsValidBlocks(t *testing.T) {
+	folder, err := ioutil.TempDir("", "goasicminer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	if err := flag.Set("home-folder", folder); err != nil {
+		t.Fatal(err)
+	}
+	server, err := nodetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.LongPollTimeout = 100 * time.Millisecond
+	n := node.NewNode(server.Config())
+	if err := n.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer n.Disconnect()
+	generator := NewRandom()
+	defer generator.Close()
+	for height := int32(1); height <= 3; height++ {
+		var work *node.Work
+		for work == nil || work.Height != height {
+			select {
+			case work = <-n.GetWorkChan():
+			case <-time.After(5 * time.Second):
+				t.Fatalf("no work for height %d", height)
+			}
+		}
+		generator.UpdateWork(work)
+		var generated *Generated
+		for generated == nil || generated.Work.WorkId != work.WorkId {
+			generated = <-generator.GeneratorChan()
+		}
+		if generated.NTime < work.MinNtime || generated.NTime > work.MaxNtime {
+			t.Fatalf("ntime %s outside [%s, %s]", generated.NTime, work.MinNtime, work.MaxNtime)
+		}
+		var versions [4]utils.Version
+		if err := generated.AllowedVersions(versions[:]); err != nil {
+			t.Fatal(err)
+		}
+		var solved = generated.Work
+		solved.SetVersion(versions[0])
+		var header = solved.Block.MsgBlock().Header
+		header.Version = int32(solved.Version)
+		header.Timestamp = time.Unix(int64(solved.Ntime), 0)
+		if !nodetest.SolveHeader(&header) {
+			t.Fatal("could not solve header")
+		}
+		solved.SetNonce(utils.Nonce32(header.Nonce))
+		if err := solved.Submit(); err != nil {
+			t.Fatalf("generated block rejected at height %d: %v", height, err)
+		}
+	}
+	if server.Height() != 3 {
+		t.Fatalf("unexpected height %d", server.Height())
+	}
+}
@@ -62,10 +62,12 @@ func (pb *RandomNTime) ExtraNonceFound(extraNonce utils.Nonce64) {
 	pb.knownNonceChan <- extraNonce
 }
 
-func (pb *RandomNTime) Next(generated *Generated) bool {
+func (pb *RandomNTime) Next(generated *Generated, work *node.Work) bool {
 	var versions utils.Versions
 	var end bool
-	generated.NTime = pb.nTime
+	generated.Work = work.Clone()
+	generated.NTime = work.ClampNtime(pb.nTime)
+	generated.Work.SetNtime(generated.NTime)
 
 	for i := 0; i < 4; i++ {
 		if pb.versionPos >= pb.versionCount {
@@ -115,10 +117,10 @@ func (pb *RandomNTime) generatorLoop() {
 			}
 			for i = 0; i < pending; i++ {
 				var tmpGenerated = &Generated{}
-				var end = pb.Next(tmpGenerated)
+				var end = pb.Next(tmpGenerated, work)
 				pb.generatedChan <- tmpGenerated
 				if end {
-					work.Node.GenerateWorkAsync(pb.rng.Intn(work.TotalTransactions - 1))
+					work.Node.GenerateWorkAsync(pb.rng.Intn(utils.Max(work.TotalTransactions-1, 1)))
 				}
 				sent += 4
 			}
@@ -25,6 +25,7 @@ require (
 	github.com/valyala/gorpc v0.0.0-20160519171614-908281bef774
 	github.com/ziutek/ftdi v0.0.3
 	go.etcd.io/bbolt v1.3.5
+	golang.org/x/sys v0.0.0-20200202164722-d101bd2416d5
 	gonum.org/v1/gonum v0.8.1
 	gopkg.in/yaml.v2 v2.3.0
 )
@@ -3,7 +3,9 @@ package governor
 import (
 	"github.com/fernandosanchezjr/goasicminer/config"
 	"github.com/fernandosanchezjr/goasicminer/devices/base"
+	"github.com/fernandosanchezjr/goasicminer/devices/bitaxe"
 	"github.com/fernandosanchezjr/goasicminer/devices/gekko"
+	"github.com/fernandosanchezjr/goasicminer/generators"
 	"github.com/fernandosanchezjr/goasicminer/node"
 	"github.com/robfig/cron/v3"
 	log "github.com/sirupsen/logrus"
@@ -12,31 +14,75 @@ import (
 	"time"
 )
 
+// StatsInterval is how often device stats are logged, which also ships them to the backend when one is set.
+const StatsInterval = time.Minute
+
+var (
+	// DeviceScanInterval is how often devices are scanned for without hot-plug events, and HotplugScanInterval the
+	// slower scan kept alongside them in case an event is missed.
+	DeviceScanInterval  = 10 * time.Second
+	HotplugScanInterval = 2 * time.Minute
+	// HotplugSettle gives an added device time for its interfaces to bind before it is scanned for.
+	HotplugSettle = 2 * time.Second
+)
+
 type Governor struct {
-	Config   *config.Config
+	Config *config.Config
+	// Context holds the devices of the current run. Start replaces it under the governor lock before the work
+	// receiver starts, so the receiver reads it freely and everything else under the lock.
 	Context  *base.Context
 	Catalogs []base.IDriverCatalog
-	node     *node.Node
-	workQuit chan struct{}
-	wg       sync.WaitGroup
-	cron     *cron.Cron
-	mtx      sync.Mutex
-	running  bool
+	// Hotplug replaces the netlink event source when set, and is left open for the caller to close.
+	Hotplug base.HotplugSource
+	// Generator replaces the previously used ntimes task generator of every start when set.
+	Generator  func() generators.Generator
+	supervisor *base.Supervisor
+	node       *node.Node
+	pools      map[string]*node.Node
+	workQuit   chan struct{}
+	wg         sync.WaitGroup
+	cron       *cron.Cron
+	mtx        sync.Mutex
+	running    bool
 }
 
 func NewGovernor(cfg *config.Config) *Governor {
 	var governor = &Governor{
-		Context:  nil,
-		Catalogs: []base.IDriverCatalog{gekko.NewGekkoCatalog()},
-		Config:   cfg,
-		workQuit: nil,
-		cron:     cron.New(),
-		node:     node.NewNode(cfg.Node),
+		Context:    nil,
+		Catalogs:   []base.IDriverCatalog{gekko.NewGekkoCatalog(), bitaxe.NewBitaxeCatalog()},
+		Config:     cfg,
+		workQuit:   nil,
+		cron:       cron.New(),
+		node:       node.NewNode(cfg.Node),
+		supervisor: &base.Supervisor{},
 	}
+	governor.setupPools()
 	governor.setupTimers()
 	return governor
 }
 
+// setupPools creates a node for every entry of the nodes section, by the name devices are assigned to it with.
+func (g *Governor) setupPools() {
+	g.pools = map[string]*node.Node{}
+	for _, nodeCfg := range g.Config.Nodes {
+		if nodeCfg.Name == "" {
+			log.WithField("url", nodeCfg.URL).Fatal("Node of the nodes section without a name")
+		}
+		if _, found := g.pools[nodeCfg.Name]; found {
+			log.WithField("name", nodeCfg.Name).Fatal("Duplicate node name")
+		}
+		g.pools[nodeCfg.Name] = node.NewNode(nodeCfg)
+	}
+	for _, device := range g.Config.Devices {
+		if _, found := g.pools[device.Pool]; device.Pool != "" && !found {
+			log.WithFields(log.Fields{
+				"serial": device.Serial,
+				"pool":   device.Pool,
+			}).Warnln("Device assigned to an unknown node, it will get no work")
+		}
+	}
+}
+
 func (g *Governor) setupTimers() {
 	for _, downTime := range g.Config.DownTime {
 		if _, err := g.cron.AddFunc(downTime.Start, g.Stop); err != nil {
@@ -67,7 +113,14 @@ func (g *Governor) Start() {
 	if connErr := g.node.Connect(); connErr != nil {
 		log.WithError(connErr).Error("Error connecting to node")
 	}
-	go g.workReceiver()
+	for name, pool := range g.pools {
+		if connErr := pool.Connect(); connErr != nil {
+			log.WithError(connErr).WithField("pool", name).Error("Error connecting to node")
+		}
+	}
+	g.supervisor.Configure(g.Config.Supervisor)
+	g.Context = base.NewContext(g.newGenerator, g.supervisor)
+	go g.workReceiver(g.Context, g.forwardPoolWork(g.workQuit))
 	g.powerOn()
 	g.running = true
 }
@@ -81,46 +134,200 @@ func (g *Governor) Stop() {
 	log.Infoln("Stopping governor")
 	close(g.workQuit)
 	g.node.Disconnect()
+	for _, pool := range g.pools {
+		pool.Disconnect()
+	}
 	g.wg.Wait()
 	g.powerOff()
 	g.running = false
 }
 
-func (g *Governor) DeviceScan(work *node.Work) {
+func (g *Governor) DeviceScan() {
 	for _, cg := range g.Catalogs {
 		if controllers, err := cg.FindControllers(g.Config, g.Context); err == nil {
 			for _, ct := range controllers {
 				if err := ct.Reset(); err != nil {
 					log.WithFields(log.Fields{
-						"serial": ct.String(),
+						"serial": ct.Alias(),
 						"error":  err.Error(),
 					}).Warnln("Error resetting controller")
+					g.Context.Restarted(ct, err)
 				}
 			}
-			if len(controllers) != 0 && work != nil {
-				g.Context.UpdateWork(work)
+			if len(controllers) != 0 {
+				g.Context.ResendWork()
 			}
 		}
 	}
 }
 
-func (g *Governor) workReceiver() {
-	var work *node.Work
-	deviceScanTicker := time.NewTicker(10 * time.Second)
-	g.Context = base.NewContext()
-	g.DeviceScan(nil)
+// poolWork is work of a node of the nodes section, for the devices assigned to it.
+type poolWork struct {
+	pool string
+	work *node.Work
+}
+
+// forwardPoolWork merges the work of the nodes of the nodes section into one channel until quit closes.
+func (g *Governor) forwardPoolWork(quit chan struct{}) <-chan poolWork {
+	var works = make(chan poolWork)
+	for name, pool := range g.pools {
+		g.wg.Add(1)
+		go func(name string, workChan chan *node.Work) {
+			defer g.wg.Done()
+			for {
+				select {
+				case <-quit:
+					return
+				case work := <-workChan:
+					select {
+					case works <- poolWork{pool: name, work: work}:
+					case <-quit:
+						return
+					}
+				}
+			}
+		}(name, pool.GetWorkChan())
+	}
+	return works
+}
+
+func (g *Governor) workReceiver(context *base.Context, poolWorks <-chan poolWork) {
+	var hotplug, ownHotplug = g.openHotplug()
+	var hotplugEvents <-chan base.HotplugEvent
+	var scanInterval = DeviceScanInterval
+	if hotplug != nil {
+		hotplugEvents = hotplug.Events()
+		scanInterval = HotplugScanInterval
+	}
+	var settleTimer <-chan time.Time
+	deviceScanTicker := time.NewTicker(scanInterval)
+	statsTicker := time.NewTicker(StatsInterval)
+	g.DeviceScan()
 	var blockChan = g.node.GetWorkChan()
 	for {
 		select {
 		case <-g.workQuit:
 			deviceScanTicker.Stop()
-			g.Context.Close()
+			statsTicker.Stop()
+			if ownHotplug {
+				_ = hotplug.Close()
+			}
+			context.Close()
 			g.wg.Done()
 			return
-		case work = <-blockChan:
-			g.Context.UpdateWork(work)
+		case <-statsTicker.C:
+			g.logStats(context)
+		case work := <-blockChan:
+			context.UpdateWork(work)
+		case pw := <-poolWorks:
+			context.UpdatePoolWork(pw.pool, pw.work)
 		case <-deviceScanTicker.C:
-			g.DeviceScan(work)
+			g.DeviceScan()
+		case event, ok := <-hotplugEvents:
+			if !ok {
+				log.Warnln("Hot-plug events stopped, scanning for devices periodically")
+				hotplugEvents = nil
+				deviceScanTicker.Stop()
+				deviceScanTicker = time.NewTicker(DeviceScanInterval)
+				continue
+			}
+			log.WithFields(log.Fields{
+				"action":  event.Action,
+				"vendor":  event.PidVid.Vendor,
+				"product": event.PidVid.Product,
+				"serial":  event.Serial,
+				"devPath": event.DevPath,
+			}).Debugln("Hot-plug event")
+			if context.HandleHotplug(event, g.Catalogs) {
+				settleTimer = time.After(HotplugSettle)
+			}
+		case <-settleTimer:
+			settleTimer = nil
+			g.DeviceScan()
+		}
+	}
+}
+
+// openHotplug returns the configured hot-plug source, or listens to netlink itself, leaving only periodic scans when
+// neither is available. It reports whether the source was opened here and must be closed on stop.
+func (g *Governor) openHotplug() (base.HotplugSource, bool) {
+	if g.Hotplug != nil {
+		return g.Hotplug, false
+	}
+	hotplug, err := base.NewNetlinkHotplug(base.SysRoot)
+	if err != nil {
+		log.WithError(err).Warnln("Hot-plug events unavailable, scanning for devices periodically")
+		return nil, false
+	}
+	return hotplug, true
+}
+
+func (g *Governor) newGenerator() generators.Generator {
+	if g.Generator != nil {
+		return g.Generator()
+	}
+	return generators.NewUsedNTimes()
+}
+
+// Stats snapshots the nonce counts of every device, or none while the governor is stopped.
+func (g *Governor) Stats() []*base.DeviceStats {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if !g.running || g.Context == nil {
+		return nil
+	}
+	return g.Context.Stats()
+}
+
+// RestartHistory returns the restarts of every device restarted since the governor was created, which stopping and
+// starting it again keeps.
+func (g *Governor) RestartHistory() []*base.RestartHistory {
+	return g.supervisor.History()
+}
+
+// logStats logs the stats of the context the work receiver runs, which it must not read under the lock Stop holds
+// while waiting for the receiver.
+func (g *Governor) logStats(context *base.Context) {
+	for _, ds := range context.Stats() {
+		log.WithFields(log.Fields{
+			"serial":      ds.Alias,
+			"driver":      ds.Driver,
+			"pool":        ds.Pool,
+			"chips":       ds.ChipCount,
+			"targetChips": ds.TargetChips,
+			"degraded":    ds.Degraded,
+			"valid":       ds.Valid,
+			"hwErrors":    ds.HWErrors,
+			"duplicates":  ds.Duplicates,
+			"hashRate1m":  ds.HashRates.OneMinute,
+			"hashRate5m":  ds.HashRates.FiveMinutes,
+			"hashRate15m": ds.HashRates.FifteenMinutes,
+			"hashRate1h":  ds.HashRates.OneHour,
+			"expected":    ds.HashRates.Expected,
+			"health":      ds.HashRates.Health,
+		}).Infoln("Device stats")
+		for _, cs := range ds.Chips {
+			log.WithFields(log.Fields{
+				"serial":     ds.Alias,
+				"chip":       cs.Chip,
+				"valid":      cs.Valid,
+				"hwErrors":   cs.HWErrors,
+				"duplicates": cs.Duplicates,
+				"cores":      len(cs.Cores),
+			}).Debugln("Chip stats")
+		}
+	}
+	for _, history := range g.supervisor.History() {
+		var fields = log.Fields{
+			"serial":     history.Alias,
+			"restarts":   history.Restarts,
+			"failed":     history.Failed,
+			"lastReason": history.Recent[len(history.Recent)-1].Reason,
+		}
+		if history.Failed {
+			log.WithFields(fields).Warnln("Restart history")
+		} else {
+			log.WithFields(fields).Debugln("Restart history")
 		}
 	}
 }
@@ -0,0 +1,172 @@
+package governor
+
+import (
+	"errors"
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"github.com/fernandosanchezjr/goasicminer/devices/base"
+	"github.com/fernandosanchezjr/goasicminer/generators"
+	"github.com/fernandosanchezjr/goasicminer/node"
+	"github.com/robfig/cron/v3"
+	"testing"
+	"time"
+)
+
+type testHotplug struct {
+	events chan base.HotplugEvent
+	closed bool
+}
+
+func (th *testHotplug) Events() <-chan base.HotplugEvent {
+	return th.events
+}
+
+func (th *testHotplug) Close() error {
+	th.closed = true
+	return nil
+}
+
+type testCatalog struct {
+	base.IDriverCatalog
+	pidVids []base.PidVid
+	scans   chan struct{}
+}
+
+func (tc *testCatalog) FindControllers(*config.Config, *base.Context) ([]base.IController, error) {
+	tc.scans <- struct{}{}
+	return nil, nil
+}
+
+func (tc *testCatalog) PidVids() []base.PidVid {
+	return tc.pidVids
+}
+
+type testController struct {
+	base.IController
+	serial string
+}
+
+func (tc *testController) String() string {
+	return tc.serial
+}
+
+func (tc *testController) Alias() string {
+	return tc.serial
+}
+
+func newTestGovernor(source base.HotplugSource, catalog base.IDriverCatalog) *Governor {
+	// Nothing listens on the node port, so connecting fails fast and leaves the node disconnected.
+	var cfg = &config.Config{Node: &config.Node{URL: "127.0.0.1:1"}}
+	return &Governor{
+		Config:     cfg,
+		Catalogs:   []base.IDriverCatalog{catalog},
+		Hotplug:    source,
+		Generator:  func() generators.Generator { return generators.NewRandom() },
+		cron:       cron.New(),
+		node:       node.NewNode(cfg.Node),
+		supervisor: &base.Supervisor{},
+	}
+}
+
+func expectScan(t *testing.T, catalog *testCatalog, what string) {
+	t.Helper()
+	select {
+	case <-catalog.scans:
+	case <-time.After(time.Second):
+		t.Fatalf("no device scan %s", what)
+	}
+}
+
+func expectNoScan(t *testing.T, catalog *testCatalog, what string) {
+	t.Helper()
+	select {
+	case <-catalog.scans:
+		t.Fatalf("unexpected device scan %s", what)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestGovernor_Hotplug(t *testing.T) {
+	defer func(settle, scan, hotplugScan time.Duration) {
+		HotplugSettle, DeviceScanInterval, HotplugScanInterval = settle, scan, hotplugScan
+	}(HotplugSettle, DeviceScanInterval, HotplugScanInterval)
+	HotplugSettle = 20 * time.Millisecond
+	DeviceScanInterval = 30 * time.Millisecond
+	HotplugScanInterval = time.Hour
+
+	var pidVid = base.PidVid{Product: 0x6015, Vendor: 0x0403}
+	var source = &testHotplug{events: make(chan base.HotplugEvent)}
+	var catalog = &testCatalog{pidVids: []base.PidVid{pidVid}, scans: make(chan struct{}, 16)}
+	var g = newTestGovernor(source, catalog)
+
+	g.Start()
+	expectScan(t, catalog, "on start")
+	source.events <- base.HotplugEvent{Action: base.HotplugAdd, PidVid: base.PidVid{Product: 1, Vendor: 2}}
+	expectNoScan(t, catalog, "for a device no catalog knows")
+	source.events <- base.HotplugEvent{Action: base.HotplugAdd, PidVid: pidVid, Serial: "A"}
+	expectScan(t, catalog, "after the added device settled")
+	expectNoScan(t, catalog, "once the added device was scanned for")
+
+	close(source.events)
+	expectScan(t, catalog, "once events stopped")
+	expectScan(t, catalog, "on the periodic interval")
+	g.Stop()
+	if source.closed {
+		t.Fatal("caller supplied hot-plug source closed on stop")
+	}
+
+	source.events = make(chan base.HotplugEvent)
+	for len(catalog.scans) > 0 {
+		<-catalog.scans
+	}
+	g.Start()
+	defer g.Stop()
+	expectScan(t, catalog, "on restart")
+	source.events <- base.HotplugEvent{Action: base.HotplugAdd, PidVid: pidVid, Serial: "A"}
+	expectScan(t, catalog, "from the source reused on restart")
+}
+
+func TestGovernor_RestartHistory(t *testing.T) {
+	var source = &testHotplug{events: make(chan base.HotplugEvent)}
+	var catalog = &testCatalog{scans: make(chan struct{}, 16)}
+	var g = newTestGovernor(source, catalog)
+
+	g.Start()
+	expectScan(t, catalog, "on start")
+	g.Context.Restarted(&testController{serial: "FT1"}, errors.New("read timeout"))
+	g.Stop()
+
+	g.Start()
+	defer g.Stop()
+	expectScan(t, catalog, "on restart")
+	if g.Context.RestartAllowed("FT1") {
+		t.Fatal("restart backoff lost across governor restart")
+	}
+	if history := g.RestartHistory(); len(history) != 1 || history[0].Serial != "FT1" || history[0].Restarts != 1 {
+		t.Fatalf("unexpected restart history %+v", history)
+	}
+}
+
+func TestGovernor_StatsWhileRestarting(t *testing.T) {
+	var source = &testHotplug{events: make(chan base.HotplugEvent)}
+	var catalog = &testCatalog{scans: make(chan struct{}, 16)}
+	var g = newTestGovernor(source, catalog)
+	var quit, done = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-quit:
+				return
+			default:
+				g.Stats()
+			}
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		g.Start()
+		expectScan(t, catalog, "on start")
+		g.Stop()
+	}
+	close(quit)
+	<-done
+}
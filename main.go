@@ -1,7 +1,10 @@
 package main
 
 import (
+	"bytes"
+	"encoding/gob"
 	"flag"
+	"github.com/fernandosanchezjr/goasicminer/backend/services/messages"
 	client2 "github.com/fernandosanchezjr/goasicminer/backend/services/shim"
 	"github.com/fernandosanchezjr/goasicminer/config"
 	"github.com/fernandosanchezjr/goasicminer/governor"
@@ -13,6 +16,7 @@ import (
 	"os"
 	"runtime/pprof"
 	"runtime/trace"
+	"time"
 )
 
 var cpuProfile bool
@@ -51,21 +55,28 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	var cl *client.Client
+	var hostName string
 	if cfg.BackendAddress != "" {
 		registry := services.NewRegistry()
 		registry.AddService("Logging", client2.NewLogging())
 		registry.AddService("CheckIn", client2.NewCheckIn())
-		cl := client.NewClient(cfg.BackendAddress, registry)
+		registry.AddService("Stats", client2.NewStats())
+		cl = client.NewClient(cfg.BackendAddress, registry)
 		cl.Start()
 		defer cl.Stop()
 		logIngestHook := logging.NewIngestHook(cl)
 		log.AddHook(logIngestHook)
-		if _, err := cl.Call("CheckIn", "Host", logIngestHook.HostName); err != nil {
+		hostName = logIngestHook.HostName
+		if _, err := cl.Call("CheckIn", "Host", hostName); err != nil {
 			log.WithError(err).Error("CheckIn error")
 		}
 	}
 	gov := governor.NewGovernor(cfg)
 	gov.Start()
+	if cl != nil {
+		go reportStats(cl, gov, hostName)
+	}
 
 	watcher, err := utils.NewFileWatcher(configPath, func() {
 		newConfig, err := config.LoadConfig()
@@ -85,3 +96,22 @@ func main() {
 	}
 	gov.Stop()
 }
+
+// reportStats sends the device stats to the backend every governor.StatsInterval.
+func reportStats(cl *client.Client, gov *governor.Governor, hostName string) {
+	for now := range time.Tick(governor.StatsInterval) {
+		var buf bytes.Buffer
+		encoder := gob.NewEncoder(&buf)
+		if err := encoder.Encode(&messages.StatsReport{
+			HostName: hostName,
+			Time:     now,
+			Devices:  gov.Stats(),
+		}); err != nil {
+			log.WithError(err).Error("Error encoding stats report")
+			continue
+		}
+		if err := cl.Send("Stats", "Report", buf.Bytes()); err != nil {
+			log.WithError(err).Debugln("Stats report error")
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package node
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"io"
+	"math/big"
+)
+
+// MergedMiningMagic marks the aux chain merkle root in the parent coinbase script.
+var MergedMiningMagic = []byte{0xfa, 0xbe, 0x6d, 0x6d}
+
+var (
+	ErrNoAuxBlock       = errors.New("no aux block for work")
+	ErrAuxBlockRejected = errors.New("aux block rejected")
+)
+
+// AuxBlock is a block of the merged mined chain as returned by createauxblock or getauxblock.
+type AuxBlock struct {
+	Hash          chainhash.Hash
+	PreviousHash  chainhash.Hash
+	ChainID       int32
+	Height        int64
+	CoinbaseValue int64
+	Bits          uint32
+	Target        *big.Int
+}
+
+type auxBlockResult struct {
+	Hash              string `json:"hash"`
+	ChainID           int32  `json:"chainid"`
+	PreviousBlockHash string `json:"previousblockhash"`
+	CoinbaseValue     int64  `json:"coinbasevalue"`
+	Bits              string `json:"bits"`
+	Height            int64  `json:"height"`
+}
+
+func ParseAuxBlock(data json.RawMessage) (*AuxBlock, error) {
+	var result auxBlockResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	hash, hashErr := chainhash.NewHashFromStr(result.Hash)
+	if hashErr != nil {
+		return nil, hashErr
+	}
+	previousHash, previousHashErr := chainhash.NewHashFromStr(result.PreviousBlockHash)
+	if previousHashErr != nil {
+		return nil, previousHashErr
+	}
+	bits, bitsErr := hex.DecodeString(result.Bits)
+	if bitsErr != nil {
+		return nil, bitsErr
+	}
+	if len(bits) != 4 {
+		return nil, errors.New("invalid aux block bits")
+	}
+	var nBits = binary.BigEndian.Uint32(bits)
+	return &AuxBlock{
+		Hash:          *hash,
+		PreviousHash:  *previousHash,
+		ChainID:       result.ChainID,
+		Height:        result.Height,
+		CoinbaseValue: result.CoinbaseValue,
+		Bits:          nBits,
+		Target:        utils.CompactToBig(nBits),
+	}, nil
+}
+
+// MergedMiningCommitment is the coinbase script data committing to a single aux block: the magic, the chain merkle
+// root in reversed byte order, then the chain merkle tree size and nonce. With one chain the root is the aux block
+// hash itself and its slot is always index 0.
+func MergedMiningCommitment(auxHash chainhash.Hash) []byte {
+	var commitment = make([]byte, 0, len(MergedMiningMagic)+chainhash.HashSize+8)
+	commitment = append(commitment, MergedMiningMagic...)
+	for i := chainhash.HashSize - 1; i >= 0; i-- {
+		commitment = append(commitment, auxHash[i])
+	}
+	var sizeAndNonce [8]byte
+	binary.LittleEndian.PutUint32(sizeAndNonce[0:4], 1)
+	binary.LittleEndian.PutUint32(sizeAndNonce[4:8], 0)
+	return append(commitment, sizeAndNonce[:]...)
+}
+
+// AuxPow proves an aux block was mined through a parent block whose coinbase commits to it.
+type AuxPow struct {
+	Coinbase       *wire.MsgTx
+	CoinbaseBranch []chainhash.Hash
+	ChainBranch    []chainhash.Hash
+	ChainIndex     int32
+	ParentHeader   wire.BlockHeader
+}
+
+func NewAuxPow(coinbase *wire.MsgTx, coinbaseBranch []chainhash.Hash, parentHeader wire.BlockHeader) *AuxPow {
+	return &AuxPow{Coinbase: coinbase, CoinbaseBranch: coinbaseBranch, ParentHeader: parentHeader}
+}
+
+func writeMerkleBranch(w io.Writer, branch []chainhash.Hash, index int32) error {
+	if err := wire.WriteVarInt(w, 0, uint64(len(branch))); err != nil {
+		return err
+	}
+	for i := range branch {
+		if _, err := w.Write(branch[i][:]); err != nil {
+			return err
+		}
+	}
+	return binary.Write(w, binary.LittleEndian, index)
+}
+
+// Serialize writes the proof as submitauxblock expects it: the parent coinbase, the parent block hash, the coinbase
+// merkle branch and index, the chain merkle branch and index, and the parent header.
+func (ap *AuxPow) Serialize(w io.Writer) error {
+	if err := ap.Coinbase.SerializeNoWitness(w); err != nil {
+		return err
+	}
+	var parentHash = ap.ParentHeader.BlockHash()
+	if _, err := w.Write(parentHash[:]); err != nil {
+		return err
+	}
+	if err := writeMerkleBranch(w, ap.CoinbaseBranch, 0); err != nil {
+		return err
+	}
+	if err := writeMerkleBranch(w, ap.ChainBranch, ap.ChainIndex); err != nil {
+		return err
+	}
+	return ap.ParentHeader.Serialize(w)
+}
+
+func (ap *AuxPow) Hex() (string, error) {
+	buf := &bytes.Buffer{}
+	if err := ap.Serialize(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf.Bytes()), nil
+}
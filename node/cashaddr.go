@@ -0,0 +1,94 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/bech32"
+	"strings"
+)
+
+const cashAddrCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// CashAddr type bits from the version byte
+const (
+	cashAddrP2PKH = 0
+	cashAddrP2SH  = 1
+)
+
+var ErrInvalidCashAddr = errors.New("invalid cashaddr")
+
+func cashAddrPolymod(values []byte) uint64 {
+	var c = uint64(1)
+	for _, d := range values {
+		var c0 = byte(c >> 35)
+		c = ((c & 0x07ffffffff) << 5) ^ uint64(d)
+		if c0&0x01 != 0 {
+			c ^= 0x98f2bc8e61
+		}
+		if c0&0x02 != 0 {
+			c ^= 0x79b76d99e2
+		}
+		if c0&0x04 != 0 {
+			c ^= 0xf33e5fb3c4
+		}
+		if c0&0x08 != 0 {
+			c ^= 0xae2eabe2a8
+		}
+		if c0&0x10 != 0 {
+			c ^= 0x1e4f43e470
+		}
+	}
+	return c ^ 1
+}
+
+func cashAddrPrefixValues(prefix string) []byte {
+	var values = make([]byte, 0, len(prefix)+1)
+	for i := 0; i < len(prefix); i++ {
+		values = append(values, prefix[i]&0x1f)
+	}
+	return append(values, 0)
+}
+
+// DecodeCashAddr decodes a Bitcoin Cash address, with or without its network prefix, into the equivalent legacy
+// address on params. Only 160 bit hashes are supported, as those are all P2PKH and P2SH addresses use.
+func DecodeCashAddr(address string, prefix string, params *chaincfg.Params) (btcutil.Address, error) {
+	if strings.ToLower(address) != address && strings.ToUpper(address) != address {
+		return nil, fmt.Errorf("%w: mixed case", ErrInvalidCashAddr)
+	}
+	address = strings.ToLower(address)
+	var payload = address
+	if separator := strings.LastIndexByte(address, ':'); separator >= 0 {
+		if address[:separator] != prefix {
+			return nil, fmt.Errorf("%w: prefix %s, expected %s", ErrInvalidCashAddr, address[:separator], prefix)
+		}
+		payload = address[separator+1:]
+	}
+	var values = make([]byte, len(payload))
+	for i := 0; i < len(payload); i++ {
+		var value = strings.IndexByte(cashAddrCharset, payload[i])
+		if value < 0 {
+			return nil, fmt.Errorf("%w: character %q", ErrInvalidCashAddr, payload[i])
+		}
+		values[i] = byte(value)
+	}
+	if len(values) <= 8 || cashAddrPolymod(append(cashAddrPrefixValues(prefix), values...)) != 0 {
+		return nil, fmt.Errorf("%w: checksum", ErrInvalidCashAddr)
+	}
+	data, err := bech32.ConvertBits(values[:len(values)-8], 5, 8, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCashAddr, err)
+	}
+	if len(data) != 21 || data[0]&0x07 != 0 {
+		return nil, fmt.Errorf("%w: unsupported hash size", ErrInvalidCashAddr)
+	}
+	switch data[0] >> 3 {
+	case cashAddrP2PKH:
+		return btcutil.NewAddressPubKeyHash(data[1:], params)
+	case cashAddrP2SH:
+		return btcutil.NewAddressScriptHashFromHash(data[1:], params)
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %d", ErrInvalidCashAddr, data[0]>>3)
+	}
+}
@@ -0,0 +1,120 @@
+package node
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/fernandosanchezjr/goasicminer/config"
+)
+
+// TestNet4Params describes BIP 94 testnet4, which btcd does not ship. Address encodings are shared with testnet3.
+var TestNet4Params = newTestNet4Params()
+
+func newTestNet4Params() chaincfg.Params {
+	var params = chaincfg.TestNet3Params
+	genesisHash, _ := chainhash.NewHashFromStr("00000000da84f2bafbbc53dee25a72ae507ff4914b867c565be350b0da8bf043")
+	params.Name = "testnet4"
+	params.Net = wire.BitcoinNet(0x283f161c)
+	params.DefaultPort = "48333"
+	params.DNSSeeds = []chaincfg.DNSSeed{
+		{Host: "seed.testnet4.bitcoin.sprovoost.nl", HasFiltering: true},
+		{Host: "seed.testnet4.wiz.biz", HasFiltering: true},
+	}
+	params.GenesisBlock = nil
+	params.GenesisHash = genesisHash
+	params.Checkpoints = nil
+	return params
+}
+
+func init() {
+	for _, params := range []*chaincfg.Params{&chaincfg.SigNetParams, &TestNet4Params} {
+		if err := chaincfg.Register(params); err != nil && err != chaincfg.ErrDuplicateNet {
+			panic(err)
+		}
+	}
+}
+
+// knownChainParams maps the chain names reported by getblockchaininfo, as well as btcd's own names, to parameters.
+func knownChainParams(chainName string) (*chaincfg.Params, bool) {
+	switch chainName {
+	case "", "main", chaincfg.MainNetParams.Name:
+		return &chaincfg.MainNetParams, true
+	case "test", chaincfg.TestNet3Params.Name:
+		return &chaincfg.TestNet3Params, true
+	case TestNet4Params.Name:
+		return &TestNet4Params, true
+	case chaincfg.RegressionNetParams.Name:
+		return &chaincfg.RegressionNetParams, true
+	case chaincfg.SigNetParams.Name:
+		return &chaincfg.SigNetParams, true
+	case chaincfg.SimNetParams.Name:
+		return &chaincfg.SimNetParams, true
+	default:
+		return nil, false
+	}
+}
+
+// customChainParams derives parameters from a built in chain, or from a custom signet challenge, and applies the
+// configured overrides. The result is registered so addresses for it can be decoded.
+func customChainParams(chain *config.Chain) (*chaincfg.Params, error) {
+	var params chaincfg.Params
+	if chain.SignetChallenge != "" {
+		challenge, challengeErr := hex.DecodeString(chain.SignetChallenge)
+		if challengeErr != nil {
+			return nil, fmt.Errorf("node.customChainParams: invalid signet challenge for %s: %w", chain.Name,
+				challengeErr)
+		}
+		params = chaincfg.CustomSignetParams(challenge, nil)
+	} else {
+		var baseName = chain.Base
+		if baseName == "" {
+			baseName = chain.Name
+		}
+		base, found := knownChainParams(baseName)
+		if !found {
+			return nil, fmt.Errorf("node.customChainParams: unknown base chain %s for %s", baseName, chain.Name)
+		}
+		params = *base
+	}
+	params.Name = chain.Name
+	if chain.Net != 0 {
+		params.Net = wire.BitcoinNet(chain.Net)
+	}
+	if chain.Bech32HRP != "" {
+		params.Bech32HRPSegwit = chain.Bech32HRP
+	}
+	if chain.PubKeyHashAddrID != nil {
+		params.PubKeyHashAddrID = *chain.PubKeyHashAddrID
+	}
+	if chain.ScriptHashAddrID != nil {
+		params.ScriptHashAddrID = *chain.ScriptHashAddrID
+	}
+	if err := chaincfg.Register(&params); err != nil && err != chaincfg.ErrDuplicateNet {
+		return nil, err
+	}
+	return &params, nil
+}
+
+// getProfile falls back to Bitcoin before setup has resolved the configured profile.
+func (n *Node) getProfile() *ChainProfile {
+	if n.profile == nil {
+		return BitcoinProfile
+	}
+	return n.profile
+}
+
+func (n *Node) GetChainParams() (*chaincfg.Params, error) {
+	if n.config != nil {
+		for i := range n.config.Chains {
+			if n.config.Chains[i].Name == n.chainName {
+				return customChainParams(&n.config.Chains[i])
+			}
+		}
+	}
+	if params, found := n.getProfile().Params(n.chainName); found {
+		return params, nil
+	}
+	return nil, fmt.Errorf("node.GetChainParams: Unknown chain %s", n.chainName)
+}
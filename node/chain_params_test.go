@@ -0,0 +1,63 @@
+package node
+
+import (
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"testing"
+)
+
+func TestNode_GetChainParams(t *testing.T) {
+	var expected = map[string]string{
+		"main":     chaincfg.MainNetParams.Name,
+		"test":     chaincfg.TestNet3Params.Name,
+		"testnet4": TestNet4Params.Name,
+		"regtest":  chaincfg.RegressionNetParams.Name,
+		"signet":   chaincfg.SigNetParams.Name,
+	}
+	for chainName, paramsName := range expected {
+		node := NewNode(&config.Node{})
+		node.chainName = chainName
+		params, err := node.GetChainParams()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if params.Name != paramsName {
+			t.Fatalf("chain %s resolved to %s", chainName, params.Name)
+		}
+	}
+	node := NewNode(&config.Node{})
+	node.chainName = "bogus"
+	if _, err := node.GetChainParams(); err == nil {
+		t.Fatal("expected unknown chain error")
+	}
+}
+
+func TestNode_CustomChainParams(t *testing.T) {
+	var pubKeyHashAddrID uint8 = 0x3f
+	node := NewNode(&config.Node{Chains: []config.Chain{
+		{Name: "signet", SignetChallenge: "51"},
+		{Name: "customtest", Base: "regtest", Net: 0xfeedbeef, Bech32HRP: "ctb", PubKeyHashAddrID: &pubKeyHashAddrID},
+	}})
+	node.chainName = "signet"
+	params, err := node.GetChainParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Net == chaincfg.SigNetParams.Net {
+		t.Fatal("custom signet challenge did not change network magic")
+	}
+	if _, err := btcutil.DecodeAddress("tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", params); err != nil {
+		t.Fatal(err)
+	}
+	node.chainName = "customtest"
+	if params, err = node.GetChainParams(); err != nil {
+		t.Fatal(err)
+	}
+	if params.Bech32HRPSegwit != "ctb" || params.PubKeyHashAddrID != 0x3f || !chaincfg.IsPubKeyHashAddrID(0x3f) {
+		t.Fatal("custom chain overrides not applied")
+	}
+	if params.CoinbaseMaturity != chaincfg.RegressionNetParams.CoinbaseMaturity {
+		t.Fatal("custom chain not derived from its base")
+	}
+}
@@ -0,0 +1,131 @@
+package node
+
+import (
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+)
+
+const (
+	ProfileBitcoin     = "bitcoin"
+	ProfileBitcoinCash = "bitcoincash"
+	ProfileNamecoin    = "namecoin"
+	ProfileDigiByte    = "digibyte"
+)
+
+// ChainProfile holds what differs between SHA256d chains on the solo mining path. Chains are identified by the
+// names their nodes report from getblockchaininfo, which all of these share with Bitcoin Core.
+type ChainProfile struct {
+	Name string
+	// Rules are sent with every getblocktemplate request.
+	Rules []string
+	// Segwit chains get a witness commitment in the coinbase whenever a selected transaction carries witness data.
+	Segwit bool
+	// MinCoinbaseSize pads the coinbase script on chains that reject small transactions.
+	MinCoinbaseSize int
+	// VersionFixedBits must match the template version in every rolled header.
+	VersionFixedBits utils.Version
+	networks         map[string]*chaincfg.Params
+	cashAddrPrefixes map[string]string
+}
+
+// altChainParams derives address encoding parameters for another chain from a Bitcoin network. The network magic
+// only keys btcd's address registry, so chains sharing Bitcoin's regtest magic get a distinct one.
+func altChainParams(base *chaincfg.Params, name string, net uint32, pubKeyHash, scriptHash byte, hrp string) *chaincfg.Params {
+	var params = *base
+	params.Name = name
+	params.Net = wire.BitcoinNet(net)
+	params.PubKeyHashAddrID = pubKeyHash
+	params.ScriptHashAddrID = scriptHash
+	params.Bech32HRPSegwit = hrp
+	params.DNSSeeds = nil
+	params.Checkpoints = nil
+	if err := chaincfg.Register(&params); err != nil && err != chaincfg.ErrDuplicateNet {
+		panic(err)
+	}
+	return &params
+}
+
+var (
+	BitcoinProfile = &ChainProfile{
+		Name:             ProfileBitcoin,
+		Rules:            []string{"segwit"},
+		Segwit:           true,
+		VersionFixedBits: 0xe0000000,
+	}
+	// BitcoinCashProfile mines on a BCHN style node: no segwit, CashAddr payouts and the 100 byte minimum transaction
+	// size. Templates already come in canonical transaction order, which tail truncation preserves.
+	BitcoinCashProfile = &ChainProfile{
+		Name:             ProfileBitcoinCash,
+		MinCoinbaseSize:  100,
+		VersionFixedBits: 0xe0000000,
+		cashAddrPrefixes: map[string]string{
+			chaincfg.MainNetParams.Name:       "bitcoincash",
+			chaincfg.TestNet3Params.Name:      "bchtest",
+			TestNet4Params.Name:               "bchtest",
+			chaincfg.RegressionNetParams.Name: "bchreg",
+		},
+	}
+	// NamecoinProfile keeps the chain ID and auxpow flag in the version, so only the low rolling bits are usable.
+	NamecoinProfile = &ChainProfile{
+		Name:             ProfileNamecoin,
+		Rules:            []string{"segwit"},
+		Segwit:           true,
+		VersionFixedBits: 0xffff0100,
+		networks: map[string]*chaincfg.Params{
+			"main": altChainParams(&chaincfg.MainNetParams, "namecoin", 0xfeb4bef9, 52, 13, "nc"),
+			"test": altChainParams(&chaincfg.TestNet3Params, "namecoin-testnet", 0xfeb5bffa, 111, 196, "tn"),
+			"regtest": altChainParams(&chaincfg.RegressionNetParams, "namecoin-regtest", 0xdab5bffb, 111, 196,
+				"ncrt"),
+		},
+	}
+	// DigiByteProfile needs the node started with -algo=sha256d so templates carry the SHA256d algorithm bits.
+	DigiByteProfile = &ChainProfile{
+		Name:             ProfileDigiByte,
+		Rules:            []string{"segwit"},
+		Segwit:           true,
+		VersionFixedBits: 0xe0000e00,
+		networks: map[string]*chaincfg.Params{
+			"main": altChainParams(&chaincfg.MainNetParams, "digibyte", 0xdab6c3fa, 30, 63, "dgb"),
+			"test": altChainParams(&chaincfg.TestNet3Params, "digibyte-testnet", 0xddbdc8fd, 126, 140, "dgbt"),
+			"regtest": altChainParams(&chaincfg.RegressionNetParams, "digibyte-regtest", 0xdab5bffc, 126, 140,
+				"dgbrt"),
+		},
+	}
+)
+
+func GetChainProfile(name string) (*ChainProfile, error) {
+	switch name {
+	case "", ProfileBitcoin:
+		return BitcoinProfile, nil
+	case ProfileBitcoinCash, "bch":
+		return BitcoinCashProfile, nil
+	case ProfileNamecoin, "nmc":
+		return NamecoinProfile, nil
+	case ProfileDigiByte, "dgb":
+		return DigiByteProfile, nil
+	default:
+		return nil, fmt.Errorf("node.GetChainProfile: unknown chain profile %s", name)
+	}
+}
+
+// Params resolves the chain name reported by the node to address parameters for this profile.
+func (cp *ChainProfile) Params(chainName string) (*chaincfg.Params, bool) {
+	if cp.networks == nil {
+		return knownChainParams(chainName)
+	}
+	params, found := cp.networks[chainName]
+	return params, found
+}
+
+// DecodeAddress accepts legacy and bech32 addresses on every profile, and CashAddr on Bitcoin Cash.
+func (cp *ChainProfile) DecodeAddress(address string, params *chaincfg.Params) (btcutil.Address, error) {
+	if prefix, found := cp.cashAddrPrefixes[params.Name]; found {
+		if addr, err := DecodeCashAddr(address, prefix, params); err == nil {
+			return addr, nil
+		}
+	}
+	return btcutil.DecodeAddress(address, params)
+}
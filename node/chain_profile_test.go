@@ -0,0 +1,172 @@
+package node
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"github.com/stevenroose/go-bitcoin-core-rpc/btcjson"
+	"strings"
+	"testing"
+)
+
+func TestDecodeCashAddr(t *testing.T) {
+	var hash, _ = hex.DecodeString("76a04053bda0a88bda5177b86a15c3b29f559873")
+	for _, address := range []string{
+		"bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+		"qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+		"BITCOINCASH:QPM2QSZNHKS23Z7629MMS6S4CWEF74VCWVY22GDX6A",
+	} {
+		addr, err := DecodeCashAddr(address, "bitcoincash", &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pkh, ok := addr.(*btcutil.AddressPubKeyHash); !ok || !bytes.Equal(pkh.Hash160()[:], hash) {
+			t.Fatalf("unexpected address %s", addr)
+		}
+	}
+	addr, err := DecodeCashAddr("bitcoincash:ppm2qsznhks23z7629mms6s4cwef74vcwvn0h829pq", "bitcoincash",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sh, ok := addr.(*btcutil.AddressScriptHash); !ok || !bytes.Equal(sh.Hash160()[:], hash) {
+		t.Fatalf("unexpected address %s", addr)
+	}
+	for _, address := range []string{
+		"bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6b",
+		"bchtest:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+		"bitcoincash:Qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+	} {
+		if _, err := DecodeCashAddr(address, "bitcoincash", &chaincfg.MainNetParams); !errors.Is(err, ErrInvalidCashAddr) {
+			t.Fatalf("expected invalid cashaddr for %s, got %v", address, err)
+		}
+	}
+}
+
+func TestChainProfile_DecodeAddress(t *testing.T) {
+	var hash = bytes.Repeat([]byte{0x11}, 20)
+	var expected = []struct {
+		profile *ChainProfile
+		chain   string
+		leading string
+	}{
+		{NamecoinProfile, "main", "MN"},
+		{DigiByteProfile, "main", "D"},
+	}
+	for _, e := range expected {
+		params, found := e.profile.Params(e.chain)
+		if !found {
+			t.Fatalf("%s has no %s network", e.profile.Name, e.chain)
+		}
+		addr, err := btcutil.NewAddressPubKeyHash(hash, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.ContainsRune(e.leading, rune(addr.EncodeAddress()[0])) {
+			t.Fatalf("unexpected %s address %s", e.profile.Name, addr.EncodeAddress())
+		}
+		decoded, err := e.profile.DecodeAddress(addr.EncodeAddress(), params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded.ScriptAddress(), hash) {
+			t.Fatalf("unexpected %s address %s", e.profile.Name, decoded)
+		}
+		if _, err := e.profile.DecodeAddress("1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH", params); err == nil {
+			t.Fatalf("%s accepted a bitcoin address", e.profile.Name)
+		}
+	}
+	params, _ := BitcoinCashProfile.Params("main")
+	addr, err := BitcoinCashProfile.DecodeAddress("bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.EncodeAddress() != "1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu" {
+		t.Fatalf("unexpected legacy address %s", addr.EncodeAddress())
+	}
+	if _, err := GetChainProfile("bogus"); err == nil {
+		t.Fatal("expected unknown profile error")
+	}
+}
+
+func TestNode_GenerateCoinbasePadding(t *testing.T) {
+	for _, profile := range []*ChainProfile{BitcoinProfile, BitcoinCashProfile} {
+		node := NewNode(&config.Node{})
+		node.profile = profile
+		node.walletAddress, _ = btcutil.NewAddressPubKeyHash(make([]byte, 20), &chaincfg.RegressionNetParams)
+		coinbase, err := node.GenerateCoinbase(1, 0, 5000000000, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var size = coinbase.MsgTx().SerializeSizeStripped()
+		if profile.MinCoinbaseSize > 0 && size != profile.MinCoinbaseSize {
+			t.Fatalf("%s coinbase is %d bytes", profile.Name, size)
+		}
+		if profile.MinCoinbaseSize == 0 && size >= BitcoinCashProfile.MinCoinbaseSize {
+			t.Fatalf("%s coinbase padded to %d bytes", profile.Name, size)
+		}
+		if err := blockchain.CheckTransactionSanity(coinbase); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTemplateSelection_WitnessCommitment(t *testing.T) {
+	var p2wpkh = append([]byte{0x00, 0x14}, make([]byte, 20)...)
+	var template = &btcjson.GetBlockTemplateResult{
+		CoinbaseValue: 625000000 + 100 + 200,
+		Transactions:  []btcjson.GetBlockTemplateResultTx{testTemplateTx(t, 1, p2wpkh, 100)},
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{2}, 0),
+		Witness:          wire.TxWitness{[]byte{0x01}, make([]byte, 33)},
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	tx.AddTxOut(&wire.TxOut{Value: 1000, PkScript: p2wpkh})
+	data, err := MsgTxToString(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.Transactions = append(template.Transactions, btcjson.GetBlockTemplateResultTx{
+		Data: data, Hash: tx.TxHash().String(), Fee: 200, SigOps: 1, Weight: int64(tx.SerializeSize() * 4),
+	})
+	policy, err := NewTemplatePolicy(&config.TemplatePolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	selection, err := policy.Select(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selection.WitnessCommitment(1) != nil {
+		t.Fatal("commitment without witness transactions")
+	}
+	var commitment = selection.WitnessCommitment(2)
+	if commitment == nil {
+		t.Fatal("missing commitment")
+	}
+	node := NewNode(&config.Node{})
+	node.walletAddress, _ = btcutil.NewAddressPubKeyHash(make([]byte, 20), &chaincfg.RegressionNetParams)
+	coinbase, err := node.GenerateCoinbase(1, 0, template.CoinbaseValue, commitment, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgBlock = wire.MsgBlock{Transactions: []*wire.MsgTx{coinbase.MsgTx()}}
+	for _, selected := range selection.Transactions {
+		msgTx, err := ToMsgTx(selected.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgBlock.Transactions = append(msgBlock.Transactions, msgTx)
+	}
+	if err := blockchain.ValidateWitnessCommitment(btcutil.NewBlock(&msgBlock)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,104 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"sync"
+)
+
+const (
+	ExtraNonceSequential = "sequential"
+	ExtraNonceShuffled   = "shuffled"
+	// ExtraNonceSpace keeps the extranonce within a 32 bit push in the coinbase script.
+	ExtraNonceSpace = uint64(1) << 32
+	extraNonceMask  = ExtraNonceSpace - 1
+)
+
+var ErrExtraNonceExhausted = errors.New("extranonce space exhausted")
+
+type ExtraNonceCoverage struct {
+	PrevHash chainhash.Hash
+	Issued   uint64
+	Space    uint64
+}
+
+func (c ExtraNonceCoverage) Ratio() float64 {
+	return float64(c.Issued) / float64(c.Space)
+}
+
+// ExtraNonceAllocator hands out every extranonce at most once per previous block hash, so no coinbase is ever hashed
+// twice on the same chain tip. Shuffled mode walks the same space through a seeded bijection instead of in order.
+type ExtraNonceAllocator struct {
+	shuffled   bool
+	started    bool
+	prevHash   chainhash.Hash
+	issued     uint64
+	multiplier uint64
+	offset     uint64
+	mtx        sync.Mutex
+}
+
+func NewExtraNonceAllocator(mode string) (*ExtraNonceAllocator, error) {
+	switch mode {
+	case "", ExtraNonceShuffled:
+		return &ExtraNonceAllocator{shuffled: true}, nil
+	case ExtraNonceSequential:
+		return &ExtraNonceAllocator{}, nil
+	default:
+		return nil, fmt.Errorf("node.NewExtraNonceAllocator: unknown extranonce mode %s", mode)
+	}
+}
+
+// Reset starts a fresh extranonce space when the previous block hash changes. It reports whether a reset happened
+// along with the coverage reached on the previous hash.
+func (a *ExtraNonceAllocator) Reset(prevHash chainhash.Hash) (bool, ExtraNonceCoverage) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	var coverage = a.coverage()
+	if a.started && prevHash == a.prevHash {
+		return false, coverage
+	}
+	a.started = true
+	a.prevHash = prevHash
+	a.issued = 0
+	// any odd multiplier makes the affine step a permutation of the space
+	a.multiplier = (utils.RandomUint64() | 0x1) & extraNonceMask
+	a.offset = utils.RandomUint64() & extraNonceMask
+	return true, coverage
+}
+
+func (a *ExtraNonceAllocator) permute(index uint64) uint64 {
+	var value = (index*a.multiplier + a.offset) & extraNonceMask
+	// xorshift steps are invertible and break up the arithmetic progression
+	value ^= value >> 17
+	value = (value * 0x2c1b3c6d) & extraNonceMask
+	value ^= value >> 15
+	return value
+}
+
+// Next returns the next unused extranonce for the current previous block hash.
+func (a *ExtraNonceAllocator) Next() (int64, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if a.issued >= ExtraNonceSpace {
+		return 0, ErrExtraNonceExhausted
+	}
+	var index = a.issued
+	a.issued += 1
+	if a.shuffled {
+		return int64(a.permute(index)), nil
+	}
+	return int64(index), nil
+}
+
+func (a *ExtraNonceAllocator) coverage() ExtraNonceCoverage {
+	return ExtraNonceCoverage{PrevHash: a.prevHash, Issued: a.issued, Space: ExtraNonceSpace}
+}
+
+func (a *ExtraNonceAllocator) Coverage() ExtraNonceCoverage {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.coverage()
+}
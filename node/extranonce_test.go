@@ -0,0 +1,57 @@
+package node
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"testing"
+)
+
+func TestExtraNonceAllocator_Shuffled(t *testing.T) {
+	allocator, err := NewExtraNonceAllocator(ExtraNonceShuffled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reset, _ := allocator.Reset(chainhash.Hash{1}); !reset {
+		t.Fatal("first reset ignored")
+	}
+	var seen = map[int64]bool{}
+	for i := 0; i < 1<<16; i++ {
+		extraNonce, err := allocator.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if extraNonce < 0 || uint64(extraNonce) >= ExtraNonceSpace || seen[extraNonce] {
+			t.Fatalf("extranonce %d repeated or out of range", extraNonce)
+		}
+		seen[extraNonce] = true
+	}
+	if reset, _ := allocator.Reset(chainhash.Hash{1}); reset {
+		t.Fatal("reset on the same previous hash")
+	}
+	reset, coverage := allocator.Reset(chainhash.Hash{2})
+	if !reset || coverage.Issued != 1<<16 || coverage.PrevHash != (chainhash.Hash{1}) {
+		t.Fatalf("unexpected coverage %+v", coverage)
+	}
+	if allocator.Coverage().Issued != 0 {
+		t.Fatal("coverage not reset")
+	}
+}
+
+func TestExtraNonceAllocator_Sequential(t *testing.T) {
+	allocator, err := NewExtraNonceAllocator(ExtraNonceSequential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allocator.Reset(chainhash.Hash{1})
+	for i := int64(0); i < 16; i++ {
+		if extraNonce, _ := allocator.Next(); extraNonce != i {
+			t.Fatalf("expected %d, got %d", i, extraNonce)
+		}
+	}
+	allocator.issued = ExtraNonceSpace
+	if _, err := allocator.Next(); err != ErrExtraNonceExhausted {
+		t.Fatalf("expected exhaustion, got %v", err)
+	}
+	if _, err := NewExtraNonceAllocator("random"); err == nil {
+		t.Fatal("unknown mode accepted")
+	}
+}
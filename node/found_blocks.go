@@ -0,0 +1,216 @@
+package node
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/btcsuite/btcutil"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+const (
+	FoundBlocksPath         = "blocks"
+	FoundBlocksJournal      = "found.jsonl"
+	FoundBlockMaturity      = 100
+	FoundBlocksNotifyBuffer = 64
+)
+
+type FoundBlockState string
+
+const (
+	BlockSubmitted FoundBlockState = "submitted"
+	BlockRejected  FoundBlockState = "rejected"
+	BlockAccepted  FoundBlockState = "accepted"
+	BlockOrphaned  FoundBlockState = "orphaned"
+	BlockMatured   FoundBlockState = "matured"
+)
+
+// Final reports whether the checker can stop following a block.
+func (s FoundBlockState) Final() bool {
+	return s == BlockRejected || s == BlockOrphaned || s == BlockMatured
+}
+
+type FoundBlock struct {
+	Height        int32           `json:"height"`
+	Hash          string          `json:"hash"`
+	CoinbaseValue int64           `json:"coinbaseValue"`
+	SubmitResult  string          `json:"submitResult"`
+	State         FoundBlockState `json:"state"`
+	Confirmations int64           `json:"confirmations"`
+	FoundTime     time.Time       `json:"foundTime"`
+	UpdatedTime   time.Time       `json:"updatedTime"`
+}
+
+// FoundBlocks is an append-only journal of found blocks. Every state change appends a full record, and loading
+// replays the journal so the latest record for each hash wins.
+type FoundBlocks struct {
+	journalPath string
+	blocks      []*FoundBlock
+	byHash      map[string]*FoundBlock
+	notifyChan  chan FoundBlock
+	mtx         sync.Mutex
+}
+
+func GetFoundBlocksPath() string {
+	return path.Join(utils.GetSubFolder(FoundBlocksPath), FoundBlocksJournal)
+}
+
+func LoadFoundBlocks(journalPath string) (*FoundBlocks, error) {
+	var fb = &FoundBlocks{
+		journalPath: journalPath,
+		byHash:      map[string]*FoundBlock{},
+		notifyChan:  make(chan FoundBlock, FoundBlocksNotifyBuffer),
+	}
+	f, openErr := os.Open(journalPath)
+	if os.IsNotExist(openErr) {
+		return fb, nil
+	} else if openErr != nil {
+		return nil, openErr
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil {
+			log.WithError(closeErr).Warn("Error closing file")
+		}
+	}()
+	var scanner = bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record FoundBlock
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, err
+		}
+		fb.set(&record)
+	}
+	return fb, scanner.Err()
+}
+
+func (fb *FoundBlocks) set(record *FoundBlock) {
+	if existing, found := fb.byHash[record.Hash]; found {
+		*existing = *record
+		return
+	}
+	var block = *record
+	fb.blocks = append(fb.blocks, &block)
+	fb.byHash[block.Hash] = &block
+}
+
+func (fb *FoundBlocks) append(record *FoundBlock) error {
+	f, err := os.OpenFile(fb.journalPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (fb *FoundBlocks) update(record *FoundBlock) {
+	record.UpdatedTime = time.Now()
+	fb.set(record)
+	if err := fb.append(record); err != nil {
+		log.WithError(err).WithField("hash", record.Hash).Error("Error writing found blocks journal")
+	}
+	log.WithFields(log.Fields{
+		"height":        record.Height,
+		"hash":          record.Hash,
+		"state":         record.State,
+		"confirmations": record.Confirmations,
+		"coinbaseValue": btcutil.Amount(record.CoinbaseValue),
+		"submitResult":  record.SubmitResult,
+	}).Warn("Found block state change")
+	// the journal is the source of truth, so a full notification buffer drops the change
+	select {
+	case fb.notifyChan <- *record:
+	default:
+	}
+}
+
+// Record journals a freshly submitted block along with the result of submitblock.
+func (fb *FoundBlocks) Record(block *btcutil.Block, submitErr error) {
+	var coinbaseValue int64
+	if transactions := block.Transactions(); len(transactions) > 0 {
+		for _, txOut := range transactions[0].MsgTx().TxOut {
+			coinbaseValue += txOut.Value
+		}
+	}
+	var record = &FoundBlock{
+		Height:        block.Height(),
+		Hash:          block.Hash().String(),
+		CoinbaseValue: coinbaseValue,
+		SubmitResult:  "accepted",
+		State:         BlockSubmitted,
+		FoundTime:     time.Now(),
+	}
+	if submitErr != nil {
+		record.SubmitResult = submitErr.Error()
+		// bitcoind reports these for blocks it already has or could not fully validate yet
+		if record.SubmitResult != "duplicate" && record.SubmitResult != "inconclusive" {
+			record.State = BlockRejected
+		}
+	}
+	fb.mtx.Lock()
+	defer fb.mtx.Unlock()
+	fb.update(record)
+}
+
+// SetState moves a block to a new state, journaling and notifying only when something changed.
+func (fb *FoundBlocks) SetState(hash string, state FoundBlockState, confirmations int64) {
+	fb.mtx.Lock()
+	defer fb.mtx.Unlock()
+	existing, found := fb.byHash[hash]
+	if !found || (existing.State == state && existing.Confirmations == confirmations) {
+		return
+	}
+	var record = *existing
+	var stateChanged = record.State != state
+	record.State = state
+	record.Confirmations = confirmations
+	if stateChanged {
+		fb.update(&record)
+	} else {
+		*existing = record
+	}
+}
+
+// Pending returns copies of every block that has not reached a final state.
+func (fb *FoundBlocks) Pending() []FoundBlock {
+	fb.mtx.Lock()
+	defer fb.mtx.Unlock()
+	var pending []FoundBlock
+	for _, block := range fb.blocks {
+		if !block.State.Final() {
+			pending = append(pending, *block)
+		}
+	}
+	return pending
+}
+
+func (fb *FoundBlocks) All() []FoundBlock {
+	fb.mtx.Lock()
+	defer fb.mtx.Unlock()
+	var all = make([]FoundBlock, len(fb.blocks))
+	for i, block := range fb.blocks {
+		all[i] = *block
+	}
+	return all
+}
+
+// NotifyChan delivers a copy of every journaled state change to an optional consumer. It holds up to
+// FoundBlocksNotifyBuffer changes; once full, newer changes are dropped rather than blocking the submit and
+// maturity paths, so a consumer that falls behind must read All for the current state.
+func (fb *FoundBlocks) NotifyChan() <-chan FoundBlock {
+	return fb.notifyChan
+}
@@ -0,0 +1,98 @@
+package node
+
+import (
+	"errors"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func testFoundBlock(seed byte, height int32) *btcutil.Block {
+	var msgBlock wire.MsgBlock
+	msgBlock.Header.Nonce = uint32(seed)
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(&wire.TxIn{PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex)})
+	coinbase.AddTxOut(&wire.TxOut{Value: 312500000})
+	coinbase.AddTxOut(&wire.TxOut{Value: 0})
+	_ = msgBlock.AddTransaction(coinbase)
+	block := btcutil.NewBlock(&msgBlock)
+	block.SetHeight(height)
+	return block
+}
+
+func TestFoundBlocks_Journal(t *testing.T) {
+	folder, err := ioutil.TempDir("", "goasicminer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	journalPath := path.Join(folder, FoundBlocksJournal)
+	fb, err := LoadFoundBlocks(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := testFoundBlock(1, 100)
+	rejected := testFoundBlock(2, 101)
+	fb.Record(accepted, nil)
+	fb.Record(rejected, errors.New("high-hash"))
+	if notification := <-fb.NotifyChan(); notification.State != BlockSubmitted ||
+		notification.CoinbaseValue != 312500000 {
+		t.Fatalf("unexpected notification %+v", notification)
+	}
+	if pending := fb.Pending(); len(pending) != 1 || pending[0].Hash != accepted.Hash().String() {
+		t.Fatal("rejected block still pending")
+	}
+	fb.SetState(accepted.Hash().String(), BlockAccepted, 1)
+	fb.SetState(accepted.Hash().String(), BlockAccepted, 2)
+	fb.SetState(accepted.Hash().String(), BlockOrphaned, 0)
+	reloaded, err := LoadFoundBlocks(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := reloaded.All()
+	if len(all) != 2 {
+		t.Fatalf("expected 2 journaled blocks, got %d", len(all))
+	}
+	if all[0].State != BlockOrphaned || all[1].State != BlockRejected || all[1].SubmitResult != "high-hash" {
+		t.Fatalf("unexpected replayed states %s %s", all[0].State, all[1].State)
+	}
+	if len(reloaded.Pending()) != 0 {
+		t.Fatal("final blocks reported as pending")
+	}
+}
+
+func TestFoundBlocks_NotifyDropsWhenFull(t *testing.T) {
+	folder, err := ioutil.TempDir("", "goasicminer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	fb, err := LoadFoundBlocks(path.Join(folder, FoundBlocksJournal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blocks = FoundBlocksNotifyBuffer + 8
+	for i := 0; i < blocks; i++ {
+		fb.Record(testFoundBlock(byte(i), int32(100+i)), nil)
+	}
+	if len(fb.All()) != blocks {
+		t.Fatalf("expected %d journaled blocks, got %d", blocks, len(fb.All()))
+	}
+	if queued := len(fb.NotifyChan()); queued != FoundBlocksNotifyBuffer {
+		t.Fatalf("expected %d queued notifications, got %d", FoundBlocksNotifyBuffer, queued)
+	}
+	if notification := <-fb.NotifyChan(); notification.Height != 100 {
+		t.Fatalf("expected the oldest change first, got height %d", notification.Height)
+	}
+	fb.Record(testFoundBlock(byte(blocks), int32(100+blocks)), nil)
+	for i := 0; i < FoundBlocksNotifyBuffer-1; i++ {
+		<-fb.NotifyChan()
+	}
+	if notification := <-fb.NotifyChan(); notification.Height != int32(100+blocks) {
+		t.Fatalf("expected the change after draining, got height %d", notification.Height)
+	}
+}
@@ -0,0 +1,37 @@
+package node
+
+import (
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// MerkleBranch returns the sibling hashes along the path of the first leaf of a merkle tree whose remaining leaves
+// are the given transaction hashes. Combined with a coinbase hash through MerkleRootFromBranch it yields the same
+// root as blockchain.BuildMerkleTreeStore.
+func MerkleBranch(hashes []chainhash.Hash) []chainhash.Hash {
+	var branch []chainhash.Hash
+	var level = make([]*chainhash.Hash, len(hashes)+1)
+	for i := range hashes {
+		level[i+1] = &hashes[i]
+	}
+	for len(level) > 1 {
+		branch = append(branch, *level[1])
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		var next = make([]*chainhash.Hash, 1, len(level)/2)
+		for i := 2; i < len(level); i += 2 {
+			next = append(next, blockchain.HashMerkleBranches(level[i], level[i+1]))
+		}
+		level = next
+	}
+	return branch
+}
+
+func MerkleRootFromBranch(coinbaseHash chainhash.Hash, branch []chainhash.Hash) chainhash.Hash {
+	var root = &coinbaseHash
+	for i := range branch {
+		root = blockchain.HashMerkleBranches(root, &branch[i])
+	}
+	return *root
+}
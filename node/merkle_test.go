@@ -0,0 +1,31 @@
+package node
+
+import (
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"testing"
+)
+
+func TestMerkleRootFromBranch(t *testing.T) {
+	for count := 0; count < 34; count++ {
+		var transactions = make([]*btcutil.Tx, count+1)
+		var hashes = make([]chainhash.Hash, count)
+		for i := range transactions {
+			tx := wire.NewMsgTx(wire.TxVersion)
+			tx.AddTxIn(&wire.TxIn{
+				PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{byte(i), byte(count)}, 0),
+			})
+			transactions[i] = btcutil.NewTx(tx)
+			if i > 0 {
+				hashes[i-1] = *transactions[i].Hash()
+			}
+		}
+		merkles := blockchain.BuildMerkleTreeStore(transactions, false)
+		root := MerkleRootFromBranch(*transactions[0].Hash(), MerkleBranch(hashes))
+		if !root.IsEqual(merkles[len(merkles)-1]) {
+			t.Fatalf("merkle root mismatch with %d transactions", count)
+		}
+	}
+}
@@ -3,9 +3,7 @@ package node
 import (
 	"encoding/binary"
 	"encoding/hex"
-	"errors"
-	"fmt"
-	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 	"github.com/fernandosanchezjr/goasicminer/config"
@@ -14,7 +12,9 @@ import (
 	rpcclient "github.com/stevenroose/go-bitcoin-core-rpc"
 	"github.com/stevenroose/go-bitcoin-core-rpc/btcjson"
 	"math/big"
+	"path"
 	"sync"
+	"time"
 )
 
 type State int
@@ -25,37 +25,62 @@ const (
 )
 
 type Node struct {
-	config         *config.Node
-	client         *rpcclient.Client
-	status         State
-	mtx            sync.Mutex
-	chainName      string
-	walletAddress  btcutil.Address
-	pollingExit    chan struct{}
-	workChan       chan *Work
-	generateChan   chan int
-	generateExit   chan struct{}
-	log            *log.Entry
-	blockChainInfo *btcjson.GetBlockChainInfoResult
-	blockTemplate  *btcjson.GetBlockTemplateResult
+	config          *config.Node
+	client          *rpcclient.Client
+	clientUsers     map[*rpcclient.Client]int
+	status          State
+	mtx             sync.Mutex
+	chainName       string
+	walletAddress   btcutil.Address
+	payout          *PayoutWallet
+	payoutIndexPath string
+	profile         *ChainProfile
+	pollingExit     chan struct{}
+	workChan        chan *Work
+	generateChan    chan int
+	generateExit    chan struct{}
+	log             *log.Entry
+	blockChainInfo  *btcjson.GetBlockChainInfoResult
+	blockTemplate   *btcjson.GetBlockTemplateResult
+	policy          *TemplatePolicy
+	selection       *TemplateSelection
+	foundBlocks     *FoundBlocks
+	extraNonces     *ExtraNonceAllocator
+	refresh         *TemplateRefresh
+	longPollID      string
+	templateTime    time.Time
+	templateMtx     sync.Mutex
+	auxClient       *rpcclient.Client
+	auxBlock        *AuxBlock
+	auxMtx          sync.Mutex
 }
 
 func NewNode(config *config.Node) *Node {
 	return &Node{
 		config: config, status: Disconnected,
+		clientUsers:  map[*rpcclient.Client]int{},
 		workChan:     make(chan *Work, 1024),
 		generateChan: make(chan int, 1024),
 	}
 }
 
+// dataPath keeps the files of a node of the nodes section apart from those of the main node, prefixing its name.
+func (n *Node) dataPath(filePath string) string {
+	if n.config.Name == "" {
+		return filePath
+	}
+	return path.Join(path.Dir(filePath), n.config.Name+"-"+path.Base(filePath))
+}
+
 func (n *Node) getClient() (*rpcclient.Client, error) {
-	if n.config == nil {
-		return nil, errors.New("no node configuration found")
+	user, pass, err := n.getCredentials()
+	if err != nil {
+		return nil, err
 	}
 	return rpcclient.New(&rpcclient.ConnConfig{
 		Host: n.config.URL,
-		User: n.config.User,
-		Pass: n.config.Pass,
+		User: user,
+		Pass: pass,
 	})
 }
 
@@ -78,137 +103,253 @@ func (n *Node) Connect() error {
 
 func (n *Node) setup() error {
 	n.log = log.WithField("node", n.config.URL)
+	profile, profileErr := GetChainProfile(n.config.Profile)
+	if profileErr != nil {
+		n.dropClient()
+		return profileErr
+	}
+	n.profile = profile
+	policy, policyErr := NewTemplatePolicy(&n.config.Template)
+	if policyErr != nil {
+		n.dropClient()
+		return policyErr
+	}
+	n.policy = policy
+	extraNonces, extraNoncesErr := NewExtraNonceAllocator(n.config.ExtraNonce)
+	if extraNoncesErr != nil {
+		n.dropClient()
+		return extraNoncesErr
+	}
+	n.extraNonces = extraNonces
+	n.refresh = NewTemplateRefresh(&n.config.Refresh)
 	info, infoErr := n.GetInfo()
 	if infoErr != nil {
-		n.status = Disconnected
-		n.client = nil
+		n.dropClient()
 		return infoErr
 	}
-	n.chainName = fmt.Sprintf("%snet", info.Chain)
+	n.chainName = info.Chain
 	params, paramsErr := n.GetChainParams()
 	if paramsErr != nil {
-		n.status = Disconnected
-		n.client = nil
+		n.dropClient()
 		return paramsErr
 	}
-	addr, addrErr := btcutil.DecodeAddress(n.config.Wallet, params)
+	addr, addrErr := n.setupPayout(params)
 	if addrErr != nil {
-		n.status = Disconnected
-		n.client = nil
+		n.dropClient()
 		return addrErr
 	}
 	n.log.WithFields(log.Fields{
-		"chain":  info.Chain,
-		"blocks": info.Blocks,
+		"chain":   info.Chain,
+		"profile": n.profile.Name,
+		"blocks":  info.Blocks,
 	}).Println("Node info")
 	n.walletAddress = addr
+	if n.config.AuxPoW != nil {
+		auxClient, auxClientErr := n.getAuxClient()
+		if auxClientErr != nil {
+			n.dropClient()
+			return auxClientErr
+		}
+		n.auxMtx.Lock()
+		if n.auxClient != nil {
+			n.auxClient.Shutdown()
+		}
+		n.auxClient = auxClient
+		n.auxMtx.Unlock()
+	}
 	n.pollingExit = make(chan struct{})
 	if !n.config.ClientOnly {
+		if n.foundBlocks == nil {
+			foundBlocks, foundBlocksErr := LoadFoundBlocks(n.dataPath(GetFoundBlocksPath()))
+			if foundBlocksErr != nil {
+				n.dropClient()
+				return foundBlocksErr
+			}
+			n.foundBlocks = foundBlocks
+		}
 		go n.pollingLoop()
 		go n.generateLoop()
+		go n.foundBlocksLoop()
+		if !n.refresh.Disabled {
+			go n.refreshLoop()
+		}
+		if n.config.AuxPoW != nil {
+			go n.auxLoop()
+		}
 	}
 	return nil
 }
 
-func (n *Node) Disconnect() {
+// acquireClient returns the shared RPC client, or nil once the node is disconnected. A credential refresh may swap
+// the client at any time, so the one returned is kept open until the caller hands it back with releaseClient.
+func (n *Node) acquireClient() *rpcclient.Client {
 	n.mtx.Lock()
+	defer n.mtx.Unlock()
 	if n.status == Disconnected {
-		n.mtx.Unlock()
+		return nil
+	}
+	n.clientUsers[n.client] += 1
+	return n.client
+}
+
+// releaseClient hands back a client from acquireClient, shutting it down once its last caller is done if it was
+// swapped out meanwhile.
+func (n *Node) releaseClient(client *rpcclient.Client) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.clientUsers[client] -= 1
+	if n.clientUsers[client] > 0 {
 		return
 	}
-	n.mtx.Unlock()
-	n.log.Println("Node disconnecting")
-	close(n.pollingExit)
+	delete(n.clientUsers, client)
+	if client != n.client {
+		client.Shutdown()
+	}
+}
+
+// dropClient marks the node disconnected, so requests in flight keep their client and new ones are skipped.
+func (n *Node) dropClient() {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
 	n.client = nil
 	n.status = Disconnected
-	n.blockTemplate = nil
 	n.blockChainInfo = nil
 }
 
-func (n *Node) GetInfo() (*btcjson.GetBlockChainInfoResult, error) {
+func (n *Node) connected() bool {
 	n.mtx.Lock()
 	defer n.mtx.Unlock()
-	if n.status == Disconnected {
-		return nil, nil
-	}
-	if result, err := n.client.GetBlockChainInfo(); err != nil {
-		return nil, err
-	} else {
-		n.blockChainInfo = result
-		return result, err
-	}
+	return n.status == Connected
 }
 
-func (n *Node) GetBlockTemplate() (*btcjson.GetBlockTemplateResult, error) {
+func (n *Node) Disconnect() {
 	n.mtx.Lock()
 	if n.status == Disconnected {
 		n.mtx.Unlock()
-		return nil, nil
+		return
 	}
 	n.mtx.Unlock()
+	n.log.Println("Node disconnecting")
+	close(n.pollingExit)
+	n.dropClient()
+	n.templateMtx.Lock()
+	n.blockTemplate = nil
+	n.selection = nil
+	n.templateMtx.Unlock()
+	n.auxMtx.Lock()
+	n.auxBlock = nil
+	n.auxMtx.Unlock()
+}
+
+func (n *Node) GetInfo() (*btcjson.GetBlockChainInfoResult, error) {
+	var result *btcjson.GetBlockChainInfoResult
+	if err := n.withClient(func(client *rpcclient.Client) (err error) {
+		result, err = client.GetBlockChainInfo()
+		return
+	}); err != nil || result == nil {
+		return nil, err
+	}
+	n.mtx.Lock()
+	n.blockChainInfo = result
+	n.mtx.Unlock()
+	return result, nil
+}
+
+// GetBlockTemplate longpolls for the next template on the current client.
+func (n *Node) GetBlockTemplate() (*btcjson.GetBlockTemplateResult, error) {
 	options := &btcjson.TemplateRequest{
 		Capabilities: []string{"longpoll"},
-		Rules:        []string{"segwit"},
-	}
-	if n.blockTemplate != nil {
-		options.LongPollID = n.blockTemplate.LongPollID
+		Rules:        n.profile.Rules,
+		LongPollID:   n.longPollID,
 	}
-	if response, err := n.client.GetBlockTemplate(options); err != nil {
+	var response *btcjson.GetBlockTemplateResult
+	if err := n.withClient(func(client *rpcclient.Client) (err error) {
+		response, err = client.GetBlockTemplate(options)
+		return
+	}); err != nil || response == nil {
 		return nil, err
+	}
+	n.longPollID = response.LongPollID
+	return response, nil
+}
+
+// UpdateTemplate applies the selection policy to a fetched template and makes it current when the refresh rules
+// allow, reporting whether new work should be generated. The polling and refresh loops race, so a template fetched
+// before the current one is dropped rather than taken for a newer mempool, so callers pass the time closest to when
+// the node built it.
+func (n *Node) UpdateTemplate(response *btcjson.GetBlockTemplateResult, fetched time.Time) (bool, error) {
+	selection, selectionErr := n.policy.Select(response)
+	if selectionErr != nil {
+		return false, selectionErr
+	}
+	previousHash, previousHashErr := chainhash.NewHashFromStr(response.PreviousHash)
+	if previousHashErr != nil {
+		return false, previousHashErr
+	}
+	var nBits uint32
+	if data, err := hex.DecodeString(response.Bits); err != nil {
+		return false, err
 	} else {
-		n.blockTemplate = response
-		var nBits uint32
-		var resultDiff big.Int
-		var diff utils.Difficulty
-		if data, err := hex.DecodeString(response.Bits); err != nil {
-			return nil, err
-		} else {
-			nBits = binary.BigEndian.Uint32(data)
-		}
-		utils.CalculateDifficulty(utils.CompactToBig(nBits), &resultDiff)
-		diff = utils.Difficulty(resultDiff.Int64())
+		nBits = binary.BigEndian.Uint32(data)
+	}
+	n.templateMtx.Lock()
+	if n.blockTemplate != nil && fetched.Before(n.templateTime) {
+		n.templateMtx.Unlock()
+		return false, nil
+	}
+	var reason = n.refresh.Reason(n.blockTemplate, n.selection, fetched.Sub(n.templateTime), response, selection)
+	if reason == "" {
+		n.templateMtx.Unlock()
+		return false, nil
+	}
+	if reset, coverage := n.extraNonces.Reset(*previousHash); reset && coverage.Issued > 0 {
 		n.log.WithFields(log.Fields{
-			"height":       response.Height,
-			"transactions": len(response.Transactions),
-			"previousHash": response.PreviousHash,
-			"nTime":        utils.NTime(response.CurTime),
-			"minNtime":     utils.NTime(response.MinTime),
-			"maxNtime":     utils.NTime(response.MaxTime),
-			"mutable":      response.Mutable,
-			"difficulty":   diff,
-		}).Println("GetBlockTemplate")
-		return response, nil
+			"previousHash": coverage.PrevHash,
+			"issued":       coverage.Issued,
+			"coverage":     coverage.Ratio(),
+		}).Println("Extranonce coverage")
 	}
+	n.blockTemplate = response
+	n.selection = selection
+	n.templateTime = fetched
+	n.templateMtx.Unlock()
+	var resultDiff big.Int
+	utils.CalculateDifficulty(utils.CompactToBig(nBits), &resultDiff)
+	n.log.WithFields(log.Fields{
+		"height":       response.Height,
+		"transactions": len(response.Transactions),
+		"selected":     len(selection.Transactions),
+		"fees":         btcutil.Amount(selection.Fees),
+		"reason":       reason,
+		"previousHash": response.PreviousHash,
+		"nTime":        utils.NTime(response.CurTime),
+		"minNtime":     utils.NTime(response.MinTime),
+		"maxNtime":     utils.NTime(response.MaxTime),
+		"mutable":      response.Mutable,
+		"difficulty":   utils.Difficulty(resultDiff.Int64()),
+	}).Println("GetBlockTemplate")
+	return true, nil
 }
 
 func (n *Node) GetBlockHeader(height int32) (*wire.BlockHeader, error) {
-	n.mtx.Lock()
-	defer n.mtx.Unlock()
-	if n.status == Disconnected {
-		return nil, nil
-	}
-	hash, hashErr := n.client.GetBlockHash(int64(height))
-	if hashErr != nil {
-		return nil, hashErr
-	}
-	return n.client.GetBlockHeader(hash)
-}
-
-func (n *Node) GetChainParams() (*chaincfg.Params, error) {
-	switch n.chainName {
-	case "":
-		fallthrough
-	case chaincfg.MainNetParams.Name:
-		return &chaincfg.MainNetParams, nil
-	case chaincfg.TestNet3Params.Name:
-		return &chaincfg.TestNet3Params, nil
-	case chaincfg.RegressionNetParams.Name:
-		return &chaincfg.RegressionNetParams, nil
-	case chaincfg.SimNetParams.Name:
-		return &chaincfg.SimNetParams, nil
-	default:
-		return nil, fmt.Errorf("node.GetChainParams: Unknown chain %s", n.chainName)
+	var header *wire.BlockHeader
+	err := n.withClient(func(client *rpcclient.Client) error {
+		hash, hashErr := client.GetBlockHash(int64(height))
+		if hashErr != nil {
+			return hashErr
+		}
+		var headerErr error
+		header, headerErr = client.GetBlockHeader(hash)
+		return headerErr
+	})
+	return header, err
+}
+
+func (n *Node) ExtraNonceCoverage() ExtraNonceCoverage {
+	if n.extraNonces == nil {
+		return ExtraNonceCoverage{Space: ExtraNonceSpace}
 	}
+	return n.extraNonces.Coverage()
 }
 
 func (n *Node) GetWorkChan() chan *Work {
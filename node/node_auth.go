@@ -0,0 +1,128 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"github.com/mitchellh/go-homedir"
+	rpcclient "github.com/stevenroose/go-bitcoin-core-rpc"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// readCredentialsFile parses a file in bitcoind's cookie format, a single user:password line.
+func readCredentialsFile(filePath string) (string, string, error) {
+	expandedPath, expandErr := homedir.Expand(filePath)
+	if expandErr != nil {
+		return "", "", expandErr
+	}
+	data, readErr := ioutil.ReadFile(expandedPath)
+	if readErr != nil {
+		return "", "", readErr
+	}
+	line := strings.TrimSpace(strings.SplitN(string(data), "\n", 2)[0])
+	separator := strings.Index(line, ":")
+	if separator <= 0 {
+		return "", "", fmt.Errorf("node.readCredentialsFile: malformed credentials in %s", expandedPath)
+	}
+	return line[:separator], line[separator+1:], nil
+}
+
+// resolveCredentials reads RPC credentials in order of precedence: cookie file, secrets file, environment variables
+// and finally the plaintext user and pass.
+func resolveCredentials(credentials *config.Credentials) (string, string, error) {
+	if credentials.CookieFile != "" {
+		return readCredentialsFile(credentials.CookieFile)
+	}
+	if credentials.SecretsFile != "" {
+		return readCredentialsFile(credentials.SecretsFile)
+	}
+	var user, pass = credentials.User, credentials.Pass
+	if credentials.UserEnv != "" {
+		if value, found := os.LookupEnv(credentials.UserEnv); found {
+			user = value
+		} else {
+			return "", "", fmt.Errorf("node.resolveCredentials: environment variable %s not set", credentials.UserEnv)
+		}
+	}
+	if credentials.PassEnv != "" {
+		if value, found := os.LookupEnv(credentials.PassEnv); found {
+			pass = value
+		} else {
+			return "", "", fmt.Errorf("node.resolveCredentials: environment variable %s not set", credentials.PassEnv)
+		}
+	}
+	return user, pass, nil
+}
+
+func (n *Node) getCredentials() (string, string, error) {
+	if n.config == nil {
+		return "", "", errors.New("no node configuration found")
+	}
+	return resolveCredentials(&n.config.Credentials)
+}
+
+func isAuthError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "status code: 401")
+}
+
+// refreshClient rebuilds the RPC client with freshly read credentials, picking up a new cookie after a node restart.
+// The new client takes over at once, while the old one stays open for the calls still using it, such as the pending
+// longpoll.
+func (n *Node) refreshClient() error {
+	client, err := n.getClient()
+	if err != nil {
+		return err
+	}
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	if n.status == Disconnected {
+		client.Shutdown()
+		return nil
+	}
+	var previous = n.client
+	n.client = client
+	if previous != nil && n.clientUsers[previous] == 0 {
+		previous.Shutdown()
+	}
+	return nil
+}
+
+// withClient runs call on the shared RPC client. When the node rejects the credentials the client is rebuilt from
+// freshly read ones and the call is tried once more. Nothing is called on a disconnected node.
+func (n *Node) withClient(call func(client *rpcclient.Client) error) error {
+	client := n.acquireClient()
+	if client == nil {
+		return nil
+	}
+	err := call(client)
+	n.releaseClient(client)
+	if !isAuthError(err) {
+		return err
+	}
+	if refreshErr := n.refreshClient(); refreshErr != nil {
+		return refreshErr
+	}
+	if client = n.acquireClient(); client == nil {
+		return nil
+	}
+	defer n.releaseClient(client)
+	return call(client)
+}
+
+// withNewClient runs call on a client of its own, for requests that must not queue behind the pending longpoll on
+// the shared client. Credentials are read for every client, and the call is tried once more if they were rejected.
+func (n *Node) withNewClient(call func(client *rpcclient.Client) error) error {
+	for attempt := 0; ; attempt++ {
+		client, err := n.getClient()
+		if err != nil {
+			return err
+		}
+		err = call(client)
+		client.Shutdown()
+		if !isAuthError(err) || attempt > 0 {
+			return err
+		}
+	}
+}
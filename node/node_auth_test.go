@@ -0,0 +1,95 @@
+package node
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/config"
+	rpcclient "github.com/stevenroose/go-bitcoin-core-rpc"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestNode_CookieCredentials(t *testing.T) {
+	folder, err := ioutil.TempDir("", "goasicminer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	cookiePath := path.Join(folder, ".cookie")
+	if err := ioutil.WriteFile(cookiePath, []byte("__cookie__:abc:def\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	node := NewNode(&config.Node{
+		Credentials: config.Credentials{User: "user", Pass: "pass", CookieFile: cookiePath},
+	})
+	user, pass, err := node.getCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "__cookie__" || pass != "abc:def" {
+		t.Fatalf("unexpected credentials %s:%s", user, pass)
+	}
+	if err := ioutil.WriteFile(cookiePath, []byte("__cookie__:restarted"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, pass, err = node.getCredentials(); err != nil {
+		t.Fatal(err)
+	} else if pass != "restarted" {
+		t.Fatalf("cookie not re-read, got %s", pass)
+	}
+	if err := ioutil.WriteFile(cookiePath, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = node.getCredentials(); err == nil {
+		t.Fatal("expected malformed cookie error")
+	}
+}
+
+func TestNode_EnvCredentials(t *testing.T) {
+	if err := os.Setenv("GOASICMINER_TEST_RPC_PASS", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("GOASICMINER_TEST_RPC_PASS")
+	node := NewNode(&config.Node{
+		Credentials: config.Credentials{User: "user", Pass: "pass", PassEnv: "GOASICMINER_TEST_RPC_PASS"},
+	})
+	user, pass, err := node.getCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "user" || pass != "secret" {
+		t.Fatalf("unexpected credentials %s:%s", user, pass)
+	}
+	node = NewNode(&config.Node{
+		Credentials: config.Credentials{User: "user", UserEnv: "GOASICMINER_TEST_RPC_MISSING"},
+	})
+	if _, _, err = node.getCredentials(); err == nil {
+		t.Fatal("expected missing environment variable error")
+	}
+}
+
+func TestNode_RefreshClientInUse(t *testing.T) {
+	// nothing listens on the node port, so requests fail fast with a connection error on an open client
+	node := NewNode(&config.Node{URL: "127.0.0.1:1", Credentials: config.Credentials{User: "user", Pass: "pass"}})
+	client, err := node.getClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.client, node.status = client, Connected
+	held := node.acquireClient()
+	if err := node.refreshClient(); err != nil {
+		t.Fatal(err)
+	}
+	if next := node.acquireClient(); next == held {
+		t.Fatal("client not swapped")
+	} else {
+		node.releaseClient(next)
+	}
+	if _, err := held.GetBlockCount(); err == rpcclient.ErrClientShutdown {
+		t.Fatal("client shut down while in use")
+	}
+	node.releaseClient(held)
+	if _, err := held.GetBlockCount(); err != rpcclient.ErrClientShutdown {
+		t.Fatalf("swapped client left open, got %v", err)
+	}
+}
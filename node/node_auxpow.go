@@ -0,0 +1,138 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	rpcclient "github.com/stevenroose/go-bitcoin-core-rpc"
+	"time"
+)
+
+const DefaultAuxInterval = 5 * time.Second
+
+func (n *Node) getAuxClient() (*rpcclient.Client, error) {
+	user, pass, err := resolveCredentials(&n.config.AuxPoW.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	return rpcclient.New(&rpcclient.ConnConfig{
+		Host: n.config.AuxPoW.URL,
+		User: user,
+		Pass: pass,
+	})
+}
+
+// auxRequest sends a request to the aux node. When the node rejects the credentials the client is rebuilt from
+// freshly read ones and the request is tried once more.
+func (n *Node) auxRequest(method string, params []json.RawMessage) (json.RawMessage, error) {
+	n.auxMtx.Lock()
+	client := n.auxClient
+	n.auxMtx.Unlock()
+	if client == nil {
+		return nil, ErrNoAuxBlock
+	}
+	result, err := client.RawRequest(method, params)
+	if !isAuthError(err) {
+		return result, err
+	}
+	refreshed, refreshErr := n.getAuxClient()
+	if refreshErr != nil {
+		return nil, refreshErr
+	}
+	n.auxMtx.Lock()
+	if n.auxClient != nil {
+		n.auxClient.Shutdown()
+	}
+	n.auxClient = refreshed
+	n.auxMtx.Unlock()
+	return refreshed.RawRequest(method, params)
+}
+
+func (n *Node) currentAuxBlock() *AuxBlock {
+	n.auxMtx.Lock()
+	defer n.auxMtx.Unlock()
+	return n.auxBlock
+}
+
+// auxLoop keeps an aux block to commit to. The aux node keeps every block it created until its tip moves, so work
+// is only regenerated for a new aux tip rather than for every refreshed aux block.
+func (n *Node) auxLoop() {
+	var interval = n.config.AuxPoW.Interval
+	if interval <= 0 {
+		interval = DefaultAuxInterval
+	}
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if updated, err := n.UpdateAuxBlock(); err != nil {
+			n.log.WithError(err).Error("UpdateAuxBlock")
+		} else if updated {
+			n.GenerateWorkAsync(0)
+		}
+		select {
+		case <-n.pollingExit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// UpdateAuxBlock fetches an aux block and makes it current when the aux chain tip has moved, reporting whether new
+// work should be generated.
+func (n *Node) UpdateAuxBlock() (bool, error) {
+	var params []json.RawMessage
+	var method = "getauxblock"
+	if n.config.AuxPoW.Wallet != "" {
+		wallet, _ := json.Marshal(n.config.AuxPoW.Wallet)
+		params = []json.RawMessage{wallet}
+		method = "createauxblock"
+	}
+	result, err := n.auxRequest(method, params)
+	if err != nil {
+		return false, err
+	}
+	auxBlock, auxBlockErr := ParseAuxBlock(result)
+	if auxBlockErr != nil {
+		return false, auxBlockErr
+	}
+	n.auxMtx.Lock()
+	if n.auxBlock != nil && n.auxBlock.PreviousHash == auxBlock.PreviousHash {
+		n.auxMtx.Unlock()
+		return false, nil
+	}
+	n.auxBlock = auxBlock
+	n.auxMtx.Unlock()
+	n.log.WithFields(log.Fields{
+		"height":       auxBlock.Height,
+		"chainId":      auxBlock.ChainID,
+		"hash":         auxBlock.Hash,
+		"previousHash": auxBlock.PreviousHash,
+	}).Println("Aux block")
+	return true, nil
+}
+
+func (n *Node) SubmitAuxBlock(auxBlock *AuxBlock, auxPow *AuxPow) error {
+	proof, proofErr := auxPow.Hex()
+	if proofErr != nil {
+		return proofErr
+	}
+	var method = "getauxblock"
+	if n.config.AuxPoW.Wallet != "" {
+		method = "submitauxblock"
+	}
+	hash, _ := json.Marshal(auxBlock.Hash.String())
+	data, _ := json.Marshal(proof)
+	n.log.WithField("height", auxBlock.Height).Println("Submitting aux block")
+	result, err := n.auxRequest(method, []json.RawMessage{hash, data})
+	if err != nil {
+		return err
+	}
+	var accepted bool
+	if err := json.Unmarshal(result, &accepted); err != nil {
+		return err
+	}
+	if !accepted {
+		return fmt.Errorf("%w: %s", ErrAuxBlockRejected, auxBlock.Hash)
+	}
+	return nil
+}
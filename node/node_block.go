@@ -7,40 +7,61 @@ import (
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
-	"github.com/fernandosanchezjr/goasicminer/utils"
+	rpcclient "github.com/stevenroose/go-bitcoin-core-rpc"
 	"github.com/stevenroose/go-bitcoin-core-rpc/btcjson"
 	"time"
 )
 
+// currentTemplate returns the template and selection that belong together, as a refresh may swap both at any time.
+func (n *Node) currentTemplate() (*btcjson.GetBlockTemplateResult, *TemplateSelection) {
+	n.templateMtx.Lock()
+	defer n.templateMtx.Unlock()
+	return n.blockTemplate, n.selection
+}
+
 func (n *Node) GetBlock(removedTransactions int) (*btcutil.Block, error) {
-	if n.blockTemplate == nil {
+	template, selection := n.currentTemplate()
+	return n.buildBlock(template, selection, n.currentAuxBlock(), removedTransactions)
+}
+
+func (n *Node) buildBlock(
+	template *btcjson.GetBlockTemplateResult,
+	selection *TemplateSelection,
+	auxBlock *AuxBlock,
+	removedTransactions int,
+) (*btcutil.Block, error) {
+	if template == nil || selection == nil {
 		return nil, errors.New("no Block template available")
 	}
-	template := n.blockTemplate
+	transactions, branch, coinbaseValue := selection.Truncate(removedTransactions)
 	//coinbase, coinbaseErr := n.GenerateCoinbase(
 	//	int32(template.Height),
 	//	math.MaxInt64,
 	//	template.CoinbaseValue,
 	//)
+	extraNonce, extraNonceErr := n.extraNonces.Next()
+	if extraNonceErr != nil {
+		return nil, extraNonceErr
+	}
+	var witnessCommitment []byte
+	if n.getProfile().Segwit {
+		witnessCommitment = selection.WitnessCommitment(len(transactions))
+	}
+	var auxCommitment []byte
+	if auxBlock != nil {
+		auxCommitment = MergedMiningCommitment(auxBlock.Hash)
+	}
 	coinbase, coinbaseErr := n.GenerateCoinbase(
 		int32(template.Height),
-		utils.MaskedRandomInt64(),
-		template.CoinbaseValue,
+		extraNonce,
+		coinbaseValue,
+		witnessCommitment,
+		auxCommitment,
 	)
 	if coinbaseErr != nil {
 		return nil, coinbaseErr
 	}
-	var rawTransactions = append([]btcjson.GetBlockTemplateResultTx{}, template.Transactions...)
-	removedTransactions = utils.Min(removedTransactions, len(rawTransactions)-1)
-	if removedTransactions > 0 {
-		rawTransactions = rawTransactions[:len(rawTransactions)-removedTransactions]
-	}
-	merkleRoot, transactions, merkleErr := GetMerkleTree(coinbase, rawTransactions)
-
-	//merkleRoot, transactions, merkleErr := GetMerkleTree(coinbase, []btcjson.GetBlockTemplateResultTx{})
-	if merkleErr != nil {
-		return nil, merkleErr
-	}
+	merkleRoot := MerkleRootFromBranch(*coinbase.Hash(), branch)
 	previousHash, previousHashErr := chainhash.NewHashFromStr(template.PreviousHash)
 	if previousHashErr != nil {
 		return nil, previousHashErr
@@ -59,6 +80,9 @@ func (n *Node) GetBlock(removedTransactions int) (*btcutil.Block, error) {
 		Timestamp:  time.Unix(int64(template.CurTime), 0),
 		Bits:       nBits,
 	}
+	if err := msgBlock.AddTransaction(coinbase.MsgTx()); err != nil {
+		return nil, err
+	}
 	for _, tx := range transactions {
 		if err := msgBlock.AddTransaction(tx.MsgTx()); err != nil {
 			return nil, err
@@ -70,15 +94,18 @@ func (n *Node) GetBlock(removedTransactions int) (*btcutil.Block, error) {
 }
 
 func (n *Node) Submit(block *btcutil.Block) error {
-	n.mtx.Lock()
-	defer n.mtx.Unlock()
-	if n.status == Disconnected {
+	if !n.connected() {
 		return nil
 	}
-	client, err := n.getClient()
-	if err != nil {
-		return err
-	}
 	n.log.WithField("height", block.Height()).Println("Submitting Block")
-	return client.SubmitBlock(block, nil)
+	submitErr := n.withNewClient(func(client *rpcclient.Client) error {
+		return client.SubmitBlock(block, nil)
+	})
+	if n.foundBlocks != nil {
+		n.foundBlocks.Record(block, submitErr)
+	}
+	if submitErr == nil {
+		n.advancePayout()
+	}
+	return submitErr
 }
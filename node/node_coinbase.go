@@ -1,6 +1,7 @@
 package node
 
 import (
+	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
@@ -15,17 +16,33 @@ const (
 )
 
 func (n *Node) GenerateCoinbaseScript(nextBlockHeight int32, extraNonce int64) ([]byte, error) {
-	return txscript.NewScriptBuilder().AddInt64(int64(nextBlockHeight)).
-		AddInt64(extraNonce).AddData([]byte(CoinbaseFlags)).
-		Script()
+	return coinbaseScript(nextBlockHeight, extraNonce, nil, 0)
 }
 
-func (n *Node) GenerateCoinbase(nextBlockHeight int32, extraNonce int64, coinbaseValue int64) (*btcutil.Tx, error) {
-	script, scriptErr := n.GenerateCoinbaseScript(nextBlockHeight, extraNonce)
+func coinbaseScript(nextBlockHeight int32, extraNonce int64, auxCommitment []byte, padding int) ([]byte, error) {
+	var flags = append([]byte(CoinbaseFlags), make([]byte, padding)...)
+	var builder = txscript.NewScriptBuilder().AddInt64(int64(nextBlockHeight)).AddInt64(extraNonce)
+	if auxCommitment != nil {
+		builder.AddData(auxCommitment)
+	}
+	return builder.AddData(flags).Script()
+}
+
+// GenerateCoinbase builds the coinbase paying the wallet address. A witness commitment adds the commitment output
+// and the reserved witness value it is computed over, a merged mining commitment goes in the coinbase script, and
+// profiles with a minimum transaction size get a padded coinbase script.
+func (n *Node) GenerateCoinbase(
+	nextBlockHeight int32,
+	extraNonce int64,
+	coinbaseValue int64,
+	witnessCommitment []byte,
+	auxCommitment []byte,
+) (*btcutil.Tx, error) {
+	script, scriptErr := coinbaseScript(nextBlockHeight, extraNonce, auxCommitment, 0)
 	if scriptErr != nil {
 		return nil, scriptErr
 	}
-	pkScript, pkScriptErr := txscript.PayToAddrScript(n.walletAddress)
+	pkScript, pkScriptErr := txscript.PayToAddrScript(n.payoutAddress())
 	if pkScriptErr != nil {
 		return nil, pkScriptErr
 	}
@@ -42,5 +59,18 @@ func (n *Node) GenerateCoinbase(nextBlockHeight int32, extraNonce int64, coinbas
 		Value:    coinbaseValue,
 		PkScript: pkScript,
 	})
+	if witnessCommitment != nil {
+		tx.TxIn[0].Witness = wire.TxWitness{make([]byte, blockchain.CoinbaseWitnessDataLen)}
+		tx.AddTxOut(&wire.TxOut{
+			Value:    0,
+			PkScript: witnessCommitment,
+		})
+	}
+	if deficit := n.getProfile().MinCoinbaseSize - tx.SerializeSizeStripped(); deficit > 0 {
+		tx.TxIn[0].SignatureScript, scriptErr = coinbaseScript(nextBlockHeight, extraNonce, auxCommitment, deficit)
+		if scriptErr != nil {
+			return nil, scriptErr
+		}
+	}
 	return btcutil.NewTx(tx), nil
 }
@@ -0,0 +1,329 @@
+package node
+
+import (
+	"bytes"
+	"errors"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"github.com/fernandosanchezjr/goasicminer/node/nodetest"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func testServerNode(t *testing.T) (*nodetest.Server, *Node, func()) {
+	folder, err := ioutil.TempDir("", "goasicminer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := nodetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.LongPollTimeout = 100 * time.Millisecond
+	node := NewNode(server.Config())
+	if node.foundBlocks, err = LoadFoundBlocks(path.Join(folder, FoundBlocksJournal)); err != nil {
+		t.Fatal(err)
+	}
+	return server, node, func() {
+		node.Disconnect()
+		server.Close()
+		_ = os.RemoveAll(folder)
+	}
+}
+
+func testWorkAt(t *testing.T, node *Node, height int32) *Work {
+	var timeout = time.After(5 * time.Second)
+	for {
+		select {
+		case work := <-node.GetWorkChan():
+			if work.Height == height {
+				return work
+			}
+		case <-timeout:
+			t.Fatalf("no work for height %d", height)
+		}
+	}
+}
+
+func testSolveWork(t *testing.T, work *Work) {
+	var header = work.Block.MsgBlock().Header
+	header.Version = int32(work.Version)
+	header.Timestamp = time.Unix(int64(work.Ntime), 0)
+	if !nodetest.SolveHeader(&header) {
+		t.Fatal("could not solve header")
+	}
+	work.SetNonce(utils.Nonce32(header.Nonce))
+}
+
+func TestNode_EndToEnd(t *testing.T) {
+	server, node, cleanup := testServerNode(t)
+	defer cleanup()
+	var tx = wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{1}, 0)})
+	tx.AddTxOut(&wire.TxOut{Value: 1000, PkScript: []byte{0x51}})
+	server.AddTransaction(tx, 5000)
+	if err := node.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	work := testWorkAt(t, node, 1)
+	if work.TotalTransactions != 1 || work.Transactions != 2 {
+		t.Fatalf("unexpected transactions %d/%d", work.Transactions, work.TotalTransactions)
+	}
+	testSolveWork(t, work)
+	if err := work.Submit(); err != nil {
+		t.Fatal(err)
+	}
+	if submissions := server.Submissions(); server.Height() != 1 || len(submissions) != 1 ||
+		!submissions[0].Accepted() {
+		t.Fatal("block not accepted")
+	}
+	// the longpoll wakes on the new tip and the next work builds on it without the confirmed transaction
+	next := testWorkAt(t, node, 2)
+	if next.TotalTransactions != 0 || next.Block.MsgBlock().Header.PrevBlock != server.TipHash() {
+		t.Fatal("next work not built on the new tip")
+	}
+	if err := node.CheckFoundBlocks(); err != nil {
+		t.Fatal(err)
+	}
+	if found := node.FoundBlocks().All(); len(found) != 1 || found[0].State != BlockAccepted ||
+		found[0].CoinbaseValue != 5000000000+5000 {
+		t.Fatalf("unexpected found blocks %+v", found)
+	}
+}
+
+func TestNode_EndToEndRejected(t *testing.T) {
+	server, node, cleanup := testServerNode(t)
+	defer cleanup()
+	if err := node.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	work := testWorkAt(t, node, 1)
+	testSolveWork(t, work)
+	server.MineBlock()
+	// the tip moved while the block was being solved
+	if err := work.Submit(); err == nil || err.Error() != "inconclusive" {
+		t.Fatalf("expected inconclusive, got %v", err)
+	}
+	next := testWorkAt(t, node, 2)
+	var header = next.Block.MsgBlock().Header
+	var target = blockchain.CompactToBig(header.Bits)
+	for nonce := utils.Nonce32(0); ; nonce++ {
+		header.Nonce = uint32(nonce)
+		var hash = header.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) > 0 {
+			next.SetNonce(nonce)
+			break
+		}
+	}
+	if err := next.Submit(); err == nil || err.Error() != "high-hash" {
+		t.Fatalf("expected high-hash, got %v", err)
+	}
+	if found := node.FoundBlocks().All(); len(found) != 2 || found[1].State != BlockRejected {
+		t.Fatalf("unexpected found blocks %+v", found)
+	}
+	if server.Height() != 1 {
+		t.Fatalf("unexpected height %d", server.Height())
+	}
+}
+
+func TestNode_EndToEndRefresh(t *testing.T) {
+	server, node, cleanup := testServerNode(t)
+	defer cleanup()
+	node.config.Refresh.MinFeeDelta = 10000
+	node.config.Refresh.Interval = 50 * time.Millisecond
+	if err := node.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	testWorkAt(t, node, 1)
+	for i, fee := range []int64{5000, 6000} {
+		var tx = wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(&wire.TxIn{PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{byte(i + 1)}, 0)})
+		tx.AddTxOut(&wire.TxOut{Value: 1000, PkScript: []byte{0x51}})
+		server.AddTransaction(tx, fee)
+		if i == 0 {
+			select {
+			case <-node.GetWorkChan():
+				t.Fatal("work pushed for a fee rise below the threshold")
+			case <-time.After(300 * time.Millisecond):
+			}
+		}
+	}
+	if work := testWorkAt(t, node, 1); work.TotalTransactions != 2 {
+		t.Fatalf("expected 2 transactions, got %d", work.TotalTransactions)
+	}
+}
+
+func TestNode_EndToEndRefreshCookieMissing(t *testing.T) {
+	server, node, cleanup := testServerNode(t)
+	defer cleanup()
+	var cookiePath = path.Join(path.Dir(node.foundBlocks.journalPath), ".cookie")
+	if err := ioutil.WriteFile(cookiePath, []byte(nodetest.DefaultUser+":"+nodetest.DefaultPass), 0600); err != nil {
+		t.Fatal(err)
+	}
+	node.config.CookieFile = cookiePath
+	node.config.Refresh.MinFeeDelta = 1000
+	node.config.Refresh.Interval = 50 * time.Millisecond
+	if err := node.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	testWorkAt(t, node, 1)
+	// the node restarts, rejecting the old cookie before writing its new one
+	server.SetCredentials("__cookie__", "restarted")
+	if err := os.Remove(cookiePath); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if err := ioutil.WriteFile(cookiePath, []byte("__cookie__:restarted"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var tx = wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{1}, 0)})
+	tx.AddTxOut(&wire.TxOut{Value: 1000, PkScript: []byte{0x51}})
+	server.AddTransaction(tx, 5000)
+	if work := testWorkAt(t, node, 1); work.TotalTransactions != 1 {
+		t.Fatalf("expected 1 transaction, got %d", work.TotalTransactions)
+	}
+}
+
+func TestNode_EndToEndCredentialRefresh(t *testing.T) {
+	server, node, cleanup := testServerNode(t)
+	defer cleanup()
+	var cookiePath = path.Join(path.Dir(node.foundBlocks.journalPath), ".cookie")
+	if err := ioutil.WriteFile(cookiePath, []byte(nodetest.DefaultUser+":"+nodetest.DefaultPass), 0600); err != nil {
+		t.Fatal(err)
+	}
+	node.config.CookieFile = cookiePath
+	node.config.ClientOnly = true
+	if err := node.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	// the node restarted with a new cookie
+	server.SetCredentials("__cookie__", "restarted")
+	if err := ioutil.WriteFile(cookiePath, []byte("__cookie__:restarted"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := node.GetInfo(); err != nil || info == nil {
+		t.Fatalf("GetInfo after credential change: %v", err)
+	}
+	server.SetCredentials("__cookie__", "again")
+	if err := ioutil.WriteFile(cookiePath, []byte("__cookie__:again"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if header, err := node.GetBlockHeader(0); err != nil || header == nil {
+		t.Fatalf("GetBlockHeader after credential change: %v", err)
+	}
+}
+
+func testAuxWorkAt(t *testing.T, node *Node, height int32, auxHeight int64) *Work {
+	var timeout = time.After(5 * time.Second)
+	for {
+		select {
+		case work := <-node.GetWorkChan():
+			if work.Height == height && work.AuxBlock != nil && work.AuxBlock.Height == auxHeight {
+				return work
+			}
+		case <-timeout:
+			t.Fatalf("no work for height %d and aux height %d", height, auxHeight)
+		}
+	}
+}
+
+func TestNode_EndToEndAuxPow(t *testing.T) {
+	server, node, cleanup := testServerNode(t)
+	defer cleanup()
+	auxServer, err := nodetest.NewAuxServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auxServer.Close()
+	node.config.AuxPoW = auxServer.Config("aux-payout")
+	node.config.AuxPoW.Interval = 50 * time.Millisecond
+	// the aux node resolves its credentials like the parent node
+	var cookiePath = path.Join(path.Dir(node.foundBlocks.journalPath), ".aux-cookie")
+	if err := ioutil.WriteFile(cookiePath, []byte(nodetest.DefaultUser+":"+nodetest.DefaultPass), 0600); err != nil {
+		t.Fatal(err)
+	}
+	node.config.AuxPoW.Credentials = config.Credentials{CookieFile: cookiePath}
+	var tx = wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{1}, 0)})
+	tx.AddTxOut(&wire.TxOut{Value: 1000, PkScript: []byte{0x51}})
+	server.AddTransaction(tx, 5000)
+	if err := node.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	work := testAuxWorkAt(t, node, 1, 1)
+	var commitment = MergedMiningCommitment(work.AuxBlock.Hash)
+	if !bytes.Contains(work.Block.Transactions()[0].MsgTx().TxIn[0].SignatureScript, commitment) {
+		t.Fatal("coinbase does not commit to the aux block")
+	}
+	testSolveWork(t, work)
+	if err := work.SubmitAux(); err != nil {
+		t.Fatal(err)
+	}
+	// the same header also solves the parent block, which must be unaffected by the commitment
+	if err := work.Submit(); err != nil {
+		t.Fatal(err)
+	}
+	if auxServer.Height() != 1 || auxServer.TipHash() != work.AuxBlock.Hash || server.Height() != 1 {
+		t.Fatalf("unexpected heights %d/%d", server.Height(), auxServer.Height())
+	}
+	// an aux block on a moved aux tip is picked up without waiting for the parent chain
+	auxServer.MineBlock()
+	next := testAuxWorkAt(t, node, 2, 3)
+	var header = next.header()
+	var target = next.AuxBlock.Target
+	for nonce := utils.Nonce32(0); ; nonce++ {
+		header.Nonce = uint32(nonce)
+		var hash = header.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) > 0 {
+			next.SetNonce(nonce)
+			break
+		}
+	}
+	if err := next.SubmitAux(); !errors.Is(err, ErrAuxBlockRejected) {
+		t.Fatalf("expected aux block rejection, got %v", err)
+	}
+	if submissions := auxServer.Submissions(); len(submissions) != 2 || !submissions[0].Accepted() ||
+		submissions[1].Result != "high-hash" {
+		t.Fatalf("unexpected aux submissions %+v", submissions)
+	}
+}
+
+func TestNode_EndToEndPayoutRotation(t *testing.T) {
+	server, node, cleanup := testServerNode(t)
+	defer cleanup()
+	_, tpub := testAccountKey(t, server.Params())
+	node.config.Wallet = ""
+	node.config.WalletDescriptor = "pkh(" + tpub + "/0/*)"
+	node.payoutIndexPath = path.Join(path.Dir(node.foundBlocks.journalPath), PayoutIndexFile)
+	if err := node.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	work := testWorkAt(t, node, 1)
+	testSolveWork(t, work)
+	if err := work.Submit(); err != nil {
+		t.Fatal(err)
+	}
+	var paid = work.Block.Transactions()[0].MsgTx().TxOut[0].PkScript
+	var timeout = time.After(5 * time.Second)
+	for {
+		select {
+		case next := <-node.GetWorkChan():
+			var nextPaid = next.Block.Transactions()[0].MsgTx().TxOut[0].PkScript
+			if next.Height == 2 && !bytes.Equal(paid, nextPaid) {
+				if node.payout.Index() != 1 {
+					t.Fatalf("unexpected payout index %d", node.payout.Index())
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("payout address not rotated after a found block")
+		}
+	}
+}
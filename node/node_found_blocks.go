@@ -0,0 +1,65 @@
+package node
+
+import (
+	rpcclient "github.com/stevenroose/go-bitcoin-core-rpc"
+	"time"
+)
+
+const FoundBlocksCheckInterval = time.Minute
+
+func (n *Node) foundBlocksLoop() {
+	var ticker = time.NewTicker(FoundBlocksCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.pollingExit:
+			return
+		case <-ticker.C:
+			if err := n.CheckFoundBlocks(); err != nil {
+				n.log.WithError(err).Error("CheckFoundBlocks")
+			}
+		}
+	}
+}
+
+// CheckFoundBlocks follows the active chain for every pending found block. A block whose height now holds a
+// different hash is orphaned, otherwise it is accepted until it reaches coinbase maturity.
+func (n *Node) CheckFoundBlocks() error {
+	if n.foundBlocks == nil {
+		return nil
+	}
+	var pending = n.foundBlocks.Pending()
+	if len(pending) == 0 {
+		return nil
+	}
+	return n.withClient(func(client *rpcclient.Client) error {
+		tip, tipErr := client.GetBlockCount()
+		if tipErr != nil {
+			return tipErr
+		}
+		for _, block := range pending {
+			if int64(block.Height) > tip {
+				continue
+			}
+			hash, hashErr := client.GetBlockHash(int64(block.Height))
+			if hashErr != nil {
+				return hashErr
+			}
+			if hash.String() != block.Hash {
+				n.foundBlocks.SetState(block.Hash, BlockOrphaned, 0)
+				continue
+			}
+			var confirmations = tip - int64(block.Height) + 1
+			if confirmations >= FoundBlockMaturity {
+				n.foundBlocks.SetState(block.Hash, BlockMatured, confirmations)
+			} else {
+				n.foundBlocks.SetState(block.Hash, BlockAccepted, confirmations)
+			}
+		}
+		return nil
+	})
+}
+
+func (n *Node) FoundBlocks() *FoundBlocks {
+	return n.foundBlocks
+}
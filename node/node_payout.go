@@ -0,0 +1,52 @@
+package node
+
+import (
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	log "github.com/sirupsen/logrus"
+)
+
+// setupPayout resolves the coinbase payout, rotating through WalletDescriptor when one is configured and paying the
+// static Wallet address otherwise.
+func (n *Node) setupPayout(params *chaincfg.Params) (btcutil.Address, error) {
+	if n.config.WalletDescriptor == "" {
+		return n.profile.DecodeAddress(n.config.Wallet, params)
+	}
+	if n.payoutIndexPath == "" {
+		n.payoutIndexPath = n.dataPath(GetPayoutIndexPath())
+	}
+	payout, err := NewPayoutWallet(n.config.WalletDescriptor, params, n.profile.Segwit, n.payoutIndexPath)
+	if err != nil {
+		return nil, err
+	}
+	n.payout = payout
+	n.log.WithFields(log.Fields{
+		"index":   payout.Index(),
+		"address": payout.Address(),
+	}).Println("Payout descriptor")
+	return payout.Address(), nil
+}
+
+func (n *Node) payoutAddress() btcutil.Address {
+	if n.payout != nil {
+		return n.payout.Address()
+	}
+	return n.walletAddress
+}
+
+// advancePayout moves to the next descriptor address after a found block. Work on the new tip may already have
+// been built for the old address by then, so it is generated again.
+func (n *Node) advancePayout() {
+	if n.payout == nil {
+		return
+	}
+	if address, err := n.payout.Advance(); err != nil {
+		n.log.WithError(err).Error("Advancing payout address")
+	} else {
+		n.log.WithFields(log.Fields{
+			"index":   n.payout.Index(),
+			"address": address,
+		}).Println("Payout address")
+		n.GenerateWorkAsync(0)
+	}
+}
@@ -8,16 +8,27 @@ func (n *Node) pollingLoop() {
 		case <-n.pollingExit:
 			return
 		default:
-			if n.status != Connected {
+			if !n.connected() {
 				time.Sleep(100 * time.Millisecond)
 				continue
 			}
-			_, templateErr := n.GetBlockTemplate()
+			response, templateErr := n.GetBlockTemplate()
+			var fetched = time.Now()
 			if templateErr != nil {
 				n.log.WithError(templateErr).Error("GetBlockTemplate")
+				if isAuthError(templateErr) {
+					time.Sleep(time.Second)
+				}
 				continue
 			}
-			n.GenerateWorkAsync(0)
+			if response == nil {
+				continue
+			}
+			if updated, updateErr := n.UpdateTemplate(response, fetched); updateErr != nil {
+				n.log.WithError(updateErr).Error("UpdateTemplate")
+			} else if updated {
+				n.GenerateWorkAsync(0)
+			}
 		}
 	}
 }
@@ -33,7 +44,7 @@ func (n *Node) generateLoop() {
 		case <-n.generateExit:
 			return
 		case count = <-n.generateChan:
-			if n.blockTemplate == nil {
+			if template, _ := n.currentTemplate(); template == nil {
 				continue
 			}
 			var work = n.GenerateWork(count)
@@ -45,11 +56,13 @@ func (n *Node) generateLoop() {
 }
 
 func (n *Node) GenerateWork(removedTransactions int) *Work {
-	block, blockErr := n.GetBlock(removedTransactions)
+	template, selection := n.currentTemplate()
+	auxBlock := n.currentAuxBlock()
+	block, blockErr := n.buildBlock(template, selection, auxBlock, removedTransactions)
 	if blockErr != nil {
 		n.log.WithError(blockErr).Error("GetBlock")
 	} else {
-		work := NewWork(n, block)
+		work := newWork(n, block, template, selection, auxBlock)
 		work.PlainHeader()
 		return work
 	}
@@ -0,0 +1,55 @@
+package node
+
+import (
+	"github.com/stevenroose/go-bitcoin-core-rpc/btcjson"
+	"time"
+)
+
+// refreshLoop fetches a fresh template every refresh interval on a client of its own, since requests on the polling
+// client queue behind the pending longpoll. A client that cannot be built is retried on the next tick.
+func (n *Node) refreshLoop() {
+	var ticker = time.NewTicker(n.refresh.Interval)
+	defer ticker.Stop()
+	client, err := n.getClient()
+	if err != nil {
+		n.log.WithError(err).Error("Template refresh client")
+	}
+	defer func() {
+		if client != nil {
+			client.Shutdown()
+		}
+	}()
+	for {
+		select {
+		case <-n.pollingExit:
+			return
+		case <-ticker.C:
+			if client == nil {
+				if client, err = n.getClient(); err != nil {
+					n.log.WithError(err).Error("Template refresh client")
+					continue
+				}
+			}
+			// the node answers at once, so stamping the template with the request time keeps a refresh that
+			// finishes after a newer longpoll answer from replacing it
+			var fetched = time.Now()
+			response, templateErr := client.GetBlockTemplate(&btcjson.TemplateRequest{
+				Capabilities: []string{"longpoll"},
+				Rules:        n.profile.Rules,
+			})
+			if templateErr != nil {
+				n.log.WithError(templateErr).Error("Template refresh")
+				if isAuthError(templateErr) {
+					client.Shutdown()
+					client = nil
+				}
+				continue
+			}
+			if updated, updateErr := n.UpdateTemplate(response, fetched); updateErr != nil {
+				n.log.WithError(updateErr).Error("UpdateTemplate")
+			} else if updated {
+				n.GenerateWorkAsync(0)
+			}
+		}
+	}
+}
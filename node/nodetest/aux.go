@@ -0,0 +1,368 @@
+package nodetest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+)
+
+const (
+	// NamecoinChainID is the chain ID Namecoin puts in its aux blocks and block versions.
+	NamecoinChainID = 1
+	// AuxWallet is the address the aux node pays when blocks are requested with getauxblock.
+	AuxWallet = "nodetest-aux-wallet"
+	// maxChainBranch is the deepest chain merkle tree Namecoin accepts.
+	maxChainBranch = 30
+)
+
+var mergedMiningMagic = []byte{0xfa, 0xbe, 0x6d, 0x6d}
+
+type AuxSubmission struct {
+	Hash   chainhash.Hash
+	Result string
+}
+
+// Accepted reports whether the aux block was proven and became the aux chain tip.
+func (s *AuxSubmission) Accepted() bool {
+	return s.Result == ""
+}
+
+type auxBlock struct {
+	hash    chainhash.Hash
+	prev    chainhash.Hash
+	height  int32
+	address string
+}
+
+// AuxServer stands in for a merged mined node such as namecoind, serving createauxblock, submitauxblock and
+// getauxblock. Aux blocks are opaque hashes chained on a synthetic genesis, and submissions are checked the way
+// Namecoin checks an AuxPoW: the parent coinbase must commit to the block and the parent header must meet its
+// target.
+type AuxServer struct {
+	ChainID     int32
+	Bits        uint32
+	listener    net.Listener
+	httpServer  *http.Server
+	mtx         sync.Mutex
+	user        string
+	pass        string
+	hashes      []chainhash.Hash
+	created     map[chainhash.Hash]*auxBlock
+	submissions []*AuxSubmission
+}
+
+func NewAuxServer() (*AuxServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	var s = &AuxServer{
+		ChainID:  NamecoinChainID,
+		Bits:     chaincfg.RegressionNetParams.PowLimitBits,
+		listener: listener,
+		user:     DefaultUser,
+		pass:     DefaultPass,
+		hashes:   []chainhash.Hash{chainhash.DoubleHashH([]byte("nodetest aux genesis"))},
+		created:  map[chainhash.Hash]*auxBlock{},
+	}
+	s.httpServer = &http.Server{Handler: s}
+	go func() {
+		_ = s.httpServer.Serve(listener)
+	}()
+	return s, nil
+}
+
+func (s *AuxServer) Close() {
+	_ = s.httpServer.Close()
+}
+
+func (s *AuxServer) Host() string {
+	return s.listener.Addr().String()
+}
+
+// Config points a node at this server, paying wallet through createauxblock or, when empty, using getauxblock.
+func (s *AuxServer) Config(wallet string) *config.AuxChain {
+	return &config.AuxChain{
+		URL:         s.Host(),
+		Credentials: config.Credentials{User: s.user, Pass: s.pass},
+		Wallet:      wallet,
+	}
+}
+
+func (s *AuxServer) Height() int32 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return int32(len(s.hashes) - 1)
+}
+
+func (s *AuxServer) TipHash() chainhash.Hash {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.hashes[len(s.hashes)-1]
+}
+
+func (s *AuxServer) Submissions() []AuxSubmission {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var submissions = make([]AuxSubmission, len(s.submissions))
+	for i, submission := range s.submissions {
+		submissions[i] = *submission
+	}
+	return submissions
+}
+
+// MineBlock extends the aux chain as if another miner found a block, invalidating every created aux block.
+func (s *AuxServer) MineBlock() chainhash.Hash {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var hash = chainhash.DoubleHashH(append(s.hashes[len(s.hashes)-1][:], []byte("nodetest aux block")...))
+	s.extend(hash)
+	return hash
+}
+
+// extend appends a block to the aux chain. Callers must hold the lock.
+func (s *AuxServer) extend(hash chainhash.Hash) {
+	s.hashes = append(s.hashes, hash)
+	s.created = map[chainhash.Hash]*auxBlock{}
+}
+
+func (s *AuxServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mtx.Lock()
+	user, pass := s.user, s.pass
+	s.mtx.Unlock()
+	serveRPC(w, r, user, pass, s.dispatch)
+}
+
+func (s *AuxServer) dispatch(request *rpcRequest) (interface{}, *rpcError) {
+	switch request.Method {
+	case "getblockcount":
+		return s.Height(), nil
+	case "createauxblock":
+		var address string
+		if rpcErr := request.param(0, &address); rpcErr != nil {
+			return nil, rpcErr
+		}
+		if address == "" {
+			return nil, newRPCError(rpcInvalidParams, "Invalid coinbase payout address")
+		}
+		return s.createAuxBlock(address), nil
+	case "submitauxblock":
+		return s.submitAuxBlock(request)
+	case "getauxblock":
+		if len(request.Params) == 0 {
+			return s.createAuxBlock(AuxWallet), nil
+		}
+		return s.submitAuxBlock(request)
+	default:
+		return nil, newRPCError(rpcMethodNotFound, "Method not found")
+	}
+}
+
+// createAuxBlock returns the block already created for the tip and address, as namecoind caches them.
+func (s *AuxServer) createAuxBlock(address string) map[string]interface{} {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var prev = s.hashes[len(s.hashes)-1]
+	var block *auxBlock
+	for _, created := range s.created {
+		if created.address == address {
+			block = created
+		}
+	}
+	if block == nil {
+		var height = int32(len(s.hashes))
+		var seed = append(append(prev[:0:0], prev[:]...), []byte(fmt.Sprintf("%d/%s", height, address))...)
+		block = &auxBlock{hash: chainhash.DoubleHashH(seed), prev: prev, height: height, address: address}
+		s.created[block.hash] = block
+	}
+	var target [chainhash.HashSize]byte
+	var targetBytes = blockchain.CompactToBig(s.Bits).Bytes()
+	for i := range targetBytes {
+		target[i] = targetBytes[len(targetBytes)-1-i]
+	}
+	return map[string]interface{}{
+		"hash":              block.hash.String(),
+		"chainid":           s.ChainID,
+		"previousblockhash": block.prev.String(),
+		"coinbasevalue":     blockchain.CalcBlockSubsidy(block.height, &chaincfg.RegressionNetParams),
+		"bits":              fmt.Sprintf("%08x", s.Bits),
+		"height":            block.height,
+		"_target":           hex.EncodeToString(target[:]),
+	}
+}
+
+func (s *AuxServer) submitAuxBlock(request *rpcRequest) (interface{}, *rpcError) {
+	var hashStr, proofHex string
+	if rpcErr := request.param(0, &hashStr); rpcErr != nil {
+		return nil, rpcErr
+	}
+	if rpcErr := request.param(1, &proofHex); rpcErr != nil {
+		return nil, rpcErr
+	}
+	hash, err := chainhash.NewHashFromStr(hashStr)
+	if err != nil {
+		return nil, newRPCError(rpcInvalidParams, "invalid block hash: %v", err)
+	}
+	data, err := hex.DecodeString(proofHex)
+	if err != nil {
+		return nil, newRPCError(rpcDeserialization, "AuxPow decode failed: %v", err)
+	}
+	proof, err := readAuxPow(bytes.NewReader(data))
+	if err != nil {
+		return nil, newRPCError(rpcDeserialization, "AuxPow decode failed: %v", err)
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	block, found := s.created[*hash]
+	if !found {
+		return nil, newRPCError(rpcInvalidParams, "block hash unknown")
+	}
+	var submission = &AuxSubmission{Hash: *hash, Result: s.checkAuxPow(block.hash, proof)}
+	s.submissions = append(s.submissions, submission)
+	if !submission.Accepted() {
+		return false, nil
+	}
+	s.extend(block.hash)
+	return true, nil
+}
+
+type auxPowProof struct {
+	coinbase       wire.MsgTx
+	coinbaseBranch []chainhash.Hash
+	coinbaseIndex  int32
+	chainBranch    []chainhash.Hash
+	chainIndex     int32
+	parent         wire.BlockHeader
+}
+
+func readMerkleBranch(r io.Reader) ([]chainhash.Hash, int32, error) {
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	if count > maxChainBranch*2 {
+		return nil, 0, fmt.Errorf("merkle branch of %d hashes", count)
+	}
+	var branch = make([]chainhash.Hash, count)
+	for i := range branch {
+		if _, err := io.ReadFull(r, branch[i][:]); err != nil {
+			return nil, 0, err
+		}
+	}
+	var index int32
+	if err := binary.Read(r, binary.LittleEndian, &index); err != nil {
+		return nil, 0, err
+	}
+	return branch, index, nil
+}
+
+func readAuxPow(r io.Reader) (*auxPowProof, error) {
+	var proof auxPowProof
+	var err error
+	if err = proof.coinbase.Deserialize(r); err != nil {
+		return nil, err
+	}
+	var parentHash chainhash.Hash
+	if _, err = io.ReadFull(r, parentHash[:]); err != nil {
+		return nil, err
+	}
+	if proof.coinbaseBranch, proof.coinbaseIndex, err = readMerkleBranch(r); err != nil {
+		return nil, err
+	}
+	if proof.chainBranch, proof.chainIndex, err = readMerkleBranch(r); err != nil {
+		return nil, err
+	}
+	if err = proof.parent.Deserialize(r); err != nil {
+		return nil, err
+	}
+	return &proof, nil
+}
+
+func merkleRootFromBranch(leaf chainhash.Hash, branch []chainhash.Hash, index int32) chainhash.Hash {
+	var root = &leaf
+	for i := range branch {
+		if index&1 != 0 {
+			root = blockchain.HashMerkleBranches(&branch[i], root)
+		} else {
+			root = blockchain.HashMerkleBranches(root, &branch[i])
+		}
+		index >>= 1
+	}
+	return *root
+}
+
+// expectedChainIndex is the slot a chain must occupy in the chain merkle tree for a given nonce.
+func expectedChainIndex(nonce uint32, chainID int32, height int) int32 {
+	var rand = nonce*1103515245 + 12345
+	rand += uint32(chainID)
+	rand = rand*1103515245 + 12345
+	return int32(rand % (1 << uint(height)))
+}
+
+// checkAuxPow returns why a proof does not prove an aux block, or an empty string if it does. Callers must hold
+// the lock.
+func (s *AuxServer) checkAuxPow(hash chainhash.Hash, proof *auxPowProof) string {
+	if proof.coinbaseIndex != 0 {
+		return "auxpow-not-generate"
+	}
+	if len(proof.chainBranch) > maxChainBranch {
+		return "auxpow-chain-branch-too-long"
+	}
+	if proof.parent.Version>>16 == s.ChainID {
+		return "auxpow-parent-chainid"
+	}
+	var coinbaseRoot = merkleRootFromBranch(proof.coinbase.TxHash(), proof.coinbaseBranch, 0)
+	if coinbaseRoot != proof.parent.MerkleRoot {
+		return "auxpow-merkle-root"
+	}
+	if len(proof.coinbase.TxIn) == 0 {
+		return "auxpow-no-coinbase-input"
+	}
+	var chainRoot = merkleRootFromBranch(hash, proof.chainBranch, proof.chainIndex)
+	var rootBytes = make([]byte, chainhash.HashSize)
+	for i := range rootBytes {
+		rootBytes[i] = chainRoot[chainhash.HashSize-1-i]
+	}
+	var script = proof.coinbase.TxIn[0].SignatureScript
+	var headerPos = bytes.Index(script, mergedMiningMagic)
+	var rootPos = bytes.Index(script, rootBytes)
+	if rootPos < 0 {
+		return "auxpow-missing-root"
+	}
+	if headerPos >= 0 {
+		if bytes.Index(script[headerPos+1:], mergedMiningMagic) >= 0 {
+			return "auxpow-multiple-headers"
+		}
+		if headerPos+len(mergedMiningMagic) != rootPos {
+			return "auxpow-header-not-before-root"
+		}
+	} else if rootPos > 20 {
+		return "auxpow-root-too-late"
+	}
+	var tail = script[rootPos+len(rootBytes):]
+	if len(tail) < 8 {
+		return "auxpow-missing-size-nonce"
+	}
+	if binary.LittleEndian.Uint32(tail[0:4]) != 1<<uint(len(proof.chainBranch)) {
+		return "auxpow-merkle-size"
+	}
+	var nonce = binary.LittleEndian.Uint32(tail[4:8])
+	if proof.chainIndex != expectedChainIndex(nonce, s.ChainID, len(proof.chainBranch)) {
+		return "auxpow-chain-index"
+	}
+	var parentHash = proof.parent.BlockHash()
+	if blockchain.HashToBig(&parentHash).Cmp(blockchain.CompactToBig(s.Bits)) > 0 {
+		return "high-hash"
+	}
+	return ""
+}
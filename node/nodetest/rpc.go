@@ -0,0 +1,354 @@
+package nodetest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/stevenroose/go-bitcoin-core-rpc/btcjson"
+	"io"
+	"math/big"
+	"time"
+)
+
+// bitcoind RPC error codes
+const (
+	rpcMiscError       = -1
+	rpcInvalidParams   = -8
+	rpcMethodNotFound  = -32601
+	rpcDeserialization = -22
+	rpcBlockNotFound   = -5
+)
+
+type rpcRequest struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	ID     json.RawMessage   `json:"id"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	Result interface{}     `json:"result"`
+	Error  *rpcError       `json:"error"`
+	ID     json.RawMessage `json:"id"`
+}
+
+func newRPCError(code int, format string, args ...interface{}) *rpcError {
+	return &rpcError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func (r *rpcRequest) param(index int, value interface{}) *rpcError {
+	if index >= len(r.Params) {
+		return newRPCError(rpcInvalidParams, "%s: missing parameter %d", r.Method, index)
+	}
+	if err := json.Unmarshal(r.Params[index], value); err != nil {
+		return newRPCError(rpcInvalidParams, "%s: invalid parameter %d: %v", r.Method, index, err)
+	}
+	return nil
+}
+
+func (s *Server) dispatch(request *rpcRequest) (interface{}, *rpcError) {
+	switch request.Method {
+	case "getblockchaininfo":
+		return s.getBlockChainInfo()
+	case "getblockcount":
+		return s.Height(), nil
+	case "getblockhash":
+		return s.getBlockHash(request)
+	case "getblockheader":
+		return s.getBlockHeader(request)
+	case "getblock":
+		return s.getBlock(request)
+	case "getblocktemplate":
+		return s.getBlockTemplate(request)
+	case "submitblock":
+		return s.submitBlock(request)
+	default:
+		return nil, newRPCError(rpcMethodNotFound, "Method not found")
+	}
+}
+
+func coinbaseScript(height int32) ([]byte, error) {
+	return txscript.NewScriptBuilder().AddInt64(int64(height)).AddData([]byte("nodetest")).Script()
+}
+
+func difficulty(bits uint32, powLimit *big.Int) float64 {
+	var ratio = new(big.Rat).SetFrac(powLimit, blockchain.CompactToBig(bits))
+	result, _ := ratio.Float64()
+	return result
+}
+
+func (s *Server) getBlockChainInfo() (interface{}, *rpcError) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var height = int32(len(s.blocks) - 1)
+	var tip = s.blocks[height]
+	return &btcjson.GetBlockChainInfoResult{
+		Chain:         "regtest",
+		Blocks:        height,
+		Headers:       height,
+		BestBlockHash: s.hashes[height].String(),
+		Difficulty:    difficulty(tip.Header.Bits, s.params.PowLimit),
+		MedianTime:    s.medianTime(height).Unix(),
+	}, nil
+}
+
+// medianTime is the median of the last 11 block timestamps. Callers must hold the lock.
+func (s *Server) medianTime(height int32) time.Time {
+	var timestamps []time.Time
+	for h := height; h >= 0 && len(timestamps) < 11; h-- {
+		timestamps = append(timestamps, s.blocks[h].Header.Timestamp)
+	}
+	for i := 1; i < len(timestamps); i++ {
+		for j := i; j > 0 && timestamps[j].Before(timestamps[j-1]); j-- {
+			timestamps[j], timestamps[j-1] = timestamps[j-1], timestamps[j]
+		}
+	}
+	return timestamps[len(timestamps)/2]
+}
+
+func (s *Server) getBlockHash(request *rpcRequest) (interface{}, *rpcError) {
+	var height int64
+	if err := request.param(0, &height); err != nil {
+		return nil, err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if height < 0 || height >= int64(len(s.hashes)) {
+		return nil, newRPCError(rpcInvalidParams, "Block height out of range")
+	}
+	return s.hashes[height].String(), nil
+}
+
+func (s *Server) getBlockHeader(request *rpcRequest) (interface{}, *rpcError) {
+	var hash string
+	var verbose = true
+	if err := request.param(0, &hash); err != nil {
+		return nil, err
+	}
+	if len(request.Params) > 1 {
+		if err := request.param(1, &verbose); err != nil {
+			return nil, err
+		}
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	msgBlock, height, found := s.findBlock(hash)
+	if !found {
+		return nil, newRPCError(rpcBlockNotFound, "Block not found")
+	}
+	if !verbose {
+		encoded, err := serializeHex(func(w *bytes.Buffer) error { return msgBlock.Header.Serialize(w) })
+		if err != nil {
+			return nil, newRPCError(rpcMiscError, err.Error())
+		}
+		return encoded, nil
+	}
+	var tipHeight = int32(len(s.blocks) - 1)
+	var result = &btcjson.GetBlockHeaderVerboseResult{
+		Hash:          hash,
+		Confirmations: uint64(tipHeight - height + 1),
+		Height:        height,
+		Version:       msgBlock.Header.Version,
+		VersionHex:    fmt.Sprintf("%08x", msgBlock.Header.Version),
+		MerkleRoot:    msgBlock.Header.MerkleRoot.String(),
+		Time:          msgBlock.Header.Timestamp.Unix(),
+		Nonce:         uint64(msgBlock.Header.Nonce),
+		Bits:          fmt.Sprintf("%08x", msgBlock.Header.Bits),
+		Difficulty:    difficulty(msgBlock.Header.Bits, s.params.PowLimit),
+	}
+	if height > 0 {
+		result.PreviousHash = msgBlock.Header.PrevBlock.String()
+	}
+	if height < tipHeight {
+		result.NextHash = s.hashes[height+1].String()
+	}
+	return result, nil
+}
+
+func (s *Server) getBlock(request *rpcRequest) (interface{}, *rpcError) {
+	var hash string
+	if err := request.param(0, &hash); err != nil {
+		return nil, err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	msgBlock, _, found := s.findBlock(hash)
+	if !found {
+		return nil, newRPCError(rpcBlockNotFound, "Block not found")
+	}
+	encoded, err := serializeHex(func(w *bytes.Buffer) error { return msgBlock.Serialize(w) })
+	if err != nil {
+		return nil, newRPCError(rpcMiscError, err.Error())
+	}
+	return encoded, nil
+}
+
+func (s *Server) longPollId() string {
+	return fmt.Sprintf("%s%d", s.hashes[len(s.hashes)-1], s.templateId)
+}
+
+// getBlockTemplate honours BIP 22 longpolling: a request carrying the current longpollid waits until the tip or the
+// mempool changes, or LongPollTimeout passes, before answering.
+func (s *Server) getBlockTemplate(request *rpcRequest) (interface{}, *rpcError) {
+	var templateRequest btcjson.TemplateRequest
+	if len(request.Params) > 0 {
+		if err := request.param(0, &templateRequest); err != nil {
+			return nil, err
+		}
+	}
+	s.mtx.Lock()
+	if templateRequest.LongPollID != "" && templateRequest.LongPollID == s.longPollId() {
+		var changed = s.changed
+		var timeout = s.LongPollTimeout
+		s.mtx.Unlock()
+		select {
+		case <-changed:
+		case <-time.After(timeout):
+		}
+		s.mtx.Lock()
+	}
+	defer s.mtx.Unlock()
+	return s.template(), nil
+}
+
+// template builds a block template on the current tip. Callers must hold the lock.
+func (s *Server) template() *btcjson.GetBlockTemplateResult {
+	var height = int32(len(s.blocks))
+	var tip = s.blocks[height-1]
+	var curTime = s.blockTime(height)
+	var minTime = s.medianTime(height - 1).Add(time.Second)
+	if curTime.Before(minTime) {
+		curTime = minTime
+	}
+	var result = &btcjson.GetBlockTemplateResult{
+		Bits:          fmt.Sprintf("%08x", s.params.PowLimitBits),
+		CurTime:       uint32(curTime.Unix()),
+		Height:        int64(height),
+		PreviousHash:  tip.BlockHash().String(),
+		SigOpLimit:    blockchain.MaxBlockSigOpsCost,
+		SizeLimit:     blockchain.MaxBlockBaseSize,
+		WeightLimit:   blockchain.MaxBlockWeight,
+		Transactions:  make([]btcjson.GetBlockTemplateResultTx, 0, len(s.mempool)),
+		Version:       0x20000000,
+		CoinbaseValue: s.subsidy(height),
+		LongPollID:    s.longPollId(),
+		MinTime:       uint32(minTime.Unix()),
+		MaxTime:       uint32(curTime.Add(MaxFutureBlockTime).Unix()),
+		Mutable:       []string{"time", "transactions", "prevblock"},
+		NonceRange:    "00000000ffffffff",
+		Capabilities:  []string{"longpoll"},
+	}
+	var indexes = map[string]int64{}
+	for i, entry := range s.mempool {
+		encoded, err := serializeHex(func(w *bytes.Buffer) error { return entry.tx.MsgTx().Serialize(w) })
+		if err != nil {
+			panic(err)
+		}
+		var depends []int64
+		for _, txIn := range entry.tx.MsgTx().TxIn {
+			if index, found := indexes[txIn.PreviousOutPoint.Hash.String()]; found {
+				depends = append(depends, index)
+			}
+		}
+		indexes[entry.tx.Hash().String()] = int64(i + 1)
+		result.Transactions = append(result.Transactions, btcjson.GetBlockTemplateResultTx{
+			Data:    encoded,
+			Hash:    entry.tx.MsgTx().WitnessHash().String(),
+			Depends: depends,
+			Fee:     entry.fee,
+			SigOps:  int64(blockchain.CountSigOps(entry.tx)) * blockchain.WitnessScaleFactor,
+			Weight:  blockchain.GetTransactionWeight(entry.tx),
+		})
+		result.CoinbaseValue += entry.fee
+	}
+	return result
+}
+
+func (s *Server) submitBlock(request *rpcRequest) (interface{}, *rpcError) {
+	var encoded string
+	if err := request.param(0, &encoded); err != nil {
+		return nil, err
+	}
+	data, err := hex.DecodeString(encoded)
+	if err != nil {
+		return nil, newRPCError(rpcDeserialization, "Block decode failed")
+	}
+	var msgBlock wire.MsgBlock
+	if err := msgBlock.Deserialize(bytes.NewReader(data)); err != nil && err != io.EOF {
+		return nil, newRPCError(rpcDeserialization, "Block decode failed")
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var result = s.validate(&msgBlock)
+	s.submissions = append(s.submissions, &Submission{Block: &msgBlock, Result: result})
+	if result == "" {
+		s.extend(&msgBlock)
+		return nil, nil
+	}
+	return result, nil
+}
+
+// validate checks a submitted block the way bitcoind would for a chain this simple and returns the BIP 22 reject
+// reason, or an empty string if the block extends the tip. Callers must hold the lock.
+func (s *Server) validate(msgBlock *wire.MsgBlock) string {
+	var block = btcutil.NewBlock(msgBlock)
+	var height = int32(len(s.blocks))
+	if _, _, found := s.findBlock(block.Hash().String()); found {
+		return "duplicate"
+	}
+	if msgBlock.Header.PrevBlock != s.hashes[height-1] {
+		return "inconclusive"
+	}
+	if msgBlock.Header.Bits != s.params.PowLimitBits {
+		return "bad-diffbits"
+	}
+	if err := blockchain.CheckBlockSanity(block, s.params.PowLimit, blockchain.NewMedianTime()); err != nil {
+		if ruleErr, ok := err.(blockchain.RuleError); ok {
+			switch ruleErr.ErrorCode {
+			case blockchain.ErrHighHash:
+				return "high-hash"
+			case blockchain.ErrBadMerkleRoot:
+				return "bad-txnmrklroot"
+			case blockchain.ErrTimeTooNew:
+				return "time-too-new"
+			}
+		}
+		return fmt.Sprintf("invalid: %v", err)
+	}
+	if !msgBlock.Header.Timestamp.After(s.medianTime(height - 1)) {
+		return "time-too-old"
+	}
+	var coinbase = block.Transactions()[0]
+	if coinbaseHeight, err := blockchain.ExtractCoinbaseHeight(coinbase); err != nil || coinbaseHeight != height {
+		return "bad-cb-height"
+	}
+	var fees = map[string]int64{}
+	for _, entry := range s.mempool {
+		fees[entry.tx.Hash().String()] = entry.fee
+	}
+	var maxValue = s.subsidy(height)
+	for _, tx := range block.Transactions()[1:] {
+		fee, found := fees[tx.Hash().String()]
+		if !found {
+			return "bad-txns-inputs-missingorspent"
+		}
+		maxValue += fee
+	}
+	var value int64
+	for _, txOut := range coinbase.MsgTx().TxOut {
+		value += txOut.Value
+	}
+	if value > maxValue {
+		return "bad-cb-amount"
+	}
+	return ""
+}
@@ -0,0 +1,293 @@
+// Package nodetest provides an in-process bitcoind stand-in speaking JSON-RPC on localhost, serving a deterministic
+// regtest chain so node, generator and device code can be exercised end-to-end without a real node.
+package nodetest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultUser            = "nodetest"
+	DefaultPass            = "nodetest"
+	DefaultLongPollTimeout = 2 * time.Second
+	BlockInterval          = 10 * time.Minute
+	MaxFutureBlockTime     = 2 * time.Hour
+)
+
+type mempoolTx struct {
+	tx  *btcutil.Tx
+	fee int64
+}
+
+type Submission struct {
+	Block  *wire.MsgBlock
+	Result string
+}
+
+// Accepted reports whether submitblock returned null, meaning the block became the new tip.
+func (s *Submission) Accepted() bool {
+	return s.Result == ""
+}
+
+type Server struct {
+	LongPollTimeout time.Duration
+	params          *chaincfg.Params
+	listener        net.Listener
+	httpServer      *http.Server
+	mtx             sync.Mutex
+	user            string
+	pass            string
+	blocks          []*wire.MsgBlock
+	hashes          []chainhash.Hash
+	mempool         []*mempoolTx
+	submissions     []*Submission
+	templateId      int
+	changed         chan struct{}
+}
+
+func NewServer() (*Server, error) {
+	var params = chaincfg.RegressionNetParams
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	var s = &Server{
+		LongPollTimeout: DefaultLongPollTimeout,
+		params:          &params,
+		listener:        listener,
+		user:            DefaultUser,
+		pass:            DefaultPass,
+		blocks:          []*wire.MsgBlock{params.GenesisBlock},
+		hashes:          []chainhash.Hash{*params.GenesisHash},
+		changed:         make(chan struct{}),
+	}
+	s.httpServer = &http.Server{Handler: s}
+	go func() {
+		_ = s.httpServer.Serve(listener)
+	}()
+	return s, nil
+}
+
+func (s *Server) Close() {
+	s.mtx.Lock()
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.mtx.Unlock()
+	_ = s.httpServer.Close()
+}
+
+func (s *Server) Host() string {
+	return s.listener.Addr().String()
+}
+
+func (s *Server) Params() *chaincfg.Params {
+	return s.params
+}
+
+// WalletAddress is a deterministic regtest P2PKH address suitable for config.Node.Wallet.
+func (s *Server) WalletAddress() string {
+	addr, err := btcutil.NewAddressPubKeyHash(make([]byte, 20), s.params)
+	if err != nil {
+		panic(err)
+	}
+	return addr.EncodeAddress()
+}
+
+func (s *Server) Config() *config.Node {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return &config.Node{
+		URL:         s.Host(),
+		Credentials: config.Credentials{User: s.user, Pass: s.pass},
+		Wallet:      s.WalletAddress(),
+	}
+}
+
+// SetCredentials changes the accepted RPC credentials, as a node restart does with its cookie.
+func (s *Server) SetCredentials(user, pass string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.user = user
+	s.pass = pass
+}
+
+func (s *Server) Height() int32 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return int32(len(s.blocks) - 1)
+}
+
+func (s *Server) TipHash() chainhash.Hash {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.hashes[len(s.hashes)-1]
+}
+
+func (s *Server) Submissions() []Submission {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var submissions = make([]Submission, len(s.submissions))
+	for i, submission := range s.submissions {
+		submissions[i] = *submission
+	}
+	return submissions
+}
+
+// notify wakes every pending longpoll. Callers must hold the lock.
+func (s *Server) notify() {
+	s.templateId += 1
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// AddTransaction places a transaction in the mempool with the given fee. Spending the output of another mempool
+// transaction makes it depend on that transaction in the template.
+func (s *Server) AddTransaction(tx *wire.MsgTx, fee int64) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.mempool = append(s.mempool, &mempoolTx{tx: btcutil.NewTx(tx), fee: fee})
+	s.notify()
+}
+
+func (s *Server) blockTime(height int32) time.Time {
+	return s.params.GenesisBlock.Header.Timestamp.Add(time.Duration(height) * BlockInterval)
+}
+
+func (s *Server) subsidy(height int32) int64 {
+	return blockchain.CalcBlockSubsidy(height, s.params)
+}
+
+// MineBlock extends the chain with an empty block paying an unrelated script, as if another miner found it.
+func (s *Server) MineBlock() chainhash.Hash {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var height = int32(len(s.blocks))
+	var msgBlock = s.buildBlock(height, []byte{0x51})
+	s.extend(msgBlock)
+	return msgBlock.BlockHash()
+}
+
+// buildBlock solves an empty block on the current tip. Callers must hold the lock.
+func (s *Server) buildBlock(height int32, pkScript []byte) *wire.MsgBlock {
+	script, err := coinbaseScript(height)
+	if err != nil {
+		panic(err)
+	}
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex),
+		SignatureScript:  script,
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	coinbase.AddTxOut(&wire.TxOut{Value: s.subsidy(height), PkScript: pkScript})
+	var msgBlock = &wire.MsgBlock{Header: wire.BlockHeader{
+		Version:    0x20000000,
+		PrevBlock:  s.hashes[len(s.hashes)-1],
+		MerkleRoot: coinbase.TxHash(),
+		Timestamp:  s.blockTime(height),
+		Bits:       s.params.PowLimitBits,
+	}}
+	_ = msgBlock.AddTransaction(coinbase)
+	SolveHeader(&msgBlock.Header)
+	return msgBlock
+}
+
+// extend appends a block to the chain and drops the transactions it confirmed. Callers must hold the lock.
+func (s *Server) extend(msgBlock *wire.MsgBlock) {
+	var confirmed = map[chainhash.Hash]bool{}
+	for _, tx := range msgBlock.Transactions {
+		confirmed[tx.TxHash()] = true
+	}
+	var mempool = make([]*mempoolTx, 0, len(s.mempool))
+	for _, entry := range s.mempool {
+		if !confirmed[*entry.tx.Hash()] {
+			mempool = append(mempool, entry)
+		}
+	}
+	s.mempool = mempool
+	s.blocks = append(s.blocks, msgBlock)
+	s.hashes = append(s.hashes, msgBlock.BlockHash())
+	s.notify()
+}
+
+func (s *Server) findBlock(hashStr string) (*wire.MsgBlock, int32, bool) {
+	hash, err := chainhash.NewHashFromStr(hashStr)
+	if err != nil {
+		return nil, 0, false
+	}
+	for height := range s.hashes {
+		if s.hashes[height].IsEqual(hash) {
+			return s.blocks[height], int32(height), true
+		}
+	}
+	return nil, 0, false
+}
+
+func serializeHex(serialize func(w *bytes.Buffer) error) (string, error) {
+	var buf bytes.Buffer
+	if err := serialize(&buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf.Bytes()), nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mtx.Lock()
+	user, pass := s.user, s.pass
+	s.mtx.Unlock()
+	serveRPC(w, r, user, pass, s.dispatch)
+}
+
+// serveRPC answers a single JSON-RPC request after checking its basic auth credentials.
+func serveRPC(
+	w http.ResponseWriter,
+	r *http.Request,
+	user, pass string,
+	dispatch func(request *rpcRequest) (interface{}, *rpcError),
+) {
+	if requestUser, requestPass, ok := r.BasicAuth(); !ok || requestUser != user || requestPass != pass {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var request rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	result, rpcErr := dispatch(&request)
+	var response = rpcResponse{ID: request.ID, Result: result, Error: rpcErr}
+	if rpcErr != nil {
+		response.Result = nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&response); err != nil {
+		panic(fmt.Errorf("nodetest: encoding response: %w", err))
+	}
+}
+
+// SolveHeader grinds the nonce of a header until it meets the target encoded in its bits, which takes a couple of
+// hashes at regtest difficulty. It reports false if the nonce space is exhausted.
+func SolveHeader(header *wire.BlockHeader) bool {
+	var target = blockchain.CompactToBig(header.Bits)
+	for nonce := uint64(0); nonce <= 0xffffffff; nonce++ {
+		header.Nonce = uint32(nonce)
+		var hash = header.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			return true
+		}
+	}
+	return false
+}
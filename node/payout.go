@@ -0,0 +1,251 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	PayoutPath      = "wallet"
+	PayoutIndexFile = "payout.json"
+)
+
+// Payout script types a descriptor can produce
+const (
+	PayoutPKH      = "pkh"
+	PayoutWPKH     = "wpkh"
+	PayoutSHWPKH   = "sh(wpkh)"
+	payoutWildcard = "*"
+)
+
+var ErrInvalidDescriptor = errors.New("invalid payout descriptor")
+
+// PayoutDescriptor derives payout addresses from an extended public key. It accepts pkh(), wpkh() and sh(wpkh())
+// descriptors whose key ends in a /* wildcard, with an optional key origin and checksum, or a bare xpub which pays
+// pkh(xpub/0/*).
+type PayoutDescriptor struct {
+	Descriptor string
+	Script     string
+	key        *hdkeychain.ExtendedKey
+	path       []uint32
+}
+
+func ParsePayoutDescriptor(descriptor string) (*PayoutDescriptor, error) {
+	descriptor = strings.TrimSpace(descriptor)
+	if checksum := strings.IndexByte(descriptor, '#'); checksum >= 0 {
+		descriptor = descriptor[:checksum]
+	}
+	var pd = &PayoutDescriptor{Descriptor: descriptor, Script: PayoutPKH}
+	var keyExpr = descriptor
+	if open := strings.IndexByte(descriptor, '('); open >= 0 {
+		if !strings.HasSuffix(descriptor, ")") {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidDescriptor, descriptor)
+		}
+		switch descriptor[:open] {
+		case PayoutPKH:
+			keyExpr = descriptor[open+1 : len(descriptor)-1]
+		case PayoutWPKH:
+			pd.Script = PayoutWPKH
+			keyExpr = descriptor[open+1 : len(descriptor)-1]
+		case "sh":
+			var inner = descriptor[open+1 : len(descriptor)-1]
+			if !strings.HasPrefix(inner, PayoutWPKH+"(") || !strings.HasSuffix(inner, ")") {
+				return nil, fmt.Errorf("%w: unsupported script %s", ErrInvalidDescriptor, inner)
+			}
+			pd.Script = PayoutSHWPKH
+			keyExpr = inner[len(PayoutWPKH)+1 : len(inner)-1]
+		default:
+			return nil, fmt.Errorf("%w: unsupported script %s", ErrInvalidDescriptor, descriptor[:open])
+		}
+	} else {
+		keyExpr += "/0/" + payoutWildcard
+	}
+	if strings.HasPrefix(keyExpr, "[") {
+		var originEnd = strings.IndexByte(keyExpr, ']')
+		if originEnd < 0 {
+			return nil, fmt.Errorf("%w: unterminated key origin", ErrInvalidDescriptor)
+		}
+		keyExpr = keyExpr[originEnd+1:]
+	}
+	var steps = strings.Split(keyExpr, "/")
+	if len(steps) < 2 || steps[len(steps)-1] != payoutWildcard {
+		return nil, fmt.Errorf("%w: key must end in /%s", ErrInvalidDescriptor, payoutWildcard)
+	}
+	key, keyErr := hdkeychain.NewKeyFromString(steps[0])
+	if keyErr != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDescriptor, keyErr)
+	}
+	if key.IsPrivate() {
+		return nil, fmt.Errorf("%w: use the extended public key", ErrInvalidDescriptor)
+	}
+	pd.key = key
+	for _, step := range steps[1 : len(steps)-1] {
+		index, indexErr := strconv.ParseUint(step, 10, 31)
+		if indexErr != nil {
+			return nil, fmt.Errorf("%w: step %s is hardened or invalid", ErrInvalidDescriptor, step)
+		}
+		pd.path = append(pd.path, uint32(index))
+	}
+	return pd, nil
+}
+
+// IsForNet reports whether the extended key belongs to the network, which shares the key version of its base
+// Bitcoin network on other chains.
+func (pd *PayoutDescriptor) IsForNet(params *chaincfg.Params) bool {
+	return pd.key.IsForNet(params)
+}
+
+// Address derives the payout address at index of the wildcard step.
+func (pd *PayoutDescriptor) Address(index uint32, params *chaincfg.Params) (btcutil.Address, error) {
+	var key = pd.key
+	var err error
+	for _, step := range append(append([]uint32{}, pd.path...), index) {
+		if key, err = key.Derive(step); err != nil {
+			return nil, err
+		}
+	}
+	pubKey, pubKeyErr := key.ECPubKey()
+	if pubKeyErr != nil {
+		return nil, pubKeyErr
+	}
+	var pubKeyHash = btcutil.Hash160(pubKey.SerializeCompressed())
+	switch pd.Script {
+	case PayoutWPKH:
+		return btcutil.NewAddressWitnessPubKeyHash(pubKeyHash, params)
+	case PayoutSHWPKH:
+		var redeemScript = append([]byte{0x00, 0x14}, pubKeyHash...)
+		return btcutil.NewAddressScriptHash(redeemScript, params)
+	default:
+		return btcutil.NewAddressPubKeyHash(pubKeyHash, params)
+	}
+}
+
+// PayoutWallet rotates the coinbase payout through the addresses of a descriptor. The next index for every
+// descriptor is kept in the home folder so addresses are not reused across restarts.
+type PayoutWallet struct {
+	descriptor *PayoutDescriptor
+	params     *chaincfg.Params
+	indexPath  string
+	index      uint32
+	address    btcutil.Address
+	mtx        sync.Mutex
+}
+
+func GetPayoutIndexPath() string {
+	return path.Join(utils.GetSubFolder(PayoutPath), PayoutIndexFile)
+}
+
+func loadPayoutIndexes(indexPath string) (map[string]uint32, error) {
+	var indexes = map[string]uint32{}
+	data, err := ioutil.ReadFile(indexPath)
+	if os.IsNotExist(err) {
+		return indexes, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &indexes); err != nil {
+		return nil, err
+	}
+	return indexes, nil
+}
+
+// NewPayoutWallet resumes a descriptor at its persisted index. Segwit scripts are refused on chains without segwit,
+// where their outputs would be spendable by anyone.
+func NewPayoutWallet(
+	descriptor string,
+	params *chaincfg.Params,
+	segwit bool,
+	indexPath string,
+) (*PayoutWallet, error) {
+	pd, err := ParsePayoutDescriptor(descriptor)
+	if err != nil {
+		return nil, err
+	}
+	if !pd.IsForNet(params) {
+		return nil, fmt.Errorf("%w: extended key is not for %s", ErrInvalidDescriptor, params.Name)
+	}
+	if !segwit && pd.Script != PayoutPKH {
+		return nil, fmt.Errorf("%w: %s needs a segwit chain", ErrInvalidDescriptor, pd.Script)
+	}
+	indexes, err := loadPayoutIndexes(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	var pw = &PayoutWallet{descriptor: pd, params: params, indexPath: indexPath}
+	if pw.index, pw.address, err = pw.derive(indexes[pd.Descriptor]); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// derive returns the first index from index on that BIP32 leaves with a valid key, and its address.
+func (pw *PayoutWallet) derive(index uint32) (uint32, btcutil.Address, error) {
+	for {
+		address, err := pw.descriptor.Address(index, pw.params)
+		if err == hdkeychain.ErrInvalidChild {
+			index += 1
+			continue
+		} else if err != nil {
+			return 0, nil, err
+		}
+		return index, address, nil
+	}
+}
+
+// save writes index for the descriptor, keeping those of other descriptors. Callers must hold the lock.
+func (pw *PayoutWallet) save(index uint32) error {
+	indexes, err := loadPayoutIndexes(pw.indexPath)
+	if err != nil {
+		return err
+	}
+	indexes[pw.descriptor.Descriptor] = index
+	data, err := json.MarshalIndent(indexes, "", "  ")
+	if err != nil {
+		return err
+	}
+	var tmpPath = pw.indexPath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, pw.indexPath)
+}
+
+func (pw *PayoutWallet) Address() btcutil.Address {
+	pw.mtx.Lock()
+	defer pw.mtx.Unlock()
+	return pw.address
+}
+
+func (pw *PayoutWallet) Index() uint32 {
+	pw.mtx.Lock()
+	defer pw.mtx.Unlock()
+	return pw.index
+}
+
+// Advance moves to the next address once the current one has been paid, persisting the new index before it is
+// used so a crash cannot hand the same address out again. The wallet keeps its current address when either step
+// fails.
+func (pw *PayoutWallet) Advance() (btcutil.Address, error) {
+	pw.mtx.Lock()
+	defer pw.mtx.Unlock()
+	index, address, err := pw.derive(pw.index + 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := pw.save(index); err != nil {
+		return nil, err
+	}
+	pw.index, pw.address = index, address
+	return address, nil
+}
@@ -0,0 +1,147 @@
+package node
+
+import (
+	"errors"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func testAccountKey(t *testing.T, params *chaincfg.Params) (*hdkeychain.ExtendedKey, string) {
+	master, err := hdkeychain.NewMaster(make([]byte, hdkeychain.RecommendedSeedLen), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := master.Derive(hdkeychain.HardenedKeyStart + 84)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, err := account.Neuter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account, xpub.String()
+}
+
+func testChildHash(t *testing.T, account *hdkeychain.ExtendedKey, path ...uint32) []byte {
+	var key = account
+	var err error
+	for _, step := range path {
+		if key, err = key.Derive(step); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pubKey, err := key.ECPubKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return btcutil.Hash160(pubKey.SerializeCompressed())
+}
+
+func TestParsePayoutDescriptor(t *testing.T) {
+	var params = &chaincfg.MainNetParams
+	account, xpub := testAccountKey(t, params)
+	var expected = []struct {
+		descriptor string
+		address    func(hash []byte) (btcutil.Address, error)
+		path       []uint32
+	}{
+		{xpub, func(hash []byte) (btcutil.Address, error) {
+			return btcutil.NewAddressPubKeyHash(hash, params)
+		}, []uint32{0, 5}},
+		{"wpkh([d34db33f/84'/0'/0']" + xpub + "/1/*)#abcdefgh", func(hash []byte) (btcutil.Address, error) {
+			return btcutil.NewAddressWitnessPubKeyHash(hash, params)
+		}, []uint32{1, 5}},
+		{"sh(wpkh(" + xpub + "/*))", func(hash []byte) (btcutil.Address, error) {
+			return btcutil.NewAddressScriptHash(append([]byte{0x00, 0x14}, hash...), params)
+		}, []uint32{5}},
+	}
+	for _, e := range expected {
+		pd, err := ParsePayoutDescriptor(e.descriptor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr, err := pd.Address(5, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedAddr, err := e.address(testChildHash(t, account, e.path...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr.EncodeAddress() != expectedAddr.EncodeAddress() {
+			t.Fatalf("%s derived %s, expected %s", e.descriptor, addr, expectedAddr)
+		}
+	}
+	for _, descriptor := range []string{
+		"tr(" + xpub + "/0/*)",
+		"wpkh(" + xpub + "/0/1)",
+		"wpkh(" + xpub + "/0'/*)",
+		"wpkh([d34db33f" + xpub + "/0/*)",
+		"1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH",
+	} {
+		if _, err := ParsePayoutDescriptor(descriptor); !errors.Is(err, ErrInvalidDescriptor) {
+			t.Fatalf("expected invalid descriptor for %s, got %v", descriptor, err)
+		}
+	}
+	if _, err := ParsePayoutDescriptor(account.String()); !errors.Is(err, ErrInvalidDescriptor) {
+		t.Fatal("accepted an extended private key")
+	}
+}
+
+func TestPayoutWallet_Advance(t *testing.T) {
+	folder, err := ioutil.TempDir("", "goasicminer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	var indexPath = path.Join(folder, PayoutIndexFile)
+	var params = &chaincfg.RegressionNetParams
+	account, tpub := testAccountKey(t, params)
+	var descriptor = "wpkh(" + tpub + "/0/*)"
+	if _, err := NewPayoutWallet(descriptor, &chaincfg.MainNetParams, true, indexPath); err == nil {
+		t.Fatal("accepted a key for another network")
+	}
+	if _, err := NewPayoutWallet(descriptor, params, false, indexPath); err == nil {
+		t.Fatal("accepted a segwit descriptor on a chain without segwit")
+	}
+	wallet, err := NewPayoutWallet(descriptor, params, true, indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first = wallet.Address()
+	for i := 0; i < 2; i++ {
+		if _, err := wallet.Advance(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resumed, err := NewPayoutWallet(descriptor, params, true, indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Index() != 2 || resumed.Address().EncodeAddress() != wallet.Address().EncodeAddress() {
+		t.Fatalf("resumed at index %d with %s", resumed.Index(), resumed.Address())
+	}
+	if resumed.Address().EncodeAddress() == first.EncodeAddress() {
+		t.Fatal("payout address did not rotate")
+	}
+	expected, err := btcutil.NewAddressWitnessPubKeyHash(testChildHash(t, account, 0, 2), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Address().EncodeAddress() != expected.EncodeAddress() {
+		t.Fatalf("derived %s, expected %s", resumed.Address(), expected)
+	}
+	// an index that cannot be saved leaves the wallet on its current address
+	resumed.indexPath = path.Join(folder, "missing", PayoutIndexFile)
+	if _, err := resumed.Advance(); err == nil {
+		t.Fatal("advanced without saving the index")
+	}
+	if resumed.Index() != 2 || resumed.Address().EncodeAddress() != expected.EncodeAddress() {
+		t.Fatalf("failed advance moved to index %d with %s", resumed.Index(), resumed.Address())
+	}
+}
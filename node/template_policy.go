@@ -0,0 +1,293 @@
+package node
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"github.com/stevenroose/go-bitcoin-core-rpc/btcjson"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	// CoinbaseWeightReserve and CoinbaseSigOpsReserve mirror what bitcoind sets aside for the coinbase.
+	CoinbaseWeightReserve = 4000
+	CoinbaseSigOpsReserve = 400
+)
+
+type TemplatePolicy struct {
+	excludeTxids    map[string]bool
+	excludeScripts  []*regexp.Regexp
+	priorityTxids   map[string]bool
+	priorityScripts []*regexp.Regexp
+	maxWeight       int64
+	maxSigOps       int64
+	emptyBlock      bool
+}
+
+type TemplateSelection struct {
+	Transactions  []btcjson.GetBlockTemplateResultTx
+	CoinbaseValue int64
+	Fees          int64
+	Weight        int64
+	SigOps        int64
+	Excluded      int
+	txs           []*btcutil.Tx
+	hashes        []chainhash.Hash
+	branches      map[int][]chainhash.Hash
+	commitments   map[int][]byte
+	mtx           sync.Mutex
+}
+
+func compileScriptPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled = make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(strings.ToLower(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("node.NewTemplatePolicy: invalid script pattern %s: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+func txidSet(txids []string) map[string]bool {
+	var set = make(map[string]bool, len(txids))
+	for _, txid := range txids {
+		set[strings.ToLower(txid)] = true
+	}
+	return set
+}
+
+func NewTemplatePolicy(cfg *config.TemplatePolicy) (*TemplatePolicy, error) {
+	var tp = &TemplatePolicy{
+		excludeTxids:  txidSet(cfg.ExcludeTxids),
+		priorityTxids: txidSet(cfg.PriorityTxids),
+		maxWeight:     cfg.MaxWeight,
+		maxSigOps:     cfg.MaxSigOps,
+		emptyBlock:    cfg.EmptyBlock,
+	}
+	var err error
+	if tp.excludeScripts, err = compileScriptPatterns(cfg.ExcludeScripts); err != nil {
+		return nil, err
+	}
+	if tp.priorityScripts, err = compileScriptPatterns(cfg.PriorityScripts); err != nil {
+		return nil, err
+	}
+	return tp, nil
+}
+
+// matches checks a template transaction against a txid set and output script patterns. Scripts are matched as
+// lowercase hex, so "^6a" selects OP_RETURN outputs.
+func matches(txid, hash string, scripts []string, txids map[string]bool, patterns []*regexp.Regexp) bool {
+	if txids[txid] || txids[hash] {
+		return true
+	}
+	for _, pattern := range patterns {
+		for _, script := range scripts {
+			if pattern.MatchString(script) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (tp *TemplatePolicy) classify(
+	templateTxs []btcjson.GetBlockTemplateResultTx,
+	msgTxs []*wire.MsgTx,
+) (excluded []bool, priority []bool) {
+	excluded = make([]bool, len(templateTxs))
+	priority = make([]bool, len(templateTxs))
+	for i, msgTx := range msgTxs {
+		var txid = msgTx.TxHash().String()
+		var hash = strings.ToLower(templateTxs[i].Hash)
+		var scripts = make([]string, len(msgTx.TxOut))
+		for j, txOut := range msgTx.TxOut {
+			scripts[j] = hex.EncodeToString(txOut.PkScript)
+		}
+		excluded[i] = matches(txid, hash, scripts, tp.excludeTxids, tp.excludeScripts)
+		priority[i] = matches(txid, hash, scripts, tp.priorityTxids, tp.priorityScripts)
+	}
+	return
+}
+
+func dependencies(templateTx *btcjson.GetBlockTemplateResultTx, count int) ([]int, error) {
+	var parents = make([]int, 0, len(templateTx.Depends))
+	for _, dependency := range templateTx.Depends {
+		// depends is 1-based and may only reference earlier transactions
+		var parent = int(dependency) - 1
+		if parent < 0 || parent >= count {
+			return nil, fmt.Errorf("node.TemplatePolicy: invalid dependency %d", dependency)
+		}
+		parents = append(parents, parent)
+	}
+	return parents, nil
+}
+
+// Select applies the policy to a block template. Excluding a transaction also excludes everything that depends on
+// it, caps are filled with priority transactions and their ancestors first, and the result keeps template order so
+// parents always precede their children.
+func (tp *TemplatePolicy) Select(template *btcjson.GetBlockTemplateResult) (*TemplateSelection, error) {
+	var templateTxs = template.Transactions
+	var count = len(templateTxs)
+	var selection = &TemplateSelection{CoinbaseValue: template.CoinbaseValue}
+	var parents = make([][]int, count)
+	var msgTxs = make([]*wire.MsgTx, count)
+	for i, templateTx := range templateTxs {
+		var msgTxErr error
+		if msgTxs[i], msgTxErr = ToMsgTx(templateTx.Data); msgTxErr != nil {
+			return nil, msgTxErr
+		}
+	}
+	excluded, priority := tp.classify(templateTxs, msgTxs)
+	for i := range templateTxs {
+		var err error
+		if parents[i], err = dependencies(&templateTxs[i], i); err != nil {
+			return nil, err
+		}
+		for _, parent := range parents[i] {
+			if excluded[parent] {
+				excluded[i] = true
+			}
+		}
+	}
+	var maxWeight, maxSigOps = tp.limits(template)
+	var selected = make([]bool, count)
+	var include = func(i int) {
+		var closure []int
+		var visited = map[int]bool{}
+		var visit func(j int)
+		visit = func(j int) {
+			if visited[j] || selected[j] {
+				return
+			}
+			visited[j] = true
+			for _, parent := range parents[j] {
+				visit(parent)
+			}
+			closure = append(closure, j)
+		}
+		visit(i)
+		var weight, sigOps int64
+		for _, j := range closure {
+			weight += templateTxs[j].Weight
+			sigOps += templateTxs[j].SigOps
+		}
+		if maxWeight > 0 && selection.Weight+weight > maxWeight {
+			return
+		}
+		if maxSigOps > 0 && selection.SigOps+sigOps > maxSigOps {
+			return
+		}
+		for _, j := range closure {
+			selected[j] = true
+		}
+		selection.Weight += weight
+		selection.SigOps += sigOps
+	}
+	if !tp.emptyBlock {
+		for i := 0; i < count; i++ {
+			if priority[i] && !excluded[i] {
+				include(i)
+			}
+		}
+		for i := 0; i < count; i++ {
+			if !excluded[i] {
+				include(i)
+			}
+		}
+	}
+	selection.Transactions = make([]btcjson.GetBlockTemplateResultTx, 0, count)
+	selection.txs = make([]*btcutil.Tx, 0, count)
+	selection.hashes = make([]chainhash.Hash, 0, count)
+	selection.branches = map[int][]chainhash.Hash{}
+	selection.commitments = map[int][]byte{}
+	for i, templateTx := range templateTxs {
+		if selected[i] {
+			var tx = btcutil.NewTx(msgTxs[i])
+			selection.Transactions = append(selection.Transactions, templateTx)
+			selection.txs = append(selection.txs, tx)
+			selection.hashes = append(selection.hashes, *tx.Hash())
+			selection.Fees += templateTx.Fee
+		} else {
+			selection.CoinbaseValue -= templateTx.Fee
+			selection.Excluded += 1
+		}
+	}
+	return selection, nil
+}
+
+func (tp *TemplatePolicy) limits(template *btcjson.GetBlockTemplateResult) (maxWeight int64, maxSigOps int64) {
+	maxWeight, maxSigOps = tp.maxWeight, tp.maxSigOps
+	if template.WeightLimit > 0 && (maxWeight <= 0 || maxWeight > template.WeightLimit) {
+		maxWeight = template.WeightLimit
+	}
+	if template.SigOpLimit > 0 && (maxSigOps <= 0 || maxSigOps > template.SigOpLimit) {
+		maxSigOps = template.SigOpLimit
+	}
+	if maxWeight > 0 {
+		maxWeight -= CoinbaseWeightReserve
+	}
+	if maxSigOps > 0 {
+		maxSigOps -= CoinbaseSigOpsReserve
+	}
+	return
+}
+
+// Truncate drops transactions from the tail of the selection and returns the remaining decoded transactions, the
+// coinbase merkle branch over them and the coinbase value reduced by the fees they no longer collect. Template order
+// guarantees no kept transaction depends on a dropped one. Branches are cached per transaction count, so a new
+// coinbase only costs log2(n) hashes to turn into a merkle root.
+func (ts *TemplateSelection) Truncate(removedTransactions int) ([]*btcutil.Tx, []chainhash.Hash, int64) {
+	var count = len(ts.txs)
+	var coinbaseValue = ts.CoinbaseValue
+	removedTransactions = utils.Min(removedTransactions, count-1)
+	if removedTransactions > 0 {
+		for _, templateTx := range ts.Transactions[count-removedTransactions:] {
+			coinbaseValue -= templateTx.Fee
+		}
+		count -= removedTransactions
+	}
+	ts.mtx.Lock()
+	defer ts.mtx.Unlock()
+	branch, found := ts.branches[count]
+	if !found {
+		branch = MerkleBranch(ts.hashes[:count])
+		ts.branches[count] = branch
+	}
+	return ts.txs[:count], branch, coinbaseValue
+}
+
+// WitnessCommitment returns the coinbase output script committing to the witnesses of the first count selected
+// transactions, or nil when none of them carry witness data. The coinbase wtxid is zero by definition, so the
+// commitment does not depend on the coinbase and is cached per transaction count like the merkle branches.
+func (ts *TemplateSelection) WitnessCommitment(count int) []byte {
+	ts.mtx.Lock()
+	defer ts.mtx.Unlock()
+	if commitment, found := ts.commitments[count]; found {
+		return commitment
+	}
+	var commitment []byte
+	var witnessHashes = make([]chainhash.Hash, count)
+	for i, tx := range ts.txs[:count] {
+		if tx.MsgTx().HasWitness() {
+			commitment = []byte{}
+		}
+		witnessHashes[i] = tx.MsgTx().WitnessHash()
+	}
+	if commitment != nil {
+		var witnessRoot = MerkleRootFromBranch(chainhash.Hash{}, MerkleBranch(witnessHashes))
+		var witnessNonce [blockchain.CoinbaseWitnessDataLen]byte
+		var hash = chainhash.DoubleHashB(append(witnessRoot[:], witnessNonce[:]...))
+		commitment = append(append([]byte{}, blockchain.WitnessMagicBytes...), hash...)
+	}
+	ts.commitments[count] = commitment
+	return commitment
+}
@@ -0,0 +1,108 @@
+package node
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"github.com/stevenroose/go-bitcoin-core-rpc/btcjson"
+	"testing"
+)
+
+func testTemplateTx(t *testing.T, seed byte, pkScript []byte, fee int64, depends ...int64) btcjson.GetBlockTemplateResultTx {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{seed}, 0),
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	tx.AddTxOut(&wire.TxOut{Value: 1000, PkScript: pkScript})
+	data, err := MsgTxToString(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return btcjson.GetBlockTemplateResultTx{
+		Data:    data,
+		Hash:    tx.TxHash().String(),
+		Depends: depends,
+		Fee:     fee,
+		SigOps:  4,
+		Weight:  1000,
+	}
+}
+
+func testTemplate(t *testing.T) *btcjson.GetBlockTemplateResult {
+	var p2pkh = []byte{0x76, 0xa9, 0x14}
+	return &btcjson.GetBlockTemplateResult{
+		CoinbaseValue: 625000000 + 100 + 200 + 300 + 400,
+		Transactions: []btcjson.GetBlockTemplateResultTx{
+			testTemplateTx(t, 1, p2pkh, 100),
+			testTemplateTx(t, 2, []byte{0x6a, 0x04}, 200),
+			testTemplateTx(t, 3, p2pkh, 300, 2),
+			testTemplateTx(t, 4, p2pkh, 400, 1),
+		},
+	}
+}
+
+func TestTemplatePolicy_ExcludeScripts(t *testing.T) {
+	template := testTemplate(t)
+	policy, err := NewTemplatePolicy(&config.TemplatePolicy{ExcludeScripts: []string{"^6a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	selection, err := policy.Select(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the OP_RETURN transaction and its dependant are both dropped
+	if len(selection.Transactions) != 2 || selection.Excluded != 2 {
+		t.Fatalf("expected 2 transactions, got %d", len(selection.Transactions))
+	}
+	if selection.CoinbaseValue != 625000000+100+400 {
+		t.Fatalf("unexpected coinbase value %d", selection.CoinbaseValue)
+	}
+	transactions, _, coinbaseValue := selection.Truncate(1)
+	if len(transactions) != 1 || coinbaseValue != 625000000+100 {
+		t.Fatalf("unexpected truncation %d %d", len(transactions), coinbaseValue)
+	}
+}
+
+func TestTemplatePolicy_PriorityWithinWeight(t *testing.T) {
+	template := testTemplate(t)
+	policy, err := NewTemplatePolicy(&config.TemplatePolicy{
+		PriorityTxids: []string{template.Transactions[3].Hash},
+		MaxWeight:     CoinbaseWeightReserve + 2000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	selection, err := policy.Select(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the priority transaction pulls its parent in ahead of everything else
+	if len(selection.Transactions) != 2 ||
+		selection.Transactions[0].Hash != template.Transactions[0].Hash ||
+		selection.Transactions[1].Hash != template.Transactions[3].Hash {
+		t.Fatal("priority transaction and its parent not selected in template order")
+	}
+	if selection.Weight != 2000 || selection.Fees != 500 {
+		t.Fatalf("unexpected weight %d fees %d", selection.Weight, selection.Fees)
+	}
+}
+
+func TestTemplatePolicy_EmptyBlock(t *testing.T) {
+	template := testTemplate(t)
+	policy, err := NewTemplatePolicy(&config.TemplatePolicy{EmptyBlock: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	selection, err := policy.Select(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selection.Transactions) != 0 || selection.CoinbaseValue != 625000000 {
+		t.Fatalf("unexpected empty block selection %d %d", len(selection.Transactions), selection.CoinbaseValue)
+	}
+	if transactions, branch, _ := selection.Truncate(3); len(transactions) != 0 || len(branch) != 0 {
+		t.Fatal("truncating an empty selection returned transactions")
+	}
+}
@@ -0,0 +1,85 @@
+package node
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"github.com/stevenroose/go-bitcoin-core-rpc/btcjson"
+	"time"
+)
+
+const (
+	DefaultTemplateRefreshInterval = 30 * time.Second
+	DefaultTemplateMaxAge          = 10 * time.Minute
+)
+
+// Reasons a refreshed template replaces the current one
+const (
+	RefreshInitial   = "initial"
+	RefreshPrevBlock = "prevblock"
+	RefreshMissing   = "missing"
+	RefreshFees      = "fees"
+	RefreshAge       = "age"
+)
+
+// TemplateRefresh decides whether a template fetched on the same tip is worth pushing as new work. Without it every
+// mempool change restarts the devices on a template that may collect no more fees than the current one.
+type TemplateRefresh struct {
+	Interval    time.Duration
+	MinFeeDelta int64
+	MaxAge      time.Duration
+	Disabled    bool
+}
+
+func NewTemplateRefresh(cfg *config.TemplateRefresh) *TemplateRefresh {
+	var tr = &TemplateRefresh{
+		Interval:    cfg.Interval,
+		MinFeeDelta: cfg.MinFeeDelta,
+		MaxAge:      cfg.MaxAge,
+		Disabled:    cfg.Disabled,
+	}
+	if tr.Interval <= 0 {
+		tr.Interval = DefaultTemplateRefreshInterval
+	}
+	if tr.MaxAge <= 0 {
+		tr.MaxAge = DefaultTemplateMaxAge
+	}
+	return tr
+}
+
+// Reason returns why the next template should replace the current one, or an empty string to keep mining the
+// current one. A template below the current height comes from a stale tip and never wins. A new tip, or a selected
+// transaction leaving the mempool, always wins. Otherwise the fees must rise by at least MinFeeDelta, and by
+// something when it is zero, or the current template must be older than MaxAge.
+func (tr *TemplateRefresh) Reason(
+	current *btcjson.GetBlockTemplateResult,
+	currentSelection *TemplateSelection,
+	age time.Duration,
+	next *btcjson.GetBlockTemplateResult,
+	nextSelection *TemplateSelection,
+) string {
+	if current == nil || currentSelection == nil {
+		return RefreshInitial
+	}
+	if next.Height < current.Height {
+		return ""
+	}
+	if current.PreviousHash != next.PreviousHash {
+		return RefreshPrevBlock
+	}
+	var nextHashes = make(map[string]bool, len(next.Transactions))
+	for _, templateTx := range next.Transactions {
+		nextHashes[templateTx.Hash] = true
+	}
+	for _, templateTx := range currentSelection.Transactions {
+		if !nextHashes[templateTx.Hash] {
+			return RefreshMissing
+		}
+	}
+	var feeDelta = nextSelection.Fees - currentSelection.Fees
+	if feeDelta > 0 && feeDelta >= tr.MinFeeDelta {
+		return RefreshFees
+	}
+	if age >= tr.MaxAge {
+		return RefreshAge
+	}
+	return ""
+}
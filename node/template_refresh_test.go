@@ -0,0 +1,58 @@
+package node
+
+import (
+	"github.com/fernandosanchezjr/goasicminer/config"
+	"github.com/stevenroose/go-bitcoin-core-rpc/btcjson"
+	"testing"
+	"time"
+)
+
+func TestTemplateRefresh_Reason(t *testing.T) {
+	refresh := NewTemplateRefresh(&config.TemplateRefresh{MinFeeDelta: 1000, MaxAge: time.Minute})
+	current := &btcjson.GetBlockTemplateResult{
+		Height:       100,
+		PreviousHash: "aa",
+		Transactions: []btcjson.GetBlockTemplateResultTx{{Hash: "01"}},
+	}
+	currentSelection := &TemplateSelection{Transactions: current.Transactions, Fees: 5000}
+	next := &btcjson.GetBlockTemplateResult{
+		PreviousHash: "aa",
+		Transactions: []btcjson.GetBlockTemplateResultTx{{Hash: "01"}, {Hash: "02"}},
+	}
+	nextSelection := &TemplateSelection{Transactions: next.Transactions, Fees: 5500}
+	for _, test := range []struct {
+		name     string
+		age      time.Duration
+		prevHash string
+		height   int64
+		fees     int64
+		missing  bool
+		reason   string
+	}{
+		{name: "small fee rise", prevHash: "aa", fees: 5500},
+		{name: "fee rise", prevHash: "aa", fees: 6000, reason: RefreshFees},
+		{name: "fee drop", prevHash: "aa", fees: 1000},
+		{name: "stale", prevHash: "aa", fees: 5000, age: time.Minute, reason: RefreshAge},
+		{name: "new tip", prevHash: "bb", fees: 0, reason: RefreshPrevBlock},
+		{name: "evicted", prevHash: "aa", fees: 5500, missing: true, reason: RefreshMissing},
+		{name: "next height", prevHash: "bb", height: 101, fees: 0, reason: RefreshPrevBlock},
+		{name: "stale tip", prevHash: "bb", height: 99, fees: 9000},
+	} {
+		next.PreviousHash = test.prevHash
+		next.Height = current.Height
+		if test.height != 0 {
+			next.Height = test.height
+		}
+		nextSelection.Fees = test.fees
+		next.Transactions[0].Hash = "01"
+		if test.missing {
+			next.Transactions[0].Hash = "03"
+		}
+		if reason := refresh.Reason(current, currentSelection, test.age, next, nextSelection); reason != test.reason {
+			t.Fatalf("%s: expected %q, got %q", test.name, test.reason, reason)
+		}
+	}
+	if refresh.Reason(nil, nil, 0, next, nextSelection) != RefreshInitial {
+		t.Fatal("first template not accepted")
+	}
+}
@@ -2,9 +2,11 @@ package node
 
 import (
 	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 	"github.com/fernandosanchezjr/goasicminer/utils"
+	"github.com/stevenroose/go-bitcoin-core-rpc/btcjson"
 	"math/big"
 	"sync/atomic"
 	"time"
@@ -20,6 +22,7 @@ type Work struct {
 	Version             utils.Version
 	Ntime               utils.NTime
 	MinNtime            utils.NTime
+	MaxNtime            utils.NTime
 	Nonce               uint32
 	Node                *Node
 	TargetDifficulty    utils.Difficulty
@@ -28,7 +31,10 @@ type Work struct {
 	Block               *btcutil.Block
 	Transactions        int
 	TotalTransactions   int
+	AuxBlock            *AuxBlock
 	ready               bool
+	mutability          Mutability
+	versionFixedBits    utils.Version
 }
 
 type WorkChan chan *Work
@@ -36,6 +42,17 @@ type WorkChan chan *Work
 func NewWork(
 	node *Node,
 	block *btcutil.Block,
+) *Work {
+	template, selection := node.currentTemplate()
+	return newWork(node, block, template, selection, node.currentAuxBlock())
+}
+
+func newWork(
+	node *Node,
+	block *btcutil.Block,
+	template *btcjson.GetBlockTemplateResult,
+	selection *TemplateSelection,
+	auxBlock *AuxBlock,
 ) *Work {
 	var header = block.MsgBlock().Header
 	var difficulty = utils.Difficulty(1024)
@@ -51,14 +68,18 @@ func NewWork(
 		Difficulty:          difficulty,
 		BigDifficulty:       bigDifficulty,
 		Version:             utils.Version(header.Version),
-		Ntime:               utils.NTime(node.blockTemplate.CurTime),
-		MinNtime:            utils.NTime(node.blockTemplate.MinTime),
+		Ntime:               utils.NTime(template.CurTime),
+		MinNtime:            utils.NTime(template.MinTime),
+		MaxNtime:            templateMaxNtime(template),
 		TargetDifficulty:    utils.Difficulty(targetDifficulty.Int64()),
 		BigTargetDifficulty: bigTargetDifficulty,
 		Node:                node,
 		Block:               block,
 		Transactions:        len(block.Transactions()),
-		TotalTransactions:   len(node.blockTemplate.Transactions),
+		TotalTransactions:   len(selection.Transactions),
+		AuxBlock:            auxBlock,
+		mutability:          NewMutability(template.Mutable),
+		versionFixedBits:    node.getProfile().VersionFixedBits,
 	}
 	return w
 }
@@ -74,8 +95,10 @@ func (pw *Work) PlainHeader() []byte {
 		pw.plainHeader[1] = byte((header.Version >> 16) & 0xff)
 		pw.plainHeader[2] = byte((header.Version >> 8) & 0xff)
 		pw.plainHeader[3] = byte(header.Version & 0xff)
+		// hashes are kept in wire order, so their words are swapped like every other field of the plain header
 		copy(pw.plainHeader[4:36], header.PrevBlock[:])
 		copy(pw.plainHeader[36:68], header.MerkleRoot[:])
+		utils.SwapUint32Bytes(pw.plainHeader[4:68])
 		pw.plainHeader[68] = byte((pw.Ntime >> 24) & 0xff)
 		pw.plainHeader[69] = byte((pw.Ntime >> 16) & 0xff)
 		pw.plainHeader[70] = byte((pw.Ntime >> 8) & 0xff)
@@ -117,16 +140,29 @@ func (pw *Work) SetVersion(version utils.Version) {
 	pw.plainHeader[3] = byte(pw.Version & 0xff)
 }
 
-func (pw *Work) Submit() error {
+func (pw *Work) SetNonce(nonce utils.Nonce32) {
+	pw.Nonce = uint32(nonce)
+	pw.plainHeader[76] = byte((pw.Nonce >> 24) & 0xff)
+	pw.plainHeader[77] = byte((pw.Nonce >> 16) & 0xff)
+	pw.plainHeader[78] = byte((pw.Nonce >> 8) & 0xff)
+	pw.plainHeader[79] = byte(pw.Nonce & 0xff)
+}
+
+func (pw *Work) header() wire.BlockHeader {
 	var template = pw.Block.MsgBlock().Header
-	var msgBlock wire.MsgBlock
-	msgBlock.Header = wire.BlockHeader{
+	return wire.BlockHeader{
 		Version:    int32(pw.Version),
 		PrevBlock:  template.PrevBlock,
 		MerkleRoot: template.MerkleRoot,
 		Timestamp:  time.Unix(int64(pw.Ntime), 0),
 		Bits:       template.Bits,
+		Nonce:      pw.Nonce,
 	}
+}
+
+func (pw *Work) Submit() error {
+	var msgBlock wire.MsgBlock
+	msgBlock.Header = pw.header()
 	for _, tx := range pw.Block.Transactions() {
 		if err := msgBlock.AddTransaction(tx.MsgTx()); err != nil {
 			return err
@@ -136,3 +172,22 @@ func (pw *Work) Submit() error {
 	block.SetHeight(int32(pw.Block.Height()))
 	return pw.Node.Submit(block)
 }
+
+// MeetsAuxTarget reports whether a header hash solves the aux block this work commits to.
+func (pw *Work) MeetsAuxTarget(hash *big.Int) bool {
+	return pw.AuxBlock != nil && hash.Cmp(pw.AuxBlock.Target) <= 0
+}
+
+// SubmitAux proves the aux block with the solved header, its coinbase and the coinbase merkle branch.
+func (pw *Work) SubmitAux() error {
+	if pw.AuxBlock == nil {
+		return ErrNoAuxBlock
+	}
+	var transactions = pw.Block.Transactions()
+	var hashes = make([]chainhash.Hash, len(transactions)-1)
+	for i, tx := range transactions[1:] {
+		hashes[i] = *tx.Hash()
+	}
+	var auxPow = NewAuxPow(transactions[0].MsgTx(), MerkleBranch(hashes), pw.header())
+	return pw.Node.SubmitAuxBlock(pw.AuxBlock, auxPow)
+}
@@ -0,0 +1,113 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"github.com/stevenroose/go-bitcoin-core-rpc/btcjson"
+)
+
+const (
+	// MaxFutureNtime is how far past the template time a header may go before the network rejects it.
+	MaxFutureNtime = 2 * 60 * 60
+
+	// BIP 23 template mutations relevant to header rolling
+	MutableTime            = "time"
+	MutableTimeIncrement   = "time/increment"
+	MutableTimeDecrement   = "time/decrement"
+	MutableVersionForce    = "version/force"
+	MutableVersionReserved = "version/reserved"
+)
+
+var (
+	ErrNtimeOutOfBounds = errors.New("ntime outside template bounds")
+	ErrVersionImmutable = errors.New("version change not allowed by template")
+)
+
+// Mutability captures which header fields a template allows the miner to change.
+type Mutability struct {
+	TimeIncrement bool
+	TimeDecrement bool
+	Version       bool
+}
+
+// NewMutability parses a template mutable list. bitcoind always sends one, so an empty list is treated as its
+// default of time, transactions and prevblock.
+func NewMutability(mutable []string) Mutability {
+	if len(mutable) == 0 {
+		return Mutability{TimeIncrement: true, TimeDecrement: true}
+	}
+	var m Mutability
+	for _, mutation := range mutable {
+		switch mutation {
+		case MutableTime:
+			m.TimeIncrement = true
+			m.TimeDecrement = true
+		case MutableTimeIncrement:
+			m.TimeIncrement = true
+		case MutableTimeDecrement:
+			m.TimeDecrement = true
+		case MutableVersionForce, MutableVersionReserved:
+			m.Version = true
+		}
+	}
+	return m
+}
+
+func templateMaxNtime(template *btcjson.GetBlockTemplateResult) utils.NTime {
+	var maxNtime = utils.NTime(template.CurTime + MaxFutureNtime)
+	if template.MaxTime != 0 && utils.NTime(template.MaxTime) < maxNtime {
+		maxNtime = utils.NTime(template.MaxTime)
+	}
+	return maxNtime
+}
+
+// NtimeBounds returns the range of ntime values the template allows, narrowed by its time mutations.
+func (pw *Work) NtimeBounds() (utils.NTime, utils.NTime) {
+	var templateNtime = utils.NTime(pw.Block.MsgBlock().Header.Timestamp.Unix())
+	var minNtime, maxNtime = pw.MinNtime, pw.MaxNtime
+	if !pw.mutability.TimeDecrement && minNtime < templateNtime {
+		minNtime = templateNtime
+	}
+	if !pw.mutability.TimeIncrement && maxNtime > templateNtime {
+		maxNtime = templateNtime
+	}
+	if maxNtime < minNtime {
+		maxNtime = minNtime
+	}
+	return minNtime, maxNtime
+}
+
+func (pw *Work) ClampNtime(ntime utils.NTime) utils.NTime {
+	var minNtime, maxNtime = pw.NtimeBounds()
+	if ntime < minNtime {
+		return minNtime
+	}
+	if ntime > maxNtime {
+		return maxNtime
+	}
+	return ntime
+}
+
+// CheckVersion accepts the template version and versions that keep its bits and the chain profile's fixed bits while
+// rolling others, unless the template allows forcing versions outright.
+func (pw *Work) CheckVersion(version utils.Version) error {
+	var templateVersion = utils.Version(pw.Block.MsgBlock().Header.Version)
+	if pw.mutability.Version || version == templateVersion {
+		return nil
+	}
+	var fixedBits = pw.versionFixedBits
+	if version&fixedBits != templateVersion&fixedBits || version&templateVersion != templateVersion {
+		return fmt.Errorf("%w: %s", ErrVersionImmutable, version)
+	}
+	return nil
+}
+
+// CheckHeader refuses an ntime and version pair the template does not allow.
+func (pw *Work) CheckHeader(ntime utils.NTime, version utils.Version) error {
+	var minNtime, maxNtime = pw.NtimeBounds()
+	if ntime < minNtime || ntime > maxNtime {
+		return fmt.Errorf("%w: %s not in [%s, %s]", ErrNtimeOutOfBounds, ntime, minNtime, maxNtime)
+	}
+	return pw.CheckVersion(version)
+}
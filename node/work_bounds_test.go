@@ -0,0 +1,59 @@
+package node
+
+import (
+	"errors"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"testing"
+	"time"
+)
+
+func testBoundsWork(mutable ...string) *Work {
+	var msgBlock wire.MsgBlock
+	msgBlock.Header.Version = 0x20000004
+	msgBlock.Header.Timestamp = time.Unix(1000, 0)
+	return &Work{
+		Block:            btcutil.NewBlock(&msgBlock),
+		Ntime:            1000,
+		MinNtime:         900,
+		MaxNtime:         1000 + MaxFutureNtime,
+		mutability:       NewMutability(mutable),
+		versionFixedBits: BitcoinProfile.VersionFixedBits,
+	}
+}
+
+func TestWork_ClampNtime(t *testing.T) {
+	work := testBoundsWork(MutableTime, "transactions", "prevblock")
+	if work.ClampNtime(800) != 900 || work.ClampNtime(950) != 950 || work.ClampNtime(9000) != 1000+MaxFutureNtime {
+		t.Fatal("ntime not clamped to template bounds")
+	}
+	work = testBoundsWork(MutableTimeIncrement)
+	if work.ClampNtime(950) != 1000 {
+		t.Fatal("ntime decremented without time/decrement")
+	}
+	if err := work.CheckHeader(950, 0x20000004); !errors.Is(err, ErrNtimeOutOfBounds) {
+		t.Fatalf("expected out of bounds, got %v", err)
+	}
+	work = testBoundsWork("prevblock")
+	if minNtime, maxNtime := work.NtimeBounds(); minNtime != 1000 || maxNtime != 1000 {
+		t.Fatalf("immutable time has bounds [%s, %s]", minNtime, maxNtime)
+	}
+}
+
+func TestWork_CheckVersion(t *testing.T) {
+	work := testBoundsWork(MutableTime)
+	for version, allowed := range map[utils.Version]bool{
+		0x20000004: true,
+		0x2fffe004: true,
+		0x2fffe000: false,
+		0x40000004: false,
+	} {
+		if err := work.CheckVersion(version); (err == nil) != allowed {
+			t.Fatalf("version %s allowed %v, got %v", version, allowed, err)
+		}
+	}
+	if err := testBoundsWork(MutableVersionForce).CheckVersion(0x40000000); err != nil {
+		t.Fatal(err)
+	}
+}
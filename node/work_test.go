@@ -0,0 +1,44 @@
+package node
+
+import (
+	"bytes"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/fernandosanchezjr/goasicminer/utils"
+	"testing"
+	"time"
+)
+
+// checkPlainHeader swaps the plain header back to wire order, which must serialize and hash like the block header.
+func checkPlainHeader(t *testing.T, work *Work, header *wire.BlockHeader) {
+	var serialized [80]byte
+	copy(serialized[:], work.PlainHeader())
+	utils.SwapUint32Bytes(serialized[:])
+	var expected bytes.Buffer
+	if err := header.Serialize(&expected); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(serialized[:], expected.Bytes()) {
+		t.Fatalf("plain header %x does not match block header %x", serialized, expected.Bytes())
+	}
+	if hash := chainhash.Hash(utils.DoubleHash(serialized[:])); hash != header.BlockHash() {
+		t.Fatalf("plain header hashes to %s instead of %s", hash, header.BlockHash())
+	}
+}
+
+func TestWork_PlainHeader(t *testing.T) {
+	var header = wire.BlockHeader{Version: 0x20000004, Timestamp: time.Unix(1600000000, 0), Bits: 0x1d00ffff,
+		Nonce: 0x12345678}
+	for i := range header.PrevBlock {
+		header.PrevBlock[i] = byte(i)
+		header.MerkleRoot[i] = byte(0xff - 3*i)
+	}
+	var work = &Work{Block: btcutil.NewBlock(wire.NewMsgBlock(&header)), Ntime: utils.NTime(header.Timestamp.Unix())}
+	checkPlainHeader(t, work, &header)
+	header.Version, header.Timestamp, header.Nonce = 0x20006000, time.Unix(1600000042, 0), 0x9abcdef0
+	work.SetVersion(utils.Version(header.Version))
+	work.SetNtime(utils.NTime(header.Timestamp.Unix()))
+	work.SetNonce(utils.Nonce32(header.Nonce))
+	checkPlainHeader(t, work, &header)
+}